@@ -0,0 +1,229 @@
+// Command lockctl manipulates and inspects the locks of a locking-center from
+// the shell.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/lctest"
+	"github.com/freakmaxi/locking-center-client-go/mutex"
+)
+
+const usage = `usage: lockctl [flags] <command> [arguments]
+
+commands:
+  lock <key>             acquire the key
+  unlock <key>           release the key
+  wait <key>             wait until the key is free
+  reset-key <key>        release the key regardless of its holder
+  reset-source <source>  release the keys of the source address
+  reset-prefix <prefix>  release the locked keys starting with the prefix
+  status [key]           report the state of the key or list the locked keys
+  held-by <source>       list the keys locked by the source address
+  info                   report the protocol version and the capabilities of the server
+  stats [top]            report the locked keys, the waiters and the top contended keys
+  serve                  run an in-memory locking-center on the address for the development
+
+flags:
+`
+
+func main() {
+	flags := flag.NewFlagSet("lockctl", flag.ExitOnError)
+	address := flags.String("addr", envOr("LOCKING_CENTER_ADDR", "localhost:22119"), "address of the locking-center")
+	source := flags.String("source", "", "source address of the locks")
+	timeout := flags.Duration("timeout", 0, "time limit of the lock and wait commands, zero waits forever")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(os.Args[1:])
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if flags.Arg(0) == "serve" {
+		if err := serve(*address); err != nil {
+			fail(err)
+		}
+		return
+	}
+
+	var sourceAddr *string
+	if len(*source) > 0 {
+		sourceAddr = source
+	}
+
+	lc, err := mutex.NewLockingCenterWithSourceAddr(*address, sourceAddr, mutex.WithLogger(log.New(os.Stderr, "", 0)))
+	if err != nil {
+		fail(err)
+	}
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	command := flags.Arg(0)
+	if err := run(ctx, lc, command, flags.Args()[1:]); err != nil {
+		lc.Close()
+		fail(err)
+	}
+
+	// closing the client releases the held keys, the acquired key should
+	// outlive the command until the unlock command
+	if command != "lock" {
+		lc.Close()
+	}
+}
+
+func run(ctx context.Context, lc mutex.LockingCenter, command string, args []string) error {
+	switch command {
+	case "lock":
+		key, err := single(command, args)
+		if err != nil {
+			return err
+		}
+		return lc.LockContext(ctx, key)
+	case "unlock":
+		key, err := single(command, args)
+		if err != nil {
+			return err
+		}
+		return lc.Unlock(key)
+	case "wait":
+		key, err := single(command, args)
+		if err != nil {
+			return err
+		}
+		return lc.WaitContext(ctx, key)
+	case "reset-key":
+		key, err := single(command, args)
+		if err != nil {
+			return err
+		}
+		return lc.ResetByKey(key)
+	case "reset-source":
+		source, err := single(command, args)
+		if err != nil {
+			return err
+		}
+		return lc.ResetBySource(&source)
+	case "reset-prefix":
+		prefix, err := single(command, args)
+		if err != nil {
+			return err
+		}
+		return lc.ResetByPrefix(prefix)
+	case "status":
+		if len(args) == 0 {
+			return list(lc.ListLocks())
+		}
+		key, err := single(command, args)
+		if err != nil {
+			return err
+		}
+		locked, err := lc.IsLocked(key)
+		if err != nil {
+			return err
+		}
+		if locked {
+			fmt.Println("locked")
+		} else {
+			fmt.Println("unlocked")
+		}
+		return nil
+	case "held-by":
+		source, err := single(command, args)
+		if err != nil {
+			return err
+		}
+		return list(lc.LocksBySource(source))
+	case "stats":
+		return stats(lc, args)
+	case "info":
+		info, err := lc.ServerInfo()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("address\t%s\nversion\t%d\ncapabilities\t%s\n", info.Address, info.Version, info.Capabilities)
+		return nil
+	}
+	return fmt.Errorf("unknown command %s", command)
+}
+
+// serve runs the in-memory server of lctest until the process is interrupted
+func serve(address string) error {
+	server, err := lctest.StartServer(address)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "serving on %s\n", server.Addr())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+
+	return server.Close()
+}
+
+func list(locks []mutex.LockInfo, err error) error {
+	if err != nil {
+		return err
+	}
+	for _, lock := range locks {
+		fmt.Printf("%s\t%s\t%s\n", lock.Key, lock.SourceAddr, lock.HeldFor.Truncate(time.Millisecond))
+	}
+	return nil
+}
+
+func stats(lc mutex.LockingCenter, args []string) error {
+	top := 10
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid top %s", args[0])
+		}
+		top = n
+	}
+
+	stats, err := lc.Stats(top)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("locked\t%d\nwaiters\t%d\n", stats.LockedKeys, stats.Waiters)
+	for _, key := range stats.Contended {
+		fmt.Printf("%s\t%d\n", key.Key, key.Waiters)
+	}
+	return nil
+}
+
+func single(command string, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("%s command expects one argument", command)
+	}
+	return args[0], nil
+}
+
+func envOr(name string, fallback string) string {
+	if value, has := os.LookupEnv(name); has {
+		return value
+	}
+	return fallback
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "lockctl: %s\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,77 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/mutex"
+)
+
+const probeTimeout = time.Millisecond * 250
+
+var ErrLocked = errors.New("mutex: locked by another session")
+
+// Mutex has the methods of the Mutex of etcd's concurrency package on a
+// locking-center key, so the code written against it moves over by changing
+// its import and constructor. The key is the prefix as it is.
+type Mutex struct {
+	lc  mutex.Locker
+	pfx string
+
+	mutex sync.Mutex
+	token string
+}
+
+func NewMutex(lc mutex.Locker, pfx string) *Mutex {
+	return &Mutex{lc: lc, pfx: pfx}
+}
+
+// Lock waits for the key until the context is done.
+func (m *Mutex) Lock(ctx context.Context) error {
+	token, err := m.lc.LockOwned(ctx, m.pfx)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	m.token = token
+	m.mutex.Unlock()
+
+	return nil
+}
+
+// TryLock returns ErrLocked when the key stays held by another holder for the
+// probe timeout.
+func (m *Mutex) TryLock(ctx context.Context) error {
+	lockCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	err := m.Lock(lockCtx)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return ErrLocked
+	}
+	return err
+}
+
+func (m *Mutex) Unlock(ctx context.Context) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.lc.UnlockOwned(m.pfx, m.token); err != nil {
+		return err
+	}
+	m.token = ""
+
+	return nil
+}
+
+func (m *Mutex) Key() string {
+	return m.pfx
+}
+
+// NewLocker returns the sync.Locker of the key.
+func NewLocker(lc mutex.Locker, pfx string) sync.Locker {
+	return lc.Locker(pfx)
+}
@@ -0,0 +1,207 @@
+package redislock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/mutex"
+)
+
+const probeTimeout = time.Millisecond * 250
+
+var (
+	ErrNotObtained = errors.New("redislock: not obtained")
+	ErrLockNotHeld = errors.New("redislock: lock not held")
+)
+
+// Client has the api of the bsm/redislock client on a locking-center client,
+// so the code written against it moves over by changing its import and
+// constructor. The ttl of the locks is kept by the client, the key is released
+// once it is passed.
+type Client struct {
+	lc mutex.Locker
+}
+
+func New(lc mutex.Locker) *Client {
+	return &Client{lc: lc}
+}
+
+type Options struct {
+	// RetryStrategy decides the wait before the next attempt when the key is
+	// held, the default is no retry.
+	RetryStrategy RetryStrategy
+	// Metadata is kept with the lock.
+	Metadata string
+}
+
+func (o *Options) retryStrategy() RetryStrategy {
+	if o != nil && o.RetryStrategy != nil {
+		return o.RetryStrategy
+	}
+	return NoRetry()
+}
+
+func (o *Options) metadata() string {
+	if o != nil {
+		return o.Metadata
+	}
+	return ""
+}
+
+// Obtain is the short of New(lc).Obtain(ctx, key, ttl, opt)
+func Obtain(ctx context.Context, lc mutex.Locker, key string, ttl time.Duration, opt *Options) (*Lock, error) {
+	return New(lc).Obtain(ctx, key, ttl, opt)
+}
+
+// Obtain acquires the key for the ttl, ErrNotObtained is returned when the key
+// stays held by another holder after the attempts of the retry strategy. Each
+// attempt waits for the key up to the probe timeout.
+func (c *Client) Obtain(ctx context.Context, key string, ttl time.Duration, opt *Options) (*Lock, error) {
+	retry := opt.retryStrategy()
+
+	for {
+		lockCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+		token, err := c.lc.LockOwned(lockCtx, key)
+		cancel()
+
+		if err == nil {
+			l := &Lock{client: c, key: key, token: token, metadata: opt.metadata()}
+			l.expireAfter(ttl)
+			return l, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ErrNotObtained
+		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			return nil, err
+		}
+
+		backoff := retry.NextBackoff()
+		if backoff <= 0 {
+			return nil, ErrNotObtained
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ErrNotObtained
+		}
+	}
+}
+
+type Lock struct {
+	client   *Client
+	key      string
+	token    string
+	metadata string
+
+	mutex    sync.Mutex
+	expires  time.Time
+	timer    *time.Timer
+	released bool
+}
+
+func (l *Lock) Key() string {
+	return l.key
+}
+
+func (l *Lock) Token() string {
+	return l.token
+}
+
+func (l *Lock) Metadata() string {
+	return l.metadata
+}
+
+// TTL returns the remaining time of the lock, zero once it is released or
+// expired.
+func (l *Lock) TTL(ctx context.Context) (time.Duration, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.released {
+		return 0, nil
+	}
+	if l.expires.IsZero() {
+		return -1, nil
+	}
+	return time.Until(l.expires), nil
+}
+
+// Refresh extends the lock by the ttl, ErrNotObtained is returned once the lock
+// is released or expired.
+func (l *Lock) Refresh(ctx context.Context, ttl time.Duration, opt *Options) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.released {
+		return ErrNotObtained
+	}
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+	l.schedule(ttl)
+
+	return nil
+}
+
+// Release releases the key, ErrLockNotHeld is returned once the lock is
+// released or expired.
+func (l *Lock) Release(ctx context.Context) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.released {
+		return ErrLockNotHeld
+	}
+	return l.release()
+}
+
+func (l *Lock) expireAfter(ttl time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.schedule(ttl)
+}
+
+// schedule should be called holding the mutex, the lock without a positive ttl
+// is kept until it is released
+func (l *Lock) schedule(ttl time.Duration) {
+	l.timer = nil
+	l.expires = time.Time{}
+	if ttl <= 0 {
+		return
+	}
+
+	l.expires = time.Now().Add(ttl)
+	l.timer = time.AfterFunc(ttl, l.expire)
+}
+
+func (l *Lock) expire() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.released || time.Now().Before(l.expires) {
+		return
+	}
+	_ = l.release()
+}
+
+// release should be called holding the mutex
+func (l *Lock) release() error {
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	l.released = true
+
+	err := l.client.lc.UnlockOwned(l.key, l.token)
+	if errors.Is(err, mutex.ErrNotOwner) {
+		return ErrLockNotHeld
+	}
+	return err
+}
@@ -0,0 +1,69 @@
+package redislock
+
+import "time"
+
+// RetryStrategy returns the wait before the next attempt, zero stops the
+// attempts.
+type RetryStrategy interface {
+	NextBackoff() time.Duration
+}
+
+type linearBackoff time.Duration
+
+// LinearBackoff waits the same backoff between the attempts.
+func LinearBackoff(backoff time.Duration) RetryStrategy {
+	return linearBackoff(backoff)
+}
+
+// NoRetry makes a single attempt.
+func NoRetry() RetryStrategy {
+	return linearBackoff(0)
+}
+
+func (r linearBackoff) NextBackoff() time.Duration {
+	return time.Duration(r)
+}
+
+type limitedRetry struct {
+	s   RetryStrategy
+	cnt int
+	max int
+}
+
+// LimitRetry stops the strategy after max retries.
+func LimitRetry(s RetryStrategy, max int) RetryStrategy {
+	return &limitedRetry{s: s, max: max}
+}
+
+func (r *limitedRetry) NextBackoff() time.Duration {
+	if r.cnt >= r.max {
+		return 0
+	}
+	r.cnt++
+	return r.s.NextBackoff()
+}
+
+type exponentialBackoff struct {
+	cnt uint
+	min time.Duration
+	max time.Duration
+}
+
+// ExponentialBackoff doubles the backoff from min after each attempt, up to
+// max.
+func ExponentialBackoff(min, max time.Duration) RetryStrategy {
+	return &exponentialBackoff{min: min, max: max}
+}
+
+func (r *exponentialBackoff) NextBackoff() time.Duration {
+	backoff := r.min
+	for i := uint(0); i < r.cnt && backoff < r.max; i++ {
+		backoff *= 2
+	}
+	r.cnt++
+
+	if backoff > r.max {
+		backoff = r.max
+	}
+	return backoff
+}
@@ -0,0 +1,230 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/mutex"
+)
+
+const (
+	locksPath       = "/locks/"
+	waitPath        = "/wait/"
+	resetKeyPath    = "/reset/key/"
+	resetSourcePath = "/reset/source/"
+)
+
+// Handler exposes the client over http for the services and the dashboards
+// which can not use it directly:
+//
+//	PUT    /locks/{key}           locks the key
+//	DELETE /locks/{key}           unlocks the key
+//	GET    /locks/{key}           reports if the key is locked
+//	GET    /locks/                lists the locked keys, of the source parameter if given
+//	POST   /wait/{key}            waits until the key is free
+//	POST   /reset/key/{key}       resets the key
+//	POST   /reset/source/{source} resets the keys of the source address
+//
+// The lock and the wait requests take the optional timeout query parameter as
+// a duration, like 5s, and the lock requests the source query parameter in
+// place of the source address of the client and the reason query parameter of
+// the acquisition. A lock request abandoned by its caller is abandoned on the
+// server as well.
+type Handler struct {
+	lc mutex.LockingCenter
+}
+
+func NewHandler(lc mutex.LockingCenter) *Handler {
+	return &Handler{lc: lc}
+}
+
+type lockStatus struct {
+	Key    string `json:"key"`
+	Locked bool   `json:"locked"`
+}
+
+type lockInfo struct {
+	Key        string            `json:"key"`
+	SourceAddr string            `json:"sourceAddr"`
+	HeldFor    int64             `json:"heldForMs"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Reason     string            `json:"reason,omitempty"`
+}
+
+type failure struct {
+	Error string `json:"error"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+
+	switch {
+	case path == locksPath && r.Method == http.MethodGet:
+		h.list(w, r)
+	case strings.HasPrefix(path, locksPath):
+		key := strings.TrimPrefix(path, locksPath)
+
+		switch r.Method {
+		case http.MethodPut:
+			h.lock(w, r, key)
+		case http.MethodDelete:
+			h.reply(w, h.lc.Unlock(key))
+		case http.MethodGet:
+			h.status(w, key)
+		default:
+			h.methodNotAllowed(w, "PUT, DELETE, GET")
+		}
+	case strings.HasPrefix(path, waitPath):
+		if r.Method != http.MethodPost {
+			h.methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		h.wait(w, r, strings.TrimPrefix(path, waitPath))
+	case strings.HasPrefix(path, resetKeyPath):
+		if r.Method != http.MethodPost {
+			h.methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		h.reply(w, h.lc.ResetByKey(strings.TrimPrefix(path, resetKeyPath)))
+	case strings.HasPrefix(path, resetSourcePath):
+		if r.Method != http.MethodPost {
+			h.methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		source := strings.TrimPrefix(path, resetSourcePath)
+		h.reply(w, h.lc.ResetBySource(&source))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) lock(w http.ResponseWriter, r *http.Request, key string) {
+	ctx, cancel, err := timeout(r)
+	if err != nil {
+		h.fail(w, http.StatusBadRequest, err)
+		return
+	}
+	defer cancel()
+
+	var sourceAddr *string
+	if source := r.URL.Query().Get("source"); len(source) > 0 {
+		sourceAddr = &source
+	}
+	if reason := r.URL.Query().Get("reason"); len(reason) > 0 {
+		ctx = mutex.ReasonContext(ctx, reason)
+	}
+
+	h.reply(w, <-h.lc.LockAsync(ctx, key, sourceAddr))
+}
+
+func (h *Handler) wait(w http.ResponseWriter, r *http.Request, key string) {
+	ctx, cancel, err := timeout(r)
+	if err != nil {
+		h.fail(w, http.StatusBadRequest, err)
+		return
+	}
+	defer cancel()
+
+	h.reply(w, h.lc.WaitContext(ctx, key))
+}
+
+func (h *Handler) status(w http.ResponseWriter, key string) {
+	locked, err := h.lc.IsLocked(key)
+	if err != nil {
+		h.reply(w, err)
+		return
+	}
+	h.write(w, http.StatusOK, lockStatus{Key: key, Locked: locked})
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	var locks []mutex.LockInfo
+	var err error
+	if source := r.URL.Query().Get("source"); len(source) > 0 {
+		locks, err = h.lc.LocksBySource(source)
+	} else {
+		locks, err = h.lc.ListLocks()
+	}
+	if err != nil {
+		h.reply(w, err)
+		return
+	}
+
+	infos := make([]lockInfo, 0, len(locks))
+	for _, lock := range locks {
+		infos = append(infos, lockInfo{
+			Key:        lock.Key,
+			SourceAddr: lock.SourceAddr,
+			HeldFor:    int64(lock.HeldFor / time.Millisecond),
+			Labels:     lock.Labels,
+			Reason:     lock.Reason,
+		})
+	}
+	h.write(w, http.StatusOK, infos)
+}
+
+func (h *Handler) reply(w http.ResponseWriter, err error) {
+	if err == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h.fail(w, statusOf(err), err)
+}
+
+func (h *Handler) methodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	h.fail(w, http.StatusMethodNotAllowed, errors.New("method is not allowed"))
+}
+
+func (h *Handler) fail(w http.ResponseWriter, status int, err error) {
+	h.write(w, status, failure{Error: err.Error()})
+}
+
+func (h *Handler) write(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func timeout(r *http.Request) (context.Context, context.CancelFunc, error) {
+	value := r.URL.Query().Get("timeout")
+	if len(value) == 0 {
+		ctx, cancel := context.WithCancel(r.Context())
+		return ctx, cancel, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return nil, nil, fmt.Errorf("invalid timeout %s", value)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), d)
+	return ctx, cancel, nil
+}
+
+func statusOf(err error) int {
+	var timeoutErr *mutex.TimeoutError
+	switch {
+	case errors.As(err, &timeoutErr), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusRequestTimeout
+	case errors.Is(err, mutex.ErrKeyInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, mutex.ErrNotOwner), errors.Is(err, mutex.ErrPermissionDenied), errors.Is(err, mutex.ErrCrossNamespace):
+		return http.StatusForbidden
+	case errors.Is(err, mutex.ErrQuotaExceeded):
+		return http.StatusTooManyRequests
+	case errors.Is(err, mutex.ErrNotSupported):
+		return http.StatusNotImplemented
+	case errors.Is(err, mutex.ErrServerRejected):
+		return http.StatusBadGateway
+	case errors.Is(err, mutex.ErrConnUnavailable), errors.Is(err, mutex.ErrClosed), errors.Is(err, mutex.ErrPoolExhausted),
+		errors.Is(err, mutex.ErrTooManyInFlight):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
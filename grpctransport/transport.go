@@ -0,0 +1,355 @@
+package grpctransport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/mutex"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+const (
+	codecName  = "locking-center-raw"
+	streamName = "/lockingcenter.Tunnel/Connect"
+)
+
+var errDeadline = &timeoutError{}
+
+// frame is a chunk of the wire protocol carried by the stream as it is
+type frame struct {
+	data []byte
+}
+
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	f, ok := v.(*frame)
+	if !ok {
+		return nil, errors.New("unexpected message type")
+	}
+	// the message may still be queued after the send returns while the buffer
+	// of the frame is reused
+	return append([]byte(nil), f.data...), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	f, ok := v.(*frame)
+	if !ok {
+		return errors.New("unexpected message type")
+	}
+	f.data = append(f.data[:0], data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return codecName
+}
+
+func init() {
+	encoding.RegisterCodec(rawCodec{})
+}
+
+var streamDesc = grpc.StreamDesc{
+	StreamName:    "Connect",
+	ServerStreams: true,
+	ClientStreams: true,
+}
+
+// Dialer tunnels the connections of the client through the streams of the
+// grpc connection to the proxy registered by RegisterProxy. It is given to
+// the client by mutex.WithDialer, the address of the client is not used.
+func Dialer(cc *grpc.ClientConn) mutex.DialFunc {
+	return func(_ string, timeout time.Duration) (net.Conn, error) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		if timeout > 0 {
+			timer := time.AfterFunc(timeout, cancel)
+			defer timer.Stop()
+		}
+
+		stream, err := cc.NewStream(ctx, &streamDesc, streamName, grpc.CallContentSubtype(codecName), grpc.WaitForReady(true))
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		// the stream is established once the headers of the proxy arrive, the
+		// proxy sends them after it has connected to the locking-center
+		if _, err := stream.Header(); err != nil {
+			cancel()
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			cancel()
+			return nil, ctx.Err()
+		}
+
+		return newStreamConn(stream, cancel, cc.Target()), nil
+	}
+}
+
+// RegisterProxy serves the tunnels of Dialer on the grpc server by connecting
+// each of them to the locking-center at the address.
+func RegisterProxy(s *grpc.Server, address string) {
+	s.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "lockingcenter.Tunnel",
+		HandlerType: (*interface{})(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    streamDesc.StreamName,
+			ServerStreams: true,
+			ClientStreams: true,
+			Handler: func(_ interface{}, stream grpc.ServerStream) error {
+				return proxy(stream, address)
+			},
+		}},
+	}, struct{}{})
+}
+
+func proxy(stream grpc.ServerStream, address string) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(stream.Context(), "tcp", address)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+
+	go func() {
+		// the connection is closed when the client closes the stream
+		defer func() { _ = conn.Close() }()
+
+		f := &frame{}
+		for {
+			if err := stream.RecvMsg(f); err != nil {
+				return
+			}
+			if _, err := conn.Write(f.data); err != nil {
+				return
+			}
+		}
+	}()
+
+	buffer := make([]byte, 32*1024)
+	for {
+		n, err := conn.Read(buffer)
+		if n > 0 {
+			if err := stream.SendMsg(&frame{data: buffer[:n]}); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			// the locking-center or the tunnel has closed the connection
+			return nil
+		}
+	}
+}
+
+type timeoutError struct{}
+
+func (e *timeoutError) Error() string   { return "i/o timeout" }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+type addr string
+
+func (a addr) Network() string { return "grpc" }
+func (a addr) String() string  { return string(a) }
+
+// streamConn is the net.Conn of a tunnel. The stream is received by a single
+// goroutine, the reads wait for its frames until their deadline.
+type streamConn struct {
+	stream grpc.ClientStream
+	cancel context.CancelFunc
+	target string
+
+	frames chan []byte
+	failed chan struct{}
+	err    error
+
+	pending []byte
+
+	writeMutex sync.Mutex
+
+	mutex         sync.Mutex
+	closed        chan struct{}
+	isClosed      bool
+	readDeadline  *deadline
+	writeDeadline *deadline
+}
+
+func newStreamConn(stream grpc.ClientStream, cancel context.CancelFunc, target string) *streamConn {
+	c := &streamConn{
+		stream:        stream,
+		cancel:        cancel,
+		target:        target,
+		frames:        make(chan []byte),
+		failed:        make(chan struct{}),
+		closed:        make(chan struct{}),
+		readDeadline:  newDeadline(),
+		writeDeadline: newDeadline(),
+	}
+	go c.receive()
+
+	return c
+}
+
+func (c *streamConn) receive() {
+	for {
+		f := &frame{}
+		if err := c.stream.RecvMsg(f); err != nil {
+			c.err = err
+			close(c.failed)
+			return
+		}
+
+		select {
+		case c.frames <- f.data:
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+func (c *streamConn) Read(b []byte) (int, error) {
+	if len(c.pending) == 0 {
+		select {
+		case c.pending = <-c.frames:
+		case <-c.failed:
+			if c.err == io.EOF {
+				return 0, io.EOF
+			}
+			return 0, c.err
+		case <-c.closed:
+			return 0, net.ErrClosed
+		case <-c.readDeadline.wait():
+			return 0, errDeadline
+		}
+	}
+
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+
+	return n, nil
+}
+
+func (c *streamConn) Write(b []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	case <-c.writeDeadline.wait():
+		return 0, errDeadline
+	default:
+	}
+
+	if err := c.stream.SendMsg(&frame{data: b}); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *streamConn) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.isClosed {
+		return nil
+	}
+	c.isClosed = true
+	close(c.closed)
+	c.cancel()
+
+	return nil
+}
+
+func (c *streamConn) LocalAddr() net.Addr {
+	return addr("local")
+}
+
+func (c *streamConn) RemoteAddr() net.Addr {
+	return addr(c.target)
+}
+
+func (c *streamConn) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+	return nil
+}
+
+func (c *streamConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+func (c *streamConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+	return nil
+}
+
+// deadline is closed once the time set is passed, a zero time never passes
+type deadline struct {
+	mutex  sync.Mutex
+	timer  *time.Timer
+	passed chan struct{}
+}
+
+func newDeadline() *deadline {
+	return &deadline{passed: make(chan struct{})}
+}
+
+func (d *deadline) set(t time.Time) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.passed
+	}
+	d.timer = nil
+
+	closed := isClosed(d.passed)
+	if t.IsZero() {
+		if closed {
+			d.passed = make(chan struct{})
+		}
+		return
+	}
+
+	if wait := time.Until(t); wait > 0 {
+		if closed {
+			d.passed = make(chan struct{})
+		}
+		passed := d.passed
+		d.timer = time.AfterFunc(wait, func() { close(passed) })
+		return
+	}
+
+	if !closed {
+		close(d.passed)
+	}
+}
+
+func (d *deadline) wait() chan struct{} {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.passed
+}
+
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
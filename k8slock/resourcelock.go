@@ -0,0 +1,204 @@
+package k8slock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/mutex"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	defaultLeaseDuration = 15 * time.Second
+	probeTimeout         = 250 * time.Millisecond
+	unknownHolder        = "unknown"
+)
+
+var resource = schema.GroupResource{Group: "locking-center", Resource: "locks"}
+
+var _ resourcelock.Interface = (*Lock)(nil)
+
+type Option func(*Lock)
+
+// WithLeaseDuration sets the lease of the record read by the candidates while
+// another holder has the key, it is renewed on every read as long as the key
+// is held.
+func WithLeaseDuration(d time.Duration) Option {
+	return func(l *Lock) {
+		l.leaseDuration = d
+	}
+}
+
+// WithEventSubject sets the object the leader election events are recorded
+// for, the events are not recorded without it.
+func WithEventSubject(subject runtime.Object) Option {
+	return func(l *Lock) {
+		l.subject = subject
+	}
+}
+
+// Lock is the leader election lock of a locking-center key, the leader is the
+// holder of the key. The election record is not stored, the candidates read
+// the holder and the hold duration of the key, so the leadership moves only
+// when the key is released or its session is lost.
+type Lock struct {
+	lc            mutex.LockingCenter
+	key           string
+	config        resourcelock.ResourceLockConfig
+	leaseDuration time.Duration
+	subject       runtime.Object
+
+	mutex  sync.Mutex
+	held   bool
+	record resourcelock.LeaderElectionRecord
+}
+
+// New returns the lock of the key. The identity of the config is sent as the
+// source address of the key, so the other candidates can tell the leader.
+func New(lc mutex.LockingCenter, key string, config resourcelock.ResourceLockConfig, opts ...Option) *Lock {
+	l := &Lock{
+		lc:            lc,
+		key:           key,
+		config:        config,
+		leaseDuration: defaultLeaseDuration,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Get returns the record of the leader, NotFound is returned when the key is
+// free.
+func (l *Lock) Get(ctx context.Context) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	holder, heldFor, locked, err := l.holder()
+	if err != nil {
+		if !errors.Is(err, mutex.ErrNotSupported) {
+			return nil, nil, err
+		}
+		// the key is probed by the create when the server can not be queried
+		if l.held {
+			return encode(l.record)
+		}
+		return nil, nil, apierrors.NewNotFound(resource, l.key)
+	}
+
+	if !locked {
+		// the key is lost with its session
+		l.held = false
+		return nil, nil, apierrors.NewNotFound(resource, l.key)
+	}
+
+	if l.held {
+		return encode(l.record)
+	}
+
+	now := time.Now()
+	return encode(resourcelock.LeaderElectionRecord{
+		HolderIdentity:       holder,
+		LeaseDurationSeconds: int(l.leaseDuration / time.Second),
+		AcquireTime:          metav1.NewTime(now.Add(-heldFor)),
+		RenewTime:            metav1.NewTime(now),
+		LeaderTransitions:    l.record.LeaderTransitions,
+	})
+}
+
+// holder returns the source address and the hold duration of the key, the
+// holder is unknown when the server can not list the locks
+func (l *Lock) holder() (string, time.Duration, bool, error) {
+	locked, err := l.lc.IsLocked(l.key)
+	if err != nil || !locked {
+		return "", 0, false, err
+	}
+
+	locks, err := l.lc.ListLocks()
+	if err == nil {
+		for _, lock := range locks {
+			if lock.Key == l.key {
+				return lock.SourceAddr, lock.HeldFor, true, nil
+			}
+		}
+	}
+	return unknownHolder, 0, true, nil
+}
+
+func encode(record resourcelock.LeaderElectionRecord) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &record, raw, nil
+}
+
+// Create acquires the key for the identity of the record.
+func (l *Lock) Create(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	return l.Update(ctx, ler)
+}
+
+// Update acquires the key when the record is of this candidate and it is not
+// held yet, and releases the key when the leader steps down.
+func (l *Lock) Update(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if ler.HolderIdentity != l.config.Identity {
+		l.record = ler
+		if !l.held {
+			return nil
+		}
+		l.held = false
+		return l.lc.Unlock(l.key)
+	}
+
+	if !l.held {
+		if err := l.acquire(ctx); err != nil {
+			return err
+		}
+		l.held = true
+	}
+	l.record = ler
+
+	return nil
+}
+
+// acquire gives up the key when it stays held for the probe timeout
+func (l *Lock) acquire(ctx context.Context) error {
+	lockCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	identity := l.config.Identity
+	if err := <-l.lc.LockAsync(lockCtx, l.key, &identity); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			return fmt.Errorf("%s is held by another candidate", l.key)
+		}
+		return err
+	}
+	return nil
+}
+
+func (l *Lock) RecordEvent(s string) {
+	if l.config.EventRecorder == nil || l.subject == nil {
+		return
+	}
+	events := fmt.Sprintf("%v %v", l.config.Identity, s)
+	l.config.EventRecorder.Eventf(l.subject, "Normal", "LeaderElection", events)
+}
+
+func (l *Lock) Describe() string {
+	return fmt.Sprintf("locking-center/%s", l.key)
+}
+
+func (l *Lock) Identity() string {
+	return l.config.Identity
+}
@@ -0,0 +1,218 @@
+package lctest
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/mutex"
+)
+
+// Clock is a mutex.Clock moved only by Advance, so the leases, the renewals
+// and the retries can be tested without the time passing.
+type Clock struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers []*clockTimer
+	// the number of the timers started or reset so far
+	armed int
+}
+
+// settleTimeout is how long Simulate waits in the real time for the goroutines
+// woken by a timer to start their next ones
+const settleTimeout = time.Millisecond * 5
+
+var _ mutex.Clock = (*Clock)(nil)
+
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+// Advance moves the clock forward and fires the timers and the tickers due on
+// the way in the order of their time.
+func (c *Clock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	target := c.now.Add(d)
+
+	for {
+		sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].at.Before(c.timers[j].at) })
+		if len(c.timers) == 0 || c.timers[0].at.After(target) {
+			break
+		}
+
+		t := c.timers[0]
+		c.now = t.at
+		if t.period > 0 {
+			t.at = t.at.Add(t.period)
+		} else {
+			c.timers = c.timers[1:]
+		}
+
+		if t.fn != nil {
+			go t.fn()
+			continue
+		}
+		select {
+		case t.c <- c.now:
+		default:
+		}
+	}
+
+	c.now = target
+	c.mutex.Unlock()
+}
+
+// Simulate moves the clock forward by the timers due on the way one at a time,
+// letting the goroutines woken by each of them run and start their next timers
+// before the following one fires. So the chains of the retries, the lease
+// expiries and the renewals unfold in their virtual order within milliseconds
+// of the real time.
+func (c *Clock) Simulate(d time.Duration) {
+	c.mutex.Lock()
+	target := c.now.Add(d)
+	c.mutex.Unlock()
+
+	for {
+		c.mutex.Lock()
+		var next *clockTimer
+		for _, t := range c.timers {
+			if !t.at.After(target) && (next == nil || t.at.Before(next.at)) {
+				next = t
+			}
+		}
+		if next == nil {
+			c.now = target
+			c.mutex.Unlock()
+			return
+		}
+		step := next.at.Sub(c.now)
+		armed := c.armed
+		c.mutex.Unlock()
+
+		c.Advance(step)
+		c.settle(armed)
+	}
+}
+
+// settle waits for a timer to be started after the armed ones, or for the
+// settle timeout when the woken goroutines have nothing more to wait for
+func (c *Clock) settle(armed int) {
+	deadline := time.Now().Add(settleTimeout)
+	for time.Now().Before(deadline) {
+		runtime.Gosched()
+
+		c.mutex.Lock()
+		started := c.armed > armed
+		c.mutex.Unlock()
+		if started {
+			return
+		}
+		time.Sleep(time.Microsecond * 50)
+	}
+}
+
+// WaitTimers waits in the real time until at least n timers are waiting for
+// the clock, so a test advances it once the code under the test is sleeping.
+// It reports false when the timeout passes first.
+func (c *Clock) WaitTimers(n int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for c.Timers() < n {
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(time.Microsecond * 100)
+	}
+	return true
+}
+
+// Timers returns the number of the timers and the tickers waiting for the
+// clock, so a test can tell that the code under the test is sleeping.
+func (c *Clock) Timers() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.timers)
+}
+
+func (c *Clock) NewTimer(d time.Duration) mutex.Timer {
+	return c.start(d, 0, nil)
+}
+
+func (c *Clock) NewTicker(d time.Duration) mutex.Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return clockTicker{clockTimer: c.start(d, d, nil)}
+}
+
+func (c *Clock) AfterFunc(d time.Duration, f func()) mutex.Timer {
+	return c.start(d, 0, f)
+}
+
+func (c *Clock) start(d time.Duration, period time.Duration, fn func()) *clockTimer {
+	t := &clockTimer{clock: c, period: period, fn: fn, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// remove drops the timer from the clock, it should be called holding the
+// mutex
+func (c *Clock) remove(t *clockTimer) bool {
+	for i, waiting := range c.timers {
+		if waiting == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type clockTimer struct {
+	clock  *Clock
+	at     time.Time
+	period time.Duration
+	fn     func()
+	c      chan time.Time
+}
+
+func (t *clockTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *clockTimer) Stop() bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+
+	return t.clock.remove(t)
+}
+
+func (t *clockTimer) Reset(d time.Duration) bool {
+	t.clock.mutex.Lock()
+	active := t.clock.remove(t)
+	t.at = t.clock.now.Add(d)
+	t.clock.timers = append(t.clock.timers, t)
+	t.clock.armed++
+	t.clock.mutex.Unlock()
+
+	if d <= 0 {
+		// due already, fired without waiting for an advance
+		t.clock.Advance(0)
+	}
+	return active
+}
+
+type clockTicker struct {
+	*clockTimer
+}
+
+func (t clockTicker) Stop() {
+	t.clockTimer.Stop()
+}
@@ -0,0 +1,37 @@
+package lctest
+
+import (
+	"net/url"
+	"sync"
+
+	"github.com/freakmaxi/locking-center-client-go/mutex"
+)
+
+var (
+	memMutex  sync.Mutex
+	memStores = make(map[string]*store)
+)
+
+func init() {
+	mutex.Register("mem", mutex.DriverFunc(openMem))
+}
+
+// openMem opens a Fake of the in-memory server named by the host of the uri,
+// the clients opening the same name share the keys. The source query
+// parameter is the source address of the client. The options are ignored.
+func openMem(uri *url.URL, _ ...mutex.Option) (mutex.LockingCenter, error) {
+	memMutex.Lock()
+	s, has := memStores[uri.Host]
+	if !has {
+		s = newStore()
+		memStores[uri.Host] = s
+	}
+	memMutex.Unlock()
+
+	sourceAddr := defaultSourceAddr
+	if query := uri.Query(); len(query["source"]) > 0 {
+		sourceAddr = query.Get("source")
+	}
+
+	return newFake(s, sourceAddr), nil
+}
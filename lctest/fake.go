@@ -0,0 +1,889 @@
+package lctest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/mutex"
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+const defaultSourceAddr = "lctest"
+
+// Fake is an in-memory mutex.LockingCenter. The keys are queued and granted in
+// the same order of the real server, without any network.
+type Fake struct {
+	store      *store
+	sourceAddr string
+	labels     map[string]string
+	clock      mutex.Clock
+
+	mutex    sync.Mutex
+	closed   bool
+	abort    chan struct{}
+	inFlight sync.WaitGroup
+	held     map[string]*heldLock
+}
+
+type heldLock struct {
+	acquiredAt time.Time
+	token      string
+}
+
+var _ mutex.LockingCenter = (*Fake)(nil)
+
+func New() *Fake {
+	return newFake(newStore(), defaultSourceAddr)
+}
+
+func newFake(s *store, sourceAddr string) *Fake {
+	return &Fake{
+		store:      s,
+		sourceAddr: sourceAddr,
+		clock:      mutex.SystemClock,
+		abort:      make(chan struct{}),
+		held:       make(map[string]*heldLock),
+	}
+}
+
+// Client returns another client of the same in-memory server, so several
+// processes competing for the same keys can be simulated.
+func (f *Fake) Client(sourceAddr string) *Fake {
+	client := newFake(f.store, sourceAddr)
+	client.clock = f.clock
+	return client
+}
+
+// SetClock replaces the clock of the client, the clients created by it after
+// take the same clock.
+func (f *Fake) SetClock(clock mutex.Clock) {
+	f.clock = clock
+}
+
+// SetLabels sets the labels of the locks acquired by the client, reported by
+// ListLocks.
+func (f *Fake) SetLabels(labels map[string]string) {
+	f.labels = labels
+}
+
+func (f *Fake) Clock() mutex.Clock {
+	return f.clock
+}
+
+func (f *Fake) begin(ctx context.Context) (context.Context, func(), error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return nil, nil, mutex.ErrClosed
+	}
+	f.inFlight.Add(1)
+
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-f.abort:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		cancel()
+		f.inFlight.Done()
+	}, nil
+}
+
+func (f *Fake) aborted() bool {
+	select {
+	case <-f.abort:
+		return true
+	default:
+		return false
+	}
+}
+
+func (f *Fake) acquire(ctx context.Context, key string, sourceAddr string) error {
+	if err := mutex.ValidateKey(key); err != nil {
+		return err
+	}
+
+	ctx, end, err := f.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	fairness, _ := mutex.FairnessOf(ctx)
+
+	w := &waiter{client: f, sourceAddr: sourceAddr, priority: mutex.PriorityOf(ctx), barge: fairness == mutex.FairnessBarging, labels: f.labels, reason: mutex.ReasonOf(ctx)}
+	if err := f.store.acquire(ctx, key, w); err != nil {
+		if f.aborted() {
+			return mutex.ErrClosed
+		}
+		return err
+	}
+
+	f.mutex.Lock()
+	f.held[key] = &heldLock{acquiredAt: f.clock.Now()}
+	f.mutex.Unlock()
+
+	return nil
+}
+
+func (f *Fake) Lock(key string) error {
+	return f.LockContext(context.Background(), key)
+}
+
+func (f *Fake) LockContext(ctx context.Context, key string) error {
+	return f.acquire(ctx, key, f.source(ctx))
+}
+
+// LockFor locks the key and releases it once maxHold passes on the clock of the
+// fake without its unlock
+func (f *Fake) LockFor(key string, maxHold time.Duration) error {
+	if err := f.Lock(key); err != nil {
+		return err
+	}
+	if maxHold <= 0 {
+		return nil
+	}
+
+	f.mutex.Lock()
+	h := f.held[key]
+	f.mutex.Unlock()
+
+	f.clock.AfterFunc(maxHold, func() {
+		f.mutex.Lock()
+		held := f.held[key] == h
+		f.mutex.Unlock()
+
+		if held {
+			_ = f.unlock(key)
+		}
+	})
+	return nil
+}
+
+// source is the source address attached to the context, or the one of the
+// client
+func (f *Fake) source(ctx context.Context) string {
+	if source, has := mutex.SourceOf(ctx); has {
+		return source
+	}
+	return f.sourceAddr
+}
+
+func (f *Fake) LockAsync(ctx context.Context, key string, sourceAddr *string) <-chan error {
+	source := f.source(ctx)
+	if sourceAddr != nil {
+		source = *sourceAddr
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		defer close(result)
+		result <- f.acquire(ctx, key, source)
+	}()
+
+	return result
+}
+
+func (f *Fake) Unlock(key string) error {
+	f.mutex.Lock()
+	h, has := f.held[key]
+	f.mutex.Unlock()
+
+	if has && len(h.token) > 0 {
+		return mutex.ErrNotOwner
+	}
+	return f.unlock(key)
+}
+
+func (f *Fake) unlock(key string) error {
+	if err := mutex.ValidateKey(key); err != nil {
+		return err
+	}
+
+	_, end, err := f.begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	f.store.mutex.Lock()
+	f.store.release(key)
+	f.store.mutex.Unlock()
+
+	f.mutex.Lock()
+	delete(f.held, key)
+	f.mutex.Unlock()
+
+	return nil
+}
+
+func (f *Fake) LockOwned(ctx context.Context, key string) (string, error) {
+	if err := f.LockContext(ctx, key); err != nil {
+		return "", err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	token := fmt.Sprintf("%s/%d", key, time.Now().UnixNano())
+	if h, has := f.held[key]; has {
+		h.token = token
+	}
+	return token, nil
+}
+
+func (f *Fake) UnlockOwned(key string, token string) error {
+	f.mutex.Lock()
+	h, has := f.held[key]
+	f.mutex.Unlock()
+
+	if !has || h.token != token {
+		return mutex.ErrNotOwner
+	}
+	return f.unlock(key)
+}
+
+func canonicalKeys(keys []string) []string {
+	sorted := make([]string, 0, len(keys))
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+func (f *Fake) Steal(key string, olderThan time.Duration) error {
+	if err := mutex.ValidateKey(key); err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	_, held := f.held[key]
+	f.mutex.Unlock()
+	if held {
+		return nil
+	}
+
+	for _, lock := range f.store.locks() {
+		if lock.Key != key {
+			continue
+		}
+		if lock.HeldFor < olderThan {
+			return &mutex.StealError{Key: key, SourceAddr: lock.SourceAddr, HeldFor: lock.HeldFor}
+		}
+		if err := f.ResetByKey(key); err != nil {
+			return err
+		}
+		break
+	}
+
+	return f.LockContext(mutex.PriorityContext(context.Background(), mutex.StealPriority), key)
+}
+
+func (f *Fake) LockAll(keys []string, sourceAddr *string) error {
+	source := f.sourceAddr
+	if sourceAddr != nil {
+		source = *sourceAddr
+	}
+
+	sorted := canonicalKeys(keys)
+	for i, key := range sorted {
+		if err := f.acquire(context.Background(), key, source); err != nil {
+			_ = f.unlockAll(sorted[:i])
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *Fake) UnlockAll(keys []string) error {
+	return f.unlockAll(canonicalKeys(keys))
+}
+
+func (f *Fake) unlockAll(sorted []string) error {
+	var lastErr error
+	for i := len(sorted) - 1; i >= 0; i-- {
+		if err := f.Unlock(sorted[i]); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (f *Fake) Wait(key string) error {
+	return f.WaitContext(context.Background(), key)
+}
+
+func (f *Fake) WaitTimeout(key string, d time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	return f.WaitContext(ctx, key)
+}
+
+func (f *Fake) WaitContext(ctx context.Context, key string) error {
+	begin := f.clock.Now()
+
+	if err := f.LockContext(ctx, key); err != nil {
+		if err == context.DeadlineExceeded {
+			return &mutex.TimeoutError{Key: key, Waited: f.clock.Now().Sub(begin)}
+		}
+		return err
+	}
+	return f.Unlock(key)
+}
+
+func (f *Fake) PassiveWait(key string) error {
+	if err := mutex.ValidateKey(key); err != nil {
+		return err
+	}
+
+	ctx, end, err := f.begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	for {
+		locked, changed := f.store.state(key)
+		if !locked {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return mutex.ErrClosed
+		}
+	}
+}
+
+func (f *Fake) WaitAll(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if err := mutex.ValidateKey(key); err != nil {
+			return err
+		}
+	}
+
+	ctx, end, err := f.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	for {
+		var changed <-chan struct{}
+		for _, key := range keys {
+			if locked, c := f.store.state(key); locked {
+				changed = c
+				break
+			}
+		}
+		if changed == nil {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			if f.aborted() {
+				return mutex.ErrClosed
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+func (f *Fake) WaitAny(ctx context.Context, keys ...string) (string, error) {
+	if len(keys) == 0 {
+		return "", mutex.ValidateKey("")
+	}
+	for _, key := range keys {
+		if err := mutex.ValidateKey(key); err != nil {
+			return "", err
+		}
+	}
+
+	ctx, end, err := f.begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer end()
+
+	for {
+		cases := []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}}
+		for _, key := range keys {
+			locked, changed := f.store.state(key)
+			if !locked {
+				return key, nil
+			}
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(changed)})
+		}
+
+		if chosen, _, _ := reflect.Select(cases); chosen == 0 {
+			if f.aborted() {
+				return "", mutex.ErrClosed
+			}
+			return "", ctx.Err()
+		}
+	}
+}
+
+func (f *Fake) Watch(key string) (<-chan mutex.LockEvent, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan mutex.LockEvent, 16)
+
+	go func() {
+		defer close(events)
+
+		known := false
+		last := false
+
+		for {
+			locked, changed := f.store.state(key)
+			if !known || locked != last {
+				known = true
+				last = locked
+
+				select {
+				case events <- mutex.LockEvent{Key: key, Locked: locked, At: f.clock.Now()}:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				return
+			case <-f.abort:
+				return
+			}
+		}
+	}()
+
+	return events, cancel
+}
+
+func (f *Fake) QueuePosition(key string) (int, error) {
+	if err := mutex.ValidateKey(key); err != nil {
+		return 0, err
+	}
+
+	return f.store.position(key, func(w *waiter) bool { return w.client == f }), nil
+}
+
+func (f *Fake) IsLocked(key string) (bool, error) {
+	if err := mutex.ValidateKey(key); err != nil {
+		return false, err
+	}
+
+	locked, _ := f.store.state(key)
+	return locked, nil
+}
+
+func (f *Fake) ListLocks() ([]mutex.LockInfo, error) {
+	return f.store.locks(), nil
+}
+
+func (f *Fake) LocksBySource(sourceAddr string) ([]mutex.LockInfo, error) {
+	return mutex.FilterBySource(f.store.locks(), sourceAddr), nil
+}
+
+func (f *Fake) Stats(top int) (mutex.KeyspaceStats, error) {
+	var stats mutex.KeyspaceStats
+	for _, key := range f.store.stats() {
+		if key.locked {
+			stats.LockedKeys++
+		}
+		stats.Waiters += key.waiters
+		if key.waiters > 0 {
+			stats.Contended = append(stats.Contended, mutex.KeyStats{Key: key.key, Waiters: key.waiters})
+		}
+	}
+	stats.Contended = mutex.TopContended(stats.Contended, top)
+
+	return stats, nil
+}
+
+func (f *Fake) WithLock(ctx context.Context, key string, fn func() error) (err error) {
+	if err := f.LockContext(ctx, key); err != nil {
+		return err
+	}
+
+	defer func() {
+		unlockErr := f.Unlock(key)
+
+		if r := recover(); r != nil {
+			panic(r)
+		}
+
+		if err == nil {
+			err = unlockErr
+		}
+	}()
+
+	return fn()
+}
+
+type keyLocker struct {
+	f   *Fake
+	key string
+}
+
+func (f *Fake) Locker(key string) sync.Locker {
+	return &keyLocker{f: f, key: key}
+}
+
+func (k *keyLocker) Lock() {
+	if err := k.f.Lock(k.key); err != nil {
+		panic(fmt.Sprintf("locker of key %s failed: %s", k.key, err))
+	}
+}
+
+func (k *keyLocker) Unlock() {
+	if err := k.f.Unlock(k.key); err != nil {
+		panic(fmt.Sprintf("locker of key %s failed: %s", k.key, err))
+	}
+}
+
+func (f *Fake) ResetByKey(key string) error {
+	if err := mutex.ValidateKey(key); err != nil {
+		return err
+	}
+
+	f.store.mutex.Lock()
+	defer f.store.mutex.Unlock()
+
+	f.store.release(key)
+	return nil
+}
+
+func (f *Fake) ResetBySource(sourceAddr *string) error {
+	source := f.sourceAddr
+	if sourceAddr != nil {
+		source = *sourceAddr
+	}
+
+	f.store.releaseBy(func(w *waiter) bool { return w.sourceAddr == source })
+	return nil
+}
+
+func (f *Fake) ResetKeys(keys []string) error {
+	failures := make(mutex.KeyErrors)
+	for _, key := range keys {
+		if err := f.ResetByKey(key); err != nil {
+			failures[key] = err
+		}
+	}
+
+	if len(failures) > 0 {
+		return failures
+	}
+	return nil
+}
+
+func (f *Fake) ResetByPrefix(prefix string) error {
+	for _, lock := range f.store.locks() {
+		if strings.HasPrefix(lock.Key, prefix) {
+			_ = f.ResetByKey(lock.Key)
+		}
+	}
+	return nil
+}
+
+func (f *Fake) ResetAll() error {
+	f.store.releaseBy(func(w *waiter) bool { return true })
+	return nil
+}
+
+func (f *Fake) Batch(ctx context.Context, operations ...mutex.BatchOperation) ([]error, error) {
+	results := make([]error, len(operations))
+
+	for i, operation := range operations {
+		results[i] = f.apply(ctx, operation)
+		if results[i] == mutex.ErrClosed {
+			return nil, results[i]
+		}
+	}
+
+	return results, nil
+}
+
+func (f *Fake) apply(ctx context.Context, operation mutex.BatchOperation) error {
+	switch operation.Action() {
+	case wire.Lock:
+		return f.LockContext(ctx, operation.Key())
+	case wire.Unlock:
+		return f.Unlock(operation.Key())
+	case wire.ResetByKey:
+		return f.ResetByKey(operation.Key())
+	case wire.ResetBySource:
+		return f.ResetBySource(operation.SourceAddr())
+	}
+	return mutex.ErrNotSupported
+}
+
+type bulkSession struct {
+	f   *Fake
+	ctx context.Context
+
+	mutex   sync.Mutex
+	results []error
+	closed  bool
+}
+
+func (f *Fake) Bulk(ctx context.Context, _ int) (mutex.BulkSession, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return nil, mutex.ErrClosed
+	}
+	return &bulkSession{f: f, ctx: ctx}, nil
+}
+
+func (s *bulkSession) Send(operation mutex.BatchOperation) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return mutex.ErrClosed
+	}
+
+	err := s.f.apply(s.ctx, operation)
+	if err == mutex.ErrClosed {
+		return err
+	}
+	s.results = append(s.results, err)
+
+	return nil
+}
+
+func (s *bulkSession) Close() ([]error, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return nil, mutex.ErrClosed
+	}
+	s.closed = true
+
+	return s.results, nil
+}
+
+func (f *Fake) HeldLocks() []mutex.HeldLock {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	locks := make([]mutex.HeldLock, 0, len(f.held))
+	for key, h := range f.held {
+		locks = append(locks, mutex.HeldLock{Key: key, AcquiredAt: h.acquiredAt})
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].AcquiredAt.Before(locks[j].AcquiredAt) })
+
+	return locks
+}
+
+// DebugEvents has no events to keep
+func (f *Fake) DebugEvents() []mutex.DebugEvent {
+	return nil
+}
+
+func (f *Fake) LatencyHistograms() []mutex.PatternLatency {
+	return nil
+}
+
+func (f *Fake) DumpState() ([]byte, error) {
+	f.mutex.Lock()
+	state := mutex.ClientState{Address: defaultSourceAddr, SourceAddr: f.sourceAddr, Closed: f.closed, Held: make([]mutex.HeldState, 0, len(f.held))}
+	for key, h := range f.held {
+		state.Held = append(state.Held, mutex.HeldState{
+			Key:        key,
+			AcquiredAt: h.acquiredAt,
+			HeldFor:    int64(f.clock.Now().Sub(h.acquiredAt) / time.Millisecond),
+			Owned:      len(h.token) > 0,
+		})
+	}
+	f.mutex.Unlock()
+
+	sort.Slice(state.Held, func(i, j int) bool { return state.Held[i].Key < state.Held[j].Key })
+	return json.MarshalIndent(state, "", "  ")
+}
+
+func (f *Fake) Ping() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return mutex.ErrClosed
+	}
+	return nil
+}
+
+// ServerInfo reports the protocol of the package
+func (f *Fake) ServerInfo() (mutex.Info, error) {
+	if err := f.Ping(); err != nil {
+		return mutex.Info{}, err
+	}
+	return mutex.Info{Address: defaultSourceAddr, Version: wire.ProtocolVersion, Capabilities: wire.Capabilities}, nil
+}
+
+// Warmup has no connections to open
+func (f *Fake) Warmup(_ int) error {
+	return nil
+}
+
+func (f *Fake) ReleaseAll(ctx context.Context) error {
+	f.mutex.Lock()
+	keys := make([]string, 0, len(f.held))
+	for key := range f.held {
+		keys = append(keys, key)
+	}
+	f.mutex.Unlock()
+
+	var failed []string
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", key, err))
+			continue
+		}
+		if err := f.unlock(key); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", key, err))
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("unable to release %d lock(s): %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (f *Fake) Drain(ctx context.Context) *mutex.ShutdownReport {
+	if !f.stop() {
+		return &mutex.ShutdownReport{}
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		f.inFlight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+	}
+
+	return f.shutdown()
+}
+
+func (f *Fake) Close() *mutex.ShutdownReport {
+	if !f.stop() {
+		return &mutex.ShutdownReport{}
+	}
+	return f.shutdown()
+}
+
+func (f *Fake) stop() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return false
+	}
+	f.closed = true
+	return true
+}
+
+func (f *Fake) shutdown() *mutex.ShutdownReport {
+	report := &mutex.ShutdownReport{}
+
+	f.store.mutex.Lock()
+	for key, e := range f.store.entries {
+		for _, w := range e.queue {
+			if w.client == f {
+				report.AbortedWaiters = append(report.AbortedWaiters, key)
+			}
+		}
+	}
+	f.store.mutex.Unlock()
+
+	close(f.abort)
+	f.inFlight.Wait()
+
+	f.mutex.Lock()
+	held := f.held
+	f.held = make(map[string]*heldLock)
+	f.mutex.Unlock()
+
+	f.store.mutex.Lock()
+	for key := range held {
+		if e, has := f.store.entries[key]; has && e.holder != nil && e.holder.client == f {
+			f.store.release(key)
+		}
+		report.Released = append(report.Released, key)
+	}
+	f.store.mutex.Unlock()
+
+	sort.Strings(report.Released)
+	sort.Strings(report.AbortedWaiters)
+
+	return report
+}
+
+type pipeline struct {
+	f *Fake
+
+	mutex  sync.Mutex
+	closed bool
+}
+
+func (f *Fake) Pipeline(_ context.Context, _ int) (mutex.Pipeline, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return nil, mutex.ErrClosed
+	}
+	return &pipeline{f: f}, nil
+}
+
+func (p *pipeline) Do(ctx context.Context, operation mutex.BatchOperation) error {
+	p.mutex.Lock()
+	closed := p.closed
+	p.mutex.Unlock()
+
+	if closed {
+		return mutex.ErrClosed
+	}
+	return p.f.apply(ctx, operation)
+}
+
+func (p *pipeline) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return mutex.ErrClosed
+	}
+	p.closed = true
+
+	return nil
+}
@@ -0,0 +1,204 @@
+package lctest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/mutex"
+)
+
+const (
+	directionDial = "dial"
+	directionOut  = "out"
+	directionIn   = "in"
+)
+
+// exchange is a line of the recording, the data is sent by the client when the
+// direction is out and received by it when the direction is in. Every
+// connection starts with a dial line.
+type exchange struct {
+	Conn      int    `json:"conn"`
+	Direction string `json:"dir"`
+	Data      []byte `json:"data"`
+}
+
+// Recorder writes the wire exchanges of the client to the writer as json lines
+// to be replayed later by the Replayer. It is given to the client by
+// mutex.WithDialer(recorder.Dial).
+type Recorder struct {
+	dial mutex.DialFunc
+
+	mutex   sync.Mutex
+	encoder *json.Encoder
+	conns   int
+	err     error
+}
+
+func NewRecorder(w io.Writer, dial mutex.DialFunc) *Recorder {
+	if dial == nil {
+		dial = func(address string, timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout("tcp", address, timeout)
+		}
+	}
+
+	return &Recorder{
+		dial:    dial,
+		encoder: json.NewEncoder(w),
+	}
+}
+
+func (r *Recorder) Dial(address string, timeout time.Duration) (net.Conn, error) {
+	conn, err := r.dial(address, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	id := r.conns
+	r.conns++
+	r.mutex.Unlock()
+
+	r.record(id, directionDial, nil)
+
+	return &recordedConn{Conn: conn, recorder: r, id: id}, nil
+}
+
+// Err returns the first failure of writing the recording.
+func (r *Recorder) Err() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.err
+}
+
+func (r *Recorder) record(id int, direction string, data []byte) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.err != nil {
+		return
+	}
+
+	b := make([]byte, len(data))
+	copy(b, data)
+
+	r.err = r.encoder.Encode(exchange{Conn: id, Direction: direction, Data: b})
+}
+
+type recordedConn struct {
+	net.Conn
+	recorder *Recorder
+	id       int
+}
+
+func (c *recordedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.recorder.record(c.id, directionIn, b[:n])
+	}
+	return n, err
+}
+
+func (c *recordedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.recorder.record(c.id, directionOut, b[:n])
+	}
+	return n, err
+}
+
+// Replayer serves the connections of the client from a recording in the dial
+// order. The bytes sent by the client are compared with the recorded ones and
+// the connection is closed on the first difference.
+type Replayer struct {
+	mutex  sync.Mutex
+	script [][]exchange
+	next   int
+	err    error
+}
+
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	p := &Replayer{}
+
+	decoder := json.NewDecoder(r)
+	for {
+		var e exchange
+		if err := decoder.Decode(&e); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+
+		for len(p.script) <= e.Conn {
+			p.script = append(p.script, nil)
+		}
+		p.script[e.Conn] = append(p.script[e.Conn], e)
+	}
+
+	return p, nil
+}
+
+func (p *Replayer) Dial(_ string, _ time.Duration) (net.Conn, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.next >= len(p.script) {
+		return nil, fmt.Errorf("recording has no more connections after %d", p.next)
+	}
+
+	id := p.next
+	p.next++
+
+	client, server := net.Pipe()
+	go p.serve(server, id, p.script[id])
+
+	return client, nil
+}
+
+// Err returns the first difference between the replayed and the recorded
+// exchanges.
+func (p *Replayer) Err() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.err
+}
+
+func (p *Replayer) fail(err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+func (p *Replayer) serve(conn net.Conn, id int, script []exchange) {
+	defer func() { _ = conn.Close() }()
+
+	for i, e := range script {
+		switch e.Direction {
+		case directionOut:
+			b := make([]byte, len(e.Data))
+			if _, err := io.ReadFull(conn, b); err != nil {
+				p.fail(fmt.Errorf("connection %d exchange %d: %s", id, i, err))
+				return
+			}
+			if !bytes.Equal(b, e.Data) {
+				p.fail(fmt.Errorf("connection %d exchange %d: expected %q, received %q", id, i, e.Data, b))
+				return
+			}
+		case directionIn:
+			if _, err := conn.Write(e.Data); err != nil {
+				p.fail(fmt.Errorf("connection %d exchange %d: %s", id, i, err))
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,653 @@
+package lctest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/mutex"
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+const pipeAddr = "pipe"
+
+var errServerClosed = errors.New("server is closed")
+
+// Reply overrides the handling of a request. The delay is applied first, then
+// the connection is dropped, the raw bytes are written instead of the real
+// answer, the request is rejected or denied by the authorization. The code and
+// the reason of the rejection are sent on the connections agreeing on the
+// detailed rejections.
+type Reply struct {
+	Delay  time.Duration
+	Drop   bool
+	Raw    []byte
+	Reject bool
+	Deny   bool
+	Code   wire.Code
+	Reason string
+}
+
+// Script decides the reply of a request, nil keeps the real server behaviour.
+type Script func(req wire.Request) *Reply
+
+// Server speaks the locking-center wire protocol on a random local port and
+// keeps the locks in memory.
+type Server struct {
+	listener net.Listener
+	store    *store
+	ctx      context.Context
+	cancel   context.CancelFunc
+	handlers sync.WaitGroup
+
+	mutex    sync.Mutex
+	script   Script
+	auth     func(token string) bool
+	requests []wire.Request
+	conns    map[net.Conn]struct{}
+	waiters  map[*waiter]context.CancelFunc
+}
+
+func NewServer() (*Server, error) {
+	return StartServer("")
+}
+
+// StartServer starts the server on the address, a random local port when it
+// is empty, so the development environments can use it in place of the real
+// locking-center.
+func StartServer(address string) (*Server, error) {
+	if len(address) == 0 {
+		address = "127.0.0.1:0"
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newServer(listener)
+	s.handlers.Add(1)
+	go s.accept()
+
+	return s, nil
+}
+
+// NewPipeServer creates a server without a listener, the clients connect to it
+// in the process over net.Pipe by mutex.WithDialer(server.Dial), so no sockets
+// are opened at all.
+func NewPipeServer() *Server {
+	return newServer(nil)
+}
+
+func newServer(listener net.Listener) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		listener: listener,
+		store:    newStore(),
+		ctx:      ctx,
+		cancel:   cancel,
+		conns:    make(map[net.Conn]struct{}),
+		waiters:  make(map[*waiter]context.CancelFunc),
+	}
+}
+
+// Addr is the address of the listener, "pipe" for the servers without one.
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return pipeAddr
+	}
+	return s.listener.Addr().String()
+}
+
+// Dial is a mutex.DialFunc connecting to the server in the process over
+// net.Pipe, the address and the timeout are ignored.
+func (s *Server) Dial(address string, timeout time.Duration) (net.Conn, error) {
+	client, server := net.Pipe()
+
+	s.mutex.Lock()
+	if s.ctx.Err() != nil {
+		s.mutex.Unlock()
+		return nil, errServerClosed
+	}
+	s.conns[server] = struct{}{}
+	s.handlers.Add(1)
+	s.mutex.Unlock()
+
+	go s.serve(server)
+
+	return client, nil
+}
+
+func (s *Server) Script(script Script) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.script = script
+}
+
+// RequireAuth makes the connections authenticate by a token the check accepts
+// before their other frames, the frames of the others are rejected and the
+// connection is closed.
+func (s *Server) RequireAuth(check func(token string) bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.auth = check
+}
+
+// Requests returns the requests received so far in the arrival order.
+func (s *Server) Requests() []wire.Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	requests := make([]wire.Request, len(s.requests))
+	copy(requests, s.requests)
+
+	return requests
+}
+
+func (s *Server) Close() error {
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+
+	s.mutex.Lock()
+	s.cancel()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mutex.Unlock()
+
+	s.handlers.Wait()
+
+	return err
+}
+
+func (s *Server) accept() {
+	defer s.handlers.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mutex.Lock()
+		s.conns[conn] = struct{}{}
+		s.mutex.Unlock()
+
+		s.handlers.Add(1)
+		go s.serve(conn)
+	}
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer s.handlers.Done()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+
+		_ = conn.Close()
+	}()
+
+	authenticated := false
+	// the writes of the answers, detailed once the hello frame agrees on it
+	out := conn
+
+	r := bufio.NewReader(conn)
+	for {
+		req, err := wire.DecodeRequest(r)
+		if err != nil {
+			if err != io.EOF {
+				_, _ = conn.Write([]byte("-"))
+			}
+			return
+		}
+
+		if req.Action != wire.Auth && !authenticated && s.requiresAuth() {
+			_, _ = conn.Write([]byte("-"))
+			return
+		}
+
+		if !s.reply(out, r, req) {
+			return
+		}
+		if req.Action == wire.Auth {
+			authenticated = true
+		}
+		if req.Action == wire.Hello && agreesDetails(req) {
+			out = &detailConn{Conn: conn}
+		}
+	}
+}
+
+func (s *Server) reply(conn net.Conn, r *bufio.Reader, req wire.Request) bool {
+	s.mutex.Lock()
+	s.requests = append(s.requests, req)
+	script := s.script
+	s.mutex.Unlock()
+
+	if script != nil {
+		if reply := script(req); reply != nil {
+			if reply.Delay > 0 {
+				select {
+				case <-time.After(reply.Delay):
+				case <-s.ctx.Done():
+					return false
+				}
+			}
+			if reply.Drop {
+				return false
+			}
+			if reply.Raw != nil {
+				_, err := conn.Write(reply.Raw)
+				return err == nil
+			}
+			if reply.Reject || reply.Deny {
+				return reject(conn, req, wire.Response{Denied: reply.Deny, Code: reply.Code, Reason: reply.Reason})
+			}
+		}
+	}
+
+	return s.handle(conn, r, req)
+}
+
+func (s *Server) handle(conn net.Conn, r *bufio.Reader, req wire.Request) bool {
+	var sourceAddr string
+	if req.SourceAddr != nil {
+		sourceAddr = *req.SourceAddr
+	}
+
+	switch req.Action {
+	case wire.Lock:
+		ctx, stop := s.await(conn, r)
+		defer stop()
+
+		w := &waiter{sourceAddr: sourceAddr, priority: req.Priority, barge: req.Barge, id: req.ID}
+		for name, value := range req.Labels {
+			if name == wire.ReasonLabel {
+				w.reason = value
+				continue
+			}
+			if w.labels == nil {
+				w.labels = make(map[string]string, len(req.Labels))
+			}
+			w.labels[name] = value
+		}
+
+		if req.MaxWait > 0 {
+			var expire context.CancelFunc
+			ctx, expire = context.WithTimeout(ctx, req.MaxWait)
+			defer expire()
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		s.mutex.Lock()
+		s.waiters[w] = cancel
+		s.mutex.Unlock()
+
+		err := s.store.acquire(ctx, req.Key, w)
+
+		s.mutex.Lock()
+		delete(s.waiters, w)
+		s.mutex.Unlock()
+
+		if err == context.DeadlineExceeded {
+			return reject(conn, req, wire.Response{Code: wire.CodeExpired, Reason: "max wait expired"})
+		}
+		if err != nil {
+			if _, multiplexed := conn.(*muxWriter); multiplexed {
+				// the abandoned lock is answered on the multiplexed connection
+				return reject(conn, req, wire.Response{Reason: "abandoned"})
+			}
+			return false
+		}
+	case wire.Unlock, wire.ResetByKey:
+		s.store.mutex.Lock()
+		s.store.release(req.Key)
+		s.store.mutex.Unlock()
+	case wire.ResetBySource:
+		s.store.releaseBy(func(w *waiter) bool { return w.sourceAddr == sourceAddr })
+	case wire.ResetAll:
+		s.store.releaseBy(func(w *waiter) bool { return true })
+	case wire.Abandon:
+		s.abandon(req.Key, sourceAddr)
+	case wire.Observe:
+		ctx, stop := s.await(conn, r)
+		defer stop()
+
+		if !s.observe(ctx, req.Key) {
+			return false
+		}
+	case wire.Watch:
+		if !s.answer(conn, req, nil) {
+			return false
+		}
+
+		ctx, stop := s.await(conn, r)
+		defer stop()
+
+		s.stream(ctx, conn, req.Key)
+		return false
+	case wire.QueuePosition:
+		position := s.store.position(req.Key, func(w *waiter) bool { return w.sourceAddr == sourceAddr })
+
+		payload := make([]byte, 4)
+		binary.LittleEndian.PutUint32(payload, uint32(int32(position)))
+
+		return s.answer(conn, req, payload)
+	case wire.Status:
+		locked, _ := s.store.state(req.Key)
+
+		payload := []byte{0}
+		if locked {
+			payload[0] = 1
+		}
+		return s.answer(conn, req, payload)
+	case wire.List:
+		return s.answer(conn, req, encodeLocks(s.store, req.ListLabels, req.Version))
+	case wire.Stats:
+		return s.answer(conn, req, encodeStats(s.store, req.Version))
+	case wire.Session:
+		if !s.answer(conn, req, nil) {
+			return false
+		}
+
+		ctx, stop := s.await(conn, r)
+		<-ctx.Done()
+		stop()
+
+		s.store.releaseBy(func(w *waiter) bool { return w.sourceAddr == sourceAddr })
+		return false
+	case wire.Auth:
+		s.mutex.Lock()
+		check := s.auth
+		s.mutex.Unlock()
+
+		if check != nil && !check(string(req.Payload)) {
+			_ = reject(conn, req, wire.Response{Code: wire.CodeDenied})
+			return false
+		}
+	case wire.Multiplex:
+		if !s.answer(conn, req, nil) {
+			return false
+		}
+
+		s.multiplex(conn, r)
+		return false
+	case wire.Hello:
+		hello, err := wire.DecodeHello(req.Payload)
+		if err != nil {
+			_ = reject(conn, req, wire.Response{Code: wire.CodeInvalid, Reason: err.Error()})
+			return false
+		}
+
+		if hello.Version > wire.ProtocolVersion {
+			hello.Version = wire.ProtocolVersion
+		}
+		hello.Capabilities &= wire.Capabilities
+
+		return s.answer(conn, req, wire.EncodeHello(hello))
+	}
+
+	return s.answer(conn, req, nil)
+}
+
+func (s *Server) requiresAuth() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.auth != nil
+}
+
+// await returns a context that is cancelled when the client hangs up while it
+// is waiting for the answer. The watch is stopped before the next request is
+// read from the connection.
+func (s *Server) await(conn net.Conn, r *bufio.Reader) (context.Context, func()) {
+	if w, multiplexed := conn.(*muxWriter); multiplexed {
+		return context.WithCancel(w.ctx)
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		if _, err := r.Peek(1); err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return
+			}
+			cancel()
+		}
+	}()
+
+	return ctx, func() {
+		_ = conn.SetReadDeadline(time.Now())
+		<-done
+		_ = conn.SetReadDeadline(time.Time{})
+		cancel()
+	}
+}
+
+// muxWriter prefixes the answers of a request by its id on a multiplexed
+// connection
+type muxWriter struct {
+	net.Conn
+	ctx   context.Context
+	id    uint64
+	mutex *sync.Mutex
+}
+
+func (w *muxWriter) Write(b []byte) (int, error) {
+	frame := make([]byte, 8, 8+len(b))
+	binary.LittleEndian.PutUint64(frame, w.id)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if _, err := w.Conn.Write(append(frame, b...)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// multiplex handles the requests of the multiplexed connection concurrently
+// and answers them in the order they complete, until the client hangs up
+func (s *Server) multiplex(conn net.Conn, r *bufio.Reader) {
+	var calls sync.WaitGroup
+	defer calls.Wait()
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+
+	var writeMutex sync.Mutex
+	for {
+		req, err := wire.DecodeRequest(r)
+		if err != nil {
+			return
+		}
+		w := &muxWriter{Conn: conn, ctx: ctx, id: req.ID, mutex: &writeMutex}
+
+		switch req.Action {
+		case wire.Watch, wire.Session, wire.Hello, wire.Auth, wire.Multiplex:
+			if !reject(w, req, wire.Response{Code: wire.CodeInvalid, Reason: "not multiplexed"}) {
+				return
+			}
+			continue
+		}
+
+		calls.Add(1)
+		go func(req wire.Request) {
+			defer calls.Done()
+
+			if !s.reply(w, nil, req) {
+				_ = conn.Close()
+			}
+		}(req)
+	}
+}
+
+func (s *Server) abandon(key string, sourceAddr string) {
+	s.store.mutex.Lock()
+	e, has := s.store.entries[key]
+	var queue []*waiter
+	if has {
+		queue = append(queue, e.queue...)
+	}
+	s.store.mutex.Unlock()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, w := range queue {
+		if w.sourceAddr != sourceAddr {
+			continue
+		}
+		if cancel, has := s.waiters[w]; has {
+			cancel()
+			return
+		}
+	}
+}
+
+func (s *Server) observe(ctx context.Context, key string) bool {
+	for {
+		locked, changed := s.store.state(key)
+		if !locked {
+			return true
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+func (s *Server) stream(ctx context.Context, conn net.Conn, key string) {
+	known := false
+	last := false
+
+	for {
+		locked, changed := s.store.state(key)
+		if !known || locked != last {
+			known = true
+			last = locked
+
+			state := []byte{0}
+			if locked {
+				state[0] = 1
+			}
+			if _, err := conn.Write(state); err != nil {
+				return
+			}
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// detailConn is a connection agreeing on the detailed rejections
+type detailConn struct {
+	net.Conn
+}
+
+func agreesDetails(req wire.Request) bool {
+	hello, err := wire.DecodeHello(req.Payload)
+	return err == nil && hello.Has(wire.CapErrorDetails)
+}
+
+// reject answers the rejection, detailed when the connection agrees on it or
+// the request is a v2 frame
+func reject(conn net.Conn, req wire.Request, resp wire.Response) bool {
+	return respond(conn, req, resp)
+}
+
+func (s *Server) answer(conn net.Conn, req wire.Request, payload []byte) bool {
+	return respond(conn, req, wire.Response{Accepted: true, Payload: payload})
+}
+
+// respond answers the request in the frame version of the request
+func respond(conn net.Conn, req wire.Request, resp wire.Response) bool {
+	underlying := conn
+	if w, multiplexed := conn.(*muxWriter); multiplexed {
+		underlying = w.Conn
+	}
+
+	var b []byte
+	_, detailed := underlying.(*detailConn)
+	switch {
+	case req.Version >= 2:
+		b = wire.EncodeResponseV2(req.Action, resp)
+	case detailed:
+		b = wire.EncodeDetailed(req.Action, resp)
+	default:
+		b = wire.EncodeResponse(req.Action, resp)
+	}
+	_, err := conn.Write(b)
+	return err == nil
+}
+
+func encodeLocks(s *store, labels bool, version uint8) []byte {
+	locks := s.locks()
+
+	buffer := bytes.NewBuffer(nil)
+	_ = binary.Write(buffer, binary.LittleEndian, uint32(len(locks)))
+	for _, lock := range locks {
+		wire.EncodeString(buffer, lock.Key, version)
+		wire.EncodeString(buffer, lock.SourceAddr, version)
+		_ = binary.Write(buffer, binary.LittleEndian, int64(lock.HeldFor/time.Millisecond))
+		if labels {
+			wire.EncodeLabels(buffer, holderLabels(lock))
+		}
+	}
+
+	return buffer.Bytes()
+}
+
+// holderLabels are the labels of the lock along with its reason
+func holderLabels(lock mutex.LockInfo) map[string]string {
+	if len(lock.Reason) == 0 {
+		return lock.Labels
+	}
+
+	labels := map[string]string{wire.ReasonLabel: lock.Reason}
+	for name, value := range lock.Labels {
+		labels[name] = value
+	}
+	return labels
+}
+
+func encodeStats(s *store, version uint8) []byte {
+	stats := s.stats()
+
+	buffer := bytes.NewBuffer(nil)
+	_ = binary.Write(buffer, binary.LittleEndian, uint32(len(stats)))
+	for _, key := range stats {
+		wire.EncodeString(buffer, key.key, version)
+		if key.locked {
+			buffer.WriteByte(1)
+		} else {
+			buffer.WriteByte(0)
+		}
+		_ = binary.Write(buffer, binary.LittleEndian, uint32(key.waiters))
+	}
+
+	return buffer.Bytes()
+}
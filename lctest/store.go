@@ -0,0 +1,258 @@
+package lctest
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/mutex"
+)
+
+type waiter struct {
+	client     *Fake
+	sourceAddr string
+	priority   uint8
+	barge      bool
+	labels     map[string]string
+	reason     string
+	// id is the request id of the lock deduplicated by the server
+	id       uint64
+	replaced bool
+}
+
+var errReplaced = errors.New("lock request is replaced by its retry")
+
+type entry struct {
+	holder     *waiter
+	acquiredAt time.Time
+	queue      []*waiter
+}
+
+// store is the shared in-memory server state of the fakes created from the
+// same New call.
+type store struct {
+	mutex   sync.Mutex
+	entries map[string]*entry
+	changed chan struct{}
+}
+
+func newStore() *store {
+	return &store{
+		entries: make(map[string]*entry),
+		changed: make(chan struct{}),
+	}
+}
+
+func (s *store) entry(key string) *entry {
+	e, has := s.entries[key]
+	if !has {
+		e = &entry{}
+		s.entries[key] = e
+	}
+	return e
+}
+
+// notify wakes up everyone waiting for a state change, it should be called
+// holding the mutex.
+func (s *store) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// release gives the key to the next waiter in the queue, it should be called
+// holding the mutex.
+func (s *store) release(key string) {
+	e, has := s.entries[key]
+	if !has || e.holder == nil {
+		return
+	}
+
+	e.holder = nil
+	if len(e.queue) == 0 {
+		delete(s.entries, key)
+	}
+	s.notify()
+}
+
+func (s *store) acquire(ctx context.Context, key string, w *waiter) error {
+	s.mutex.Lock()
+	e := s.entry(key)
+	if w.id != 0 && e.holder != nil && e.holder.id == w.id {
+		// the retry of a granted lock whose answer is lost
+		s.mutex.Unlock()
+		return nil
+	}
+	if e.replace(w) {
+		s.notify()
+	} else {
+		e.enqueue(w)
+	}
+
+	for {
+		if w.replaced {
+			s.mutex.Unlock()
+			return errReplaced
+		}
+		if e.holder == nil && (e.queue[0] == w || w.barge) {
+			e.holder = w
+			e.acquiredAt = time.Now()
+			e.dequeue(w)
+			s.notify()
+			s.mutex.Unlock()
+
+			return nil
+		}
+
+		changed := s.changed
+		s.mutex.Unlock()
+
+		select {
+		case <-changed:
+			s.mutex.Lock()
+		case <-ctx.Done():
+			s.mutex.Lock()
+			s.leave(e, key, w)
+			s.mutex.Unlock()
+
+			return ctx.Err()
+		}
+	}
+}
+
+// replace puts the waiter in the place of the queued one of the same request
+// id and reports if there was one
+func (e *entry) replace(w *waiter) bool {
+	if w.id == 0 {
+		return false
+	}
+	for i, queued := range e.queue {
+		if queued.id == w.id {
+			queued.replaced = true
+			e.queue[i] = w
+			return true
+		}
+	}
+	return false
+}
+
+// enqueue queues the waiter behind the ones of the same or higher priorities
+func (e *entry) enqueue(w *waiter) {
+	i := len(e.queue)
+	for i > 0 && e.queue[i-1].priority < w.priority {
+		i--
+	}
+
+	e.queue = append(e.queue, nil)
+	copy(e.queue[i+1:], e.queue[i:])
+	e.queue[i] = w
+}
+
+// dequeue removes the waiter taking the key from the queue
+func (e *entry) dequeue(w *waiter) {
+	for i, queued := range e.queue {
+		if queued == w {
+			e.queue = append(e.queue[:i], e.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// leave removes the waiter from the queue of the key, it should be called
+// holding the mutex.
+func (s *store) leave(e *entry, key string, w *waiter) {
+	for i, queued := range e.queue {
+		if queued == w {
+			e.queue = append(e.queue[:i], e.queue[i+1:]...)
+			break
+		}
+	}
+	if e.holder == nil && len(e.queue) == 0 {
+		delete(s.entries, key)
+	}
+	s.notify()
+}
+
+// state returns if the key is locked and the channel closed on the next state
+// change.
+func (s *store) state(key string) (bool, chan struct{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e, has := s.entries[key]
+	return has && e.holder != nil, s.changed
+}
+
+func (s *store) position(key string, match func(w *waiter) bool) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e, has := s.entries[key]
+	if !has {
+		return -1
+	}
+	if e.holder != nil && match(e.holder) {
+		return 0
+	}
+	for i, w := range e.queue {
+		if match(w) {
+			if e.holder == nil {
+				return i
+			}
+			return i + 1
+		}
+	}
+	return -1
+}
+
+func (s *store) locks() []mutex.LockInfo {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	locks := make([]mutex.LockInfo, 0, len(s.entries))
+	for key, e := range s.entries {
+		if e.holder == nil {
+			continue
+		}
+		locks = append(locks, mutex.LockInfo{
+			Key:        key,
+			SourceAddr: e.holder.sourceAddr,
+			HeldFor:    time.Since(e.acquiredAt),
+			Labels:     e.holder.labels,
+			Reason:     e.holder.reason,
+		})
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].Key < locks[j].Key })
+
+	return locks
+}
+
+// stats returns the lock state and the waiters of the keys
+func (s *store) stats() []keyStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats := make([]keyStats, 0, len(s.entries))
+	for key, e := range s.entries {
+		stats = append(stats, keyStats{key: key, locked: e.holder != nil, waiters: len(e.queue)})
+	}
+	return stats
+}
+
+type keyStats struct {
+	key     string
+	locked  bool
+	waiters int
+}
+
+func (s *store) releaseBy(match func(w *waiter) bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for key, e := range s.entries {
+		if e.holder != nil && match(e.holder) {
+			s.release(key)
+		}
+	}
+}
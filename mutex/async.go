@@ -0,0 +1,23 @@
+package mutex
+
+import (
+	"context"
+)
+
+// LockAsync starts acquiring the key and returns at once. The result is sent
+// on the returned channel, which is closed afterwards. The caller giving up on
+// the result should cancel the context, otherwise the key may be acquired
+// after it has stopped waiting.
+func (l *lockingCenter) LockAsync(ctx context.Context, key string, sourceAddr *string) <-chan error {
+	if sourceAddr == nil {
+		sourceAddr = l.sourceOf(ctx)
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		defer close(result)
+		result <- l.execute(ctx, maLock, key, sourceAddr)
+	}()
+
+	return result
+}
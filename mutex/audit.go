@@ -0,0 +1,53 @@
+package mutex
+
+import (
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+// AuditEvent is a successful lock, unlock or reset of the client. The actor is
+// the source address of the operation, and the key is empty for the resets
+// by the source address and of all the keys.
+type AuditEvent struct {
+	At     time.Time
+	Action wire.Action
+	Key    string
+	Actor  string
+}
+
+type AuditHandler func(event AuditEvent)
+
+// WithAuditHandler calls the handler on every successful lock, unlock and
+// reset, including the ones of the batches, the pipelines and the shutdown,
+// so the lock activity can be shipped to an audit pipeline without wrapping
+// the call sites. The handler is called on the goroutine of the operation
+// and should not block.
+func WithAuditHandler(handler AuditHandler) Option {
+	return func(o *options) {
+		o.auditHandler = handler
+	}
+}
+
+func (l *lockingCenter) audit(action mutexAction, key string, sourceAddr *string) {
+	if l.options.auditHandler == nil {
+		return
+	}
+
+	switch action {
+	case maLock, maUnlock, maResetByKey, maResetBySource, maResetAll:
+	default:
+		return
+	}
+	defer l.rescue("audit handler")
+
+	if sourceAddr == nil {
+		sourceAddr = l.sourceAddr
+	}
+
+	event := AuditEvent{At: l.options.clock.Now(), Action: wire.Action(action), Key: key}
+	if sourceAddr != nil {
+		event.Actor = *sourceAddr
+	}
+	l.options.auditHandler(event)
+}
@@ -0,0 +1,54 @@
+package mutex
+
+import "time"
+
+// WithAdaptiveRetry retries the failed locks of a key starting with the min
+// interval and doubles it on every failure up to the max interval. The
+// interval is shared by the locks of the same key and starts over once a lock
+// of the key returns.
+func WithAdaptiveRetry(min, max time.Duration) Option {
+	return func(o *options) {
+		if min <= 0 || max < min {
+			return
+		}
+		o.adaptiveRetry = &retryBounds{min: min, max: max}
+	}
+}
+
+type retryBounds struct {
+	min time.Duration
+	max time.Duration
+}
+
+func (l *lockingCenter) retryDelay(action mutexAction, key string) time.Duration {
+	bounds := l.options.adaptiveRetry
+	if bounds == nil || action != maLock {
+		return l.options.resolve().retryInterval
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	delay, has := l.backoffs[key]
+	if !has {
+		delay = bounds.min
+	}
+
+	next := delay * 2
+	if next > bounds.max {
+		next = bounds.max
+	}
+	l.backoffs[key] = next
+
+	return delay
+}
+
+func (l *lockingCenter) resetDelay(action mutexAction, key string) {
+	if l.options.adaptiveRetry == nil || action != maLock {
+		return
+	}
+
+	l.mutex.Lock()
+	delete(l.backoffs, key)
+	l.mutex.Unlock()
+}
@@ -0,0 +1,111 @@
+package mutex
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	barrierProbeTimeout = time.Millisecond * 250
+	barrierPollInterval = time.Millisecond * 100
+)
+
+type Barrier struct {
+	lc      LockingCenter
+	key     string
+	parties int
+	index   int
+	phase   int
+}
+
+func NewBarrier(lc LockingCenter, key string, parties int, index int) (*Barrier, error) {
+	if parties < 1 || index < 0 || index >= parties {
+		return nil, fmt.Errorf("barrier index should be in between 0 and %d", parties-1)
+	}
+
+	return &Barrier{
+		lc:      lc,
+		key:     key,
+		parties: parties,
+		index:   index,
+	}, nil
+}
+
+func (b *Barrier) arrivalKey(index int) string {
+	return fmt.Sprintf("%s:%d:a:%d", b.key, b.phase, index)
+}
+
+func (b *Barrier) passKey(index int) string {
+	return fmt.Sprintf("%s:%d:p:%d", b.key, b.phase, index)
+}
+
+// Wait blocks until all the parties have arrived to the current phase. The
+// arrival of a party is the lock of its arrival key, it stays held until every
+// party has passed the phase which is observed by the release of pass keys.
+func (b *Barrier) Wait(ctx context.Context) error {
+	if err := b.lc.LockContext(ctx, b.passKey(b.index)); err != nil {
+		return err
+	}
+	if err := b.lc.LockContext(ctx, b.arrivalKey(b.index)); err != nil {
+		_ = b.lc.Unlock(b.passKey(b.index))
+		return err
+	}
+	defer func() {
+		_ = b.lc.Unlock(b.arrivalKey(b.index))
+		b.phase++
+	}()
+
+	for i := 0; i < b.parties; i++ {
+		if i == b.index {
+			continue
+		}
+		if err := b.arrived(ctx, b.arrivalKey(i)); err != nil {
+			_ = b.lc.Unlock(b.passKey(b.index))
+			return err
+		}
+	}
+
+	if err := b.lc.Unlock(b.passKey(b.index)); err != nil {
+		return err
+	}
+
+	for i := 0; i < b.parties; i++ {
+		if i == b.index {
+			continue
+		}
+		if err := b.lc.LockContext(ctx, b.passKey(i)); err != nil {
+			return err
+		}
+		if err := b.lc.Unlock(b.passKey(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Barrier) arrived(ctx context.Context, key string) error {
+	for {
+		locked, err := probe(ctx, b.lc, key, barrierProbeTimeout)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return nil
+		}
+
+		if err := b.pause(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+func (b *Barrier) pause(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-after(b.lc.Clock(), barrierPollInterval):
+		return nil
+	}
+}
@@ -0,0 +1,279 @@
+package mutex
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+type BatchOperation struct {
+	action     mutexAction
+	key        string
+	sourceAddr *string
+	// the release claimed by the strict unlock
+	claimed *heldLock
+}
+
+func (o BatchOperation) Action() wire.Action {
+	return wire.Action(o.action)
+}
+
+func (o BatchOperation) Key() string {
+	return o.key
+}
+
+func (o BatchOperation) SourceAddr() *string {
+	return o.sourceAddr
+}
+
+func BatchLock(key string) BatchOperation {
+	return BatchOperation{action: maLock, key: key}
+}
+
+func BatchUnlock(key string) BatchOperation {
+	return BatchOperation{action: maUnlock, key: key}
+}
+
+func BatchResetByKey(key string) BatchOperation {
+	return BatchOperation{action: maResetByKey, key: key}
+}
+
+func BatchResetBySource(sourceAddr *string) BatchOperation {
+	return BatchOperation{action: maResetBySource, sourceAddr: sourceAddr}
+}
+
+// Batch sends all the operations in a single write and reads their results
+// back together. The server executes them in order, so a contended lock in the
+// batch holds the rest until it is granted.
+func (l *lockingCenter) Batch(ctx context.Context, operations ...BatchOperation) (_ []error, err error) {
+	defer l.recovered(&err)
+
+	if len(operations) == 0 {
+		return nil, nil
+	}
+
+	// the operations are normalized in place, the ones of the caller are kept
+	// as they are
+	operations = append([]BatchOperation(nil), operations...)
+
+	op, err := l.begin(operations[0].action, operations[0].key)
+	if err != nil {
+		return nil, err
+	}
+	defer l.end(op)
+
+	for _, operation := range operations {
+		if l.options.crossesTenant(operation.action) {
+			return nil, ErrCrossNamespace
+		}
+	}
+
+	results := make([]error, len(operations))
+
+	if l.options.resolve().bypass {
+		for i, operation := range operations {
+			results[i] = l.dryRun(operation.action, l.options.normalize(operation.key))
+		}
+		return results, nil
+	}
+
+	// the refused operations are not sent, their results are kept in place
+	sent := make([]int, 0, len(operations))
+	batch := make([]BatchOperation, 0, len(operations))
+	for i := range operations {
+		if results[i] = l.unowned(operations[i]); results[i] == nil {
+			results[i] = l.claimBatched(&operations[i])
+		}
+		if results[i] == nil {
+			sent = append(sent, i)
+			batch = append(batch, operations[i])
+		}
+	}
+	if len(batch) == 0 {
+		return results, nil
+	}
+
+	replies, err := l.pipelined(ctx, batch)
+	if err != nil {
+		for _, operation := range batch {
+			l.unclaim(operation.claimed)
+		}
+		return nil, err
+	}
+
+	for j, reply := range replies {
+		if !reply.Accepted {
+			l.unclaim(batch[j].claimed)
+			results[sent[j]] = rejection(batch[j].action, reply)
+			continue
+		}
+		l.track(batch[j].action, batch[j].key, batch[j].sourceAddr)
+	}
+
+	return results, nil
+}
+
+// pipelined sends the operations in a single write on a connection and reads
+// their replies in order
+func (l *lockingCenter) pipelined(ctx context.Context, operations []BatchOperation) ([]wire.Response, error) {
+	if !l.supports(wire.CapPipelining) {
+		return nil, ErrNotSupported
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	for i := range operations {
+		operations[i].key = l.options.normalize(operations[i].key)
+
+		if operations[i].action == maLock && operations[i].sourceAddr == nil {
+			operations[i].sourceAddr = l.sourceOf(ctx)
+		}
+
+		if err := l.preparePackage(buffer, operations[i].action, operations[i].key, operations[i].sourceAddr, 0, 0, l.fairness(ctx), l.maxWait(ctx), ReasonOf(ctx)); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, operation := range operations {
+		leave, err := l.admit(operation.action)
+		if err != nil {
+			return nil, err
+		}
+		defer leave()
+	}
+
+	release, err := l.takeSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if err := l.throttle(ctx); err != nil {
+		return nil, err
+	}
+
+	started := time.Now()
+
+	conn, err := l.dial(ctx, batchAction(operations))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.bound(conn, batchAction(operations), started); err != nil {
+		l.hangUp(conn)
+		return nil, err
+	}
+
+	stop := l.watch(ctx, conn)
+
+	reusable := false
+	defer func() { l.finish(conn, stop, reusable) }()
+
+	if batchAction(operations) == maLock {
+		defer l.pool.lock()()
+	}
+
+	if _, err := conn.Write(buffer.Bytes()); err != nil {
+		return nil, err
+	}
+
+	replies := make([]wire.Response, len(operations))
+	for i, operation := range operations {
+		if replies[i], err = l.decode(conn, wire.Action(operation.action)); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+	}
+
+	reusable = true
+	return replies, nil
+}
+
+const resetKeysBatchSize = 256
+
+type KeyErrors map[string]error
+
+func (e KeyErrors) Error() string {
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	failures := make([]string, 0, len(keys))
+	for _, key := range keys {
+		failures = append(failures, fmt.Sprintf("%s: %s", key, e[key]))
+	}
+	return fmt.Sprintf("%d key(s) failed: %s", len(failures), strings.Join(failures, ", "))
+}
+
+// ResetKeys resets the keys in batches over a single connection each. The keys
+// failed to reset are reported in KeyErrors.
+func (l *lockingCenter) ResetKeys(keys []string) error {
+	failures := make(KeyErrors)
+
+	for begin := 0; begin < len(keys); begin += resetKeysBatchSize {
+		end := begin + resetKeysBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		operations := make([]BatchOperation, 0, end-begin)
+		for _, key := range keys[begin:end] {
+			operations = append(operations, BatchResetByKey(key))
+		}
+
+		results, err := l.Batch(context.Background(), operations...)
+		if err != nil {
+			return err
+		}
+
+		for i, err := range results {
+			if err != nil {
+				failures[keys[begin+i]] = err
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		return failures
+	}
+	return nil
+}
+
+// ResetByPrefix resets the locked keys starting with the prefix, the keys are
+// listed first so the ones locked afterwards are not reset.
+func (l *lockingCenter) ResetByPrefix(prefix string) error {
+	locks, err := l.ListLocks()
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(locks))
+	for _, lock := range locks {
+		if strings.HasPrefix(lock.Key, prefix) {
+			keys = append(keys, lock.Key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return l.ResetKeys(keys)
+}
+
+// batchAction is the lock when the answers of the operations may wait for
+// a grant
+func batchAction(operations []BatchOperation) mutexAction {
+	for _, operation := range operations {
+		if operation.action == maLock {
+			return maLock
+		}
+	}
+	return maUnlock
+}
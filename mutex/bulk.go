@@ -0,0 +1,282 @@
+package mutex
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"sync"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+const defaultBulkWindow = 128
+
+// BulkSession streams the operations over a single connection. Send returns
+// as soon as the operation is written while at most the window of operations
+// are waiting for their acknowledgements.
+type BulkSession interface {
+	Send(operation BatchOperation) error
+	// Close waits for the remaining acknowledgements and returns the results
+	// of the operations in the order they are sent.
+	Close() ([]error, error)
+}
+
+type bulkSession struct {
+	lc     *lockingCenter
+	ctx    context.Context
+	op     *operation
+	conn   net.Conn
+	writer *bufio.Writer
+	stop   func()
+	window chan struct{}
+	done   chan struct{}
+
+	mutex      sync.Mutex
+	operations []BatchOperation
+	results    []error
+	err        error
+	closed     bool
+}
+
+func (l *lockingCenter) Bulk(ctx context.Context, window int) (BulkSession, error) {
+	if window <= 0 {
+		window = defaultBulkWindow
+	}
+
+	op, err := l.begin(maLock, "")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &bulkSession{
+		lc:     l,
+		ctx:    ctx,
+		op:     op,
+		window: make(chan struct{}, window),
+		done:   make(chan struct{}),
+	}
+
+	if l.options.resolve().bypass {
+		close(s.done)
+		return s, nil
+	}
+
+	if !l.supports(wire.CapPipelining) {
+		l.end(op)
+		return nil, ErrNotSupported
+	}
+
+	conn, err := l.dial(ctx, maLock)
+	if err != nil {
+		l.end(op)
+		return nil, err
+	}
+
+	s.conn = conn
+	s.writer = bufio.NewWriter(conn)
+	s.stop = l.watch(ctx, conn)
+
+	go s.acknowledge()
+
+	return s, nil
+}
+
+func (s *bulkSession) Send(operation BatchOperation) error {
+	if err := s.lc.throttle(s.ctx); err != nil {
+		return err
+	}
+	if err := s.lc.unowned(operation); err != nil {
+		return err
+	}
+	if err := s.lc.claimBatched(&operation); err != nil {
+		return err
+	}
+
+	sent := false
+	defer func() {
+		if !sent {
+			s.lc.unclaim(operation.claimed)
+		}
+	}()
+
+	operation.key = s.lc.options.normalize(operation.key)
+	if operation.action == maLock && operation.sourceAddr == nil {
+		operation.sourceAddr = s.lc.sourceAddr
+	}
+
+	// the buffered frames should reach the server before waiting for a free
+	// slot, otherwise their acknowledgements never arrive
+	select {
+	case s.window <- struct{}{}:
+	default:
+		s.mutex.Lock()
+		err := s.flush()
+		s.mutex.Unlock()
+		if err != nil {
+			return err
+		}
+
+		select {
+		case s.window <- struct{}{}:
+		case <-s.done:
+			return s.failure()
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	if s.err != nil {
+		return s.err
+	}
+
+	if s.conn == nil {
+		s.operations = append(s.operations, operation)
+		s.results = append(s.results, nil)
+		<-s.window
+		sent = true
+		return nil
+	}
+
+	buffer := framePool.Get().(*bytes.Buffer)
+	defer func() {
+		buffer.Reset()
+		framePool.Put(buffer)
+	}()
+
+	if err := s.lc.preparePackage(buffer, operation.action, operation.key, operation.sourceAddr, 0, 0, s.lc.options.fairness, 0, ""); err != nil {
+		<-s.window
+		return err
+	}
+	if _, err := s.writer.Write(buffer.Bytes()); err != nil {
+		s.err = err
+		return err
+	}
+
+	s.operations = append(s.operations, operation)
+	s.results = append(s.results, nil)
+	sent = true
+
+	return nil
+}
+
+// flush should be called holding the mutex
+func (s *bulkSession) flush() error {
+	if s.writer == nil || s.err != nil {
+		return s.err
+	}
+	if err := s.writer.Flush(); err != nil {
+		s.err = err
+	}
+	return s.err
+}
+
+func (s *bulkSession) failure() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.ctx.Err() != nil {
+		return s.ctx.Err()
+	}
+	if s.err != nil {
+		return s.err
+	}
+	return ErrClosed
+}
+
+// acknowledge reads the replies of the sent operations in order and frees
+// their slots in the window.
+func (s *bulkSession) acknowledge() {
+	defer close(s.done)
+
+	for i := 0; ; i++ {
+		// the answers of the batched operations carry no payloads
+		reply, err := s.lc.decode(s.conn, wire.Lock)
+		if err != nil {
+			s.mutex.Lock()
+			if s.err == nil && !(s.closed && i == len(s.operations)) {
+				s.err = err
+			}
+			unanswered := s.operations[i:]
+			s.mutex.Unlock()
+
+			for _, operation := range unanswered {
+				s.lc.unclaim(operation.claimed)
+			}
+			return
+		}
+
+		s.mutex.Lock()
+		if i >= len(s.operations) {
+			if s.err == nil {
+				s.err = wire.ErrMalformed
+			}
+			s.mutex.Unlock()
+			return
+		}
+		operation := s.operations[i]
+		if !reply.Accepted {
+			s.results[i] = rejection(operation.action, reply)
+		}
+		s.mutex.Unlock()
+
+		if !reply.Accepted {
+			s.lc.unclaim(operation.claimed)
+		}
+
+		if reply.Accepted {
+			s.lc.track(operation.action, operation.key, operation.sourceAddr)
+		}
+
+		<-s.window
+	}
+}
+
+func (s *bulkSession) Close() ([]error, error) {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil, ErrClosed
+	}
+	s.closed = true
+	err := s.flush()
+	s.mutex.Unlock()
+
+	defer s.lc.end(s.op)
+
+	if s.conn == nil {
+		return s.results, nil
+	}
+
+	if err == nil {
+		// every slot of the window is taken back once all the operations are
+		// acknowledged
+	drain:
+		for i := 0; i < cap(s.window); i++ {
+			select {
+			case s.window <- struct{}{}:
+			case <-s.done:
+				break drain
+			}
+		}
+	}
+
+	s.stop()
+	s.lc.hangUp(s.conn)
+	<-s.done
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.err != nil {
+		if s.ctx.Err() != nil {
+			return nil, s.ctx.Err()
+		}
+		return nil, s.err
+	}
+	return s.results, nil
+}
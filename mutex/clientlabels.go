@@ -0,0 +1,42 @@
+package mutex
+
+import "github.com/freakmaxi/locking-center-client-go/wire"
+
+// WithClientLabels sends the labels, like the service name, the version and
+// the instance id, with the lock requests, so the server can tell who holds a
+// lock beyond its source address and ListLocks reports them. The labels are
+// only sent to the servers agreeing on them by the negotiation.
+func WithClientLabels(labels map[string]string) Option {
+	return func(o *options) {
+		if o.clientLabels == nil {
+			o.clientLabels = make(map[string]string, len(labels))
+		}
+		for name, value := range labels {
+			o.clientLabels[name] = value
+		}
+	}
+}
+
+// lockLabels are the labels of the client sent with the lock, along with the
+// reason of the acquisition
+func (o options) lockLabels(action mutexAction, reason string) map[string]string {
+	if action != maLock {
+		return nil
+	}
+	if len(reason) == 0 {
+		return o.clientLabels
+	}
+
+	labels := make(map[string]string, len(o.clientLabels)+1)
+	for name, value := range o.clientLabels {
+		labels[name] = value
+	}
+	labels[wire.ReasonLabel] = reason
+
+	return labels
+}
+
+// sendsLabels reports if the server has agreed on receiving the labels
+func (l *lockingCenter) sendsLabels() bool {
+	return l.agrees(wire.CapLabels)
+}
@@ -0,0 +1,98 @@
+package mutex
+
+import "time"
+
+// Clock is the time of the client. The retry sleeps, the timers, the tickers
+// and the hold durations of the client and of the primitives are taken from
+// it, so they can be driven by a fake clock in the tests. The deadlines of the
+// connections and of the contexts are always on the real time.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// SystemClock is the clock of the time package. Its times carry the monotonic
+// reading, so the durations are not affected by the jumps of the wall clock.
+var SystemClock Clock = systemClock{}
+
+// WithClock sets the clock of the client in place of SystemClock
+func WithClock(clock Clock) Option {
+	return func(o *options) {
+		if clock != nil {
+			o.clock = clock
+		}
+	}
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{timer: time.NewTimer(d)}
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{ticker: time.NewTicker(d)}
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return systemTimer{timer: time.AfterFunc(d, f)}
+}
+
+type systemTimer struct {
+	timer *time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t systemTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+func (t systemTimer) Reset(d time.Duration) bool {
+	return t.timer.Reset(d)
+}
+
+type systemTicker struct {
+	ticker *time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t systemTicker) Stop() {
+	t.ticker.Stop()
+}
+
+func (l *lockingCenter) Clock() Clock {
+	return l.options.clock
+}
+
+// since is time.Since on the clock
+func since(clock Clock, t time.Time) time.Duration {
+	return clock.Now().Sub(t)
+}
+
+// after is time.After on the clock
+func after(clock Clock, d time.Duration) <-chan time.Time {
+	return clock.NewTimer(d).C()
+}
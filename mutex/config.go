@@ -0,0 +1,47 @@
+package mutex
+
+import (
+	"time"
+)
+
+type DynamicConfig struct {
+	RetryInterval time.Duration
+	DialTimeout   time.Duration
+	Bypass        bool
+}
+
+type ConfigProvider interface {
+	Config() DynamicConfig
+}
+
+type ConfigProviderFunc func() DynamicConfig
+
+func (f ConfigProviderFunc) Config() DynamicConfig {
+	return f()
+}
+
+func WithConfigProvider(p ConfigProvider) Option {
+	return func(o *options) {
+		o.configProvider = p
+	}
+}
+
+func (o options) resolve() options {
+	if o.dryRun != nil {
+		o.bypass = true
+	}
+	if o.configProvider == nil {
+		return o
+	}
+
+	c := o.configProvider.Config()
+	if c.RetryInterval > 0 {
+		o.retryInterval = c.RetryInterval
+	}
+	if c.DialTimeout > 0 {
+		o.dialTimeout = c.DialTimeout
+	}
+	o.bypass = o.bypass || c.Bypass
+
+	return o
+}
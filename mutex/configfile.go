@@ -0,0 +1,166 @@
+package mutex
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// Duration is a time.Duration read from and written as the time.ParseDuration
+// format, like "2s", in the configuration files.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+type PoolSettings struct {
+	MaxActive         int      `json:"maxActive,omitempty" yaml:"maxActive,omitempty"`
+	MaxIdle           int      `json:"maxIdle,omitempty" yaml:"maxIdle,omitempty"`
+	IdleTimeout       Duration `json:"idleTimeout,omitempty" yaml:"idleTimeout,omitempty"`
+	Wait              bool     `json:"wait,omitempty" yaml:"wait,omitempty"`
+	HeartbeatInterval Duration `json:"heartbeatInterval,omitempty" yaml:"heartbeatInterval,omitempty"`
+}
+
+type ObservabilitySettings struct {
+	SlowHoldThreshold Duration `json:"slowHoldThreshold,omitempty" yaml:"slowHoldThreshold,omitempty"`
+	LeakThreshold     Duration `json:"leakThreshold,omitempty" yaml:"leakThreshold,omitempty"`
+	RequestIDs        bool     `json:"requestIds,omitempty" yaml:"requestIds,omitempty"`
+}
+
+// Config is the declarative configuration of the client. The first address is
+// the one of the client, the rest are its fallbacks.
+type Config struct {
+	Addresses        []string `json:"addresses" yaml:"addresses"`
+	SourceAddr       string   `json:"sourceAddr,omitempty" yaml:"sourceAddr,omitempty"`
+	Session          string   `json:"session,omitempty" yaml:"session,omitempty"`
+	Namespace        string   `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	DialTimeout      Duration `json:"dialTimeout,omitempty" yaml:"dialTimeout,omitempty"`
+	KeepAlive        Duration `json:"keepAlive,omitempty" yaml:"keepAlive,omitempty"`
+	RetryInterval    Duration `json:"retryInterval,omitempty" yaml:"retryInterval,omitempty"`
+	RetryMaxInterval Duration `json:"retryMaxInterval,omitempty" yaml:"retryMaxInterval,omitempty"`
+	RateLimit        float64  `json:"rateLimit,omitempty" yaml:"rateLimit,omitempty"`
+	RateBurst        int      `json:"rateBurst,omitempty" yaml:"rateBurst,omitempty"`
+	Negotiate        bool     `json:"negotiate,omitempty" yaml:"negotiate,omitempty"`
+
+	Pool          *PoolSettings          `json:"pool,omitempty" yaml:"pool,omitempty"`
+	TLS           *TLSFiles              `json:"tls,omitempty" yaml:"tls,omitempty"`
+	Observability *ObservabilitySettings `json:"observability,omitempty" yaml:"observability,omitempty"`
+}
+
+// LoadConfig reads the json configuration file, the yaml files can be decoded
+// into the Config by a yaml package.
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid config file %s: %s", path, err)
+	}
+	return cfg, nil
+}
+
+// NewFromConfig creates the client from the configuration, the options given
+// override it.
+func NewFromConfig(cfg Config, opts ...Option) (LockingCenter, error) {
+	if len(cfg.Addresses) == 0 {
+		return nil, errors.New("config has no address")
+	}
+
+	cfgOpts, err := cfg.options()
+	if err != nil {
+		return nil, err
+	}
+
+	var sourceAddr *string
+	if len(cfg.SourceAddr) > 0 {
+		sourceAddr = &cfg.SourceAddr
+	}
+
+	return NewLockingCenterWithSourceAddr(cfg.Addresses[0], sourceAddr, append(cfgOpts, opts...)...)
+}
+
+func (cfg Config) options() ([]Option, error) {
+	var opts []Option
+
+	if len(cfg.Addresses) > 1 {
+		opts = append(opts, WithFallbackAddresses(cfg.Addresses[1:]...))
+	}
+	if len(cfg.Session) > 0 {
+		opts = append(opts, WithSession(cfg.Session))
+	}
+	if len(cfg.Namespace) > 0 {
+		opts = append(opts, WithNamespace(cfg.Namespace))
+	}
+	if cfg.DialTimeout > 0 {
+		opts = append(opts, WithDialTimeout(time.Duration(cfg.DialTimeout)))
+	}
+	if cfg.KeepAlive != 0 {
+		opts = append(opts, WithKeepAlive(time.Duration(cfg.KeepAlive)))
+	}
+	if cfg.RetryInterval > 0 {
+		opts = append(opts, WithRetryInterval(time.Duration(cfg.RetryInterval)))
+	}
+	if cfg.RetryMaxInterval > 0 {
+		retryInterval := time.Duration(cfg.RetryInterval)
+		if retryInterval <= 0 {
+			retryInterval = defaultRetryInterval
+		}
+		if time.Duration(cfg.RetryMaxInterval) < retryInterval {
+			return nil, errors.New("max retry interval can not be less than the retry interval")
+		}
+		opts = append(opts, WithAdaptiveRetry(retryInterval, time.Duration(cfg.RetryMaxInterval)))
+	}
+	if cfg.RateLimit > 0 {
+		opts = append(opts, WithRateLimit(cfg.RateLimit, cfg.RateBurst))
+	}
+	if cfg.Negotiate {
+		opts = append(opts, WithNegotiation())
+	}
+
+	if cfg.Pool != nil {
+		opts = append(opts, WithPool(PoolConfig{
+			MaxActive:         cfg.Pool.MaxActive,
+			MaxIdle:           cfg.Pool.MaxIdle,
+			IdleTimeout:       time.Duration(cfg.Pool.IdleTimeout),
+			Wait:              cfg.Pool.Wait,
+			HeartbeatInterval: time.Duration(cfg.Pool.HeartbeatInterval),
+		}))
+	}
+
+	if cfg.TLS != nil {
+		config, err := cfg.TLS.Load()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithTLS(config))
+	}
+
+	if o := cfg.Observability; o != nil {
+		if o.SlowHoldThreshold > 0 {
+			opts = append(opts, WithSlowHoldThreshold(time.Duration(o.SlowHoldThreshold), nil))
+		}
+		if o.LeakThreshold > 0 {
+			opts = append(opts, WithLeakDetection(time.Duration(o.LeakThreshold), nil))
+		}
+		if o.RequestIDs {
+			opts = append(opts, WithRequestIDs())
+		}
+	}
+
+	return opts, nil
+}
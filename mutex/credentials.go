@@ -0,0 +1,161 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+// credentialsRefreshMargin is the time before the expiry of the credentials
+// when they are refreshed for the new connections
+const credentialsRefreshMargin = time.Second * 30
+
+var ErrUnauthenticated = errors.New("credentials are rejected by the server")
+
+// Credentials are the token of the client and its expiry, the zero expiry
+// never expires.
+type Credentials struct {
+	Token  string
+	Expiry time.Time
+}
+
+// CredentialsProvider returns the current credentials of the client, like the
+// short-lived tokens of Vault or the cloud IAM.
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+type CredentialsFunc func(ctx context.Context) (Credentials, error)
+
+func (f CredentialsFunc) Credentials(ctx context.Context) (Credentials, error) {
+	return f(ctx)
+}
+
+// StaticCredentials provides the token which never expires
+func StaticCredentials(token string) CredentialsProvider {
+	return CredentialsFunc(func(ctx context.Context) (Credentials, error) {
+		return Credentials{Token: token}, nil
+	})
+}
+
+// WithCredentials authenticates every connection by the token of the provider
+// before its first frame. The credentials are kept until they are about to
+// expire, the pooled connections authenticated by the expired ones are not
+// reused, and a rejected token is refreshed and tried once more before the
+// connection fails with ErrUnauthenticated.
+func WithCredentials(provider CredentialsProvider) Option {
+	return func(o *options) {
+		o.credentials = provider
+	}
+}
+
+// credentialsCache keeps the credentials of the provider until their refresh
+type credentialsCache struct {
+	provider CredentialsProvider
+	clock    Clock
+
+	mutex   sync.Mutex
+	current *Credentials
+}
+
+func newCredentialsCache(o options) *credentialsCache {
+	if o.credentials == nil {
+		return nil
+	}
+	return &credentialsCache{provider: o.credentials, clock: o.clock}
+}
+
+// get returns the kept credentials, or the new ones of the provider when they
+// are about to expire or rejected by the server
+func (c *credentialsCache) get(timeout time.Duration, rejected bool) (Credentials, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.current != nil && !rejected && (c.current.Expiry.IsZero() || c.clock.Now().Add(credentialsRefreshMargin).Before(c.current.Expiry)) {
+		return *c.current, nil
+	}
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	credentials, err := c.provider.Credentials(ctx)
+	if err != nil {
+		return Credentials{}, err
+	}
+	c.current = &credentials
+
+	return credentials, nil
+}
+
+// authConn is a connection authenticated by the credentials until their expiry
+type authConn struct {
+	net.Conn
+	expiry time.Time
+}
+
+// authenticate sends the auth frame on the new connection, which is closed
+// when it fails. The credentials are refreshed first when the previous ones
+// are rejected.
+func (l *lockingCenter) authenticate(conn net.Conn, rejected bool) (net.Conn, error) {
+	timeout := l.options.resolve().dialTimeout
+	if timeout <= 0 {
+		timeout = helloTimeout
+	}
+
+	credentials, err := l.credentials.get(timeout, rejected)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	accepted, err := l.auth(conn, credentials.Token, timeout)
+	if err == nil && !accepted {
+		err = ErrUnauthenticated
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return &authConn{Conn: conn, expiry: credentials.Expiry}, nil
+}
+
+func (l *lockingCenter) auth(conn net.Conn, token string, timeout time.Duration) (bool, error) {
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return false, err
+	}
+
+	frame, err := wire.Encode(wire.Request{Action: wire.Auth, Payload: []byte(token)})
+	if err != nil {
+		return false, err
+	}
+	if _, err := conn.Write(frame); err != nil {
+		return false, err
+	}
+
+	resp, err := wire.Decode(conn, wire.Auth)
+	if err != nil {
+		return false, err
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return false, err
+	}
+	return resp.Accepted, nil
+}
+
+// expired reports if the credentials of the connection have expired, so it
+// can not be reused
+func (l *lockingCenter) expired(conn net.Conn) bool {
+	if d, detailed := conn.(*detailedConn); detailed {
+		conn = d.Conn
+	}
+	c, ok := conn.(*authConn)
+	return ok && !c.expiry.IsZero() && !l.options.clock.Now().Before(c.expiry)
+}
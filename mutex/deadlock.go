@@ -0,0 +1,80 @@
+package mutex
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+type DeadlockError struct {
+	Cycle []string
+}
+
+func (e *DeadlockError) Error() string {
+	return fmt.Sprintf("probable deadlock detected on keys: %s", strings.Join(e.Cycle, " -> "))
+}
+
+// WithDeadlockDetection keeps a wait-for graph of the goroutines and the keys
+// in the process, and fails the lock requests that would close a cycle with
+// DeadlockError instead of hanging forever
+func WithDeadlockDetection() Option {
+	return func(o *options) {
+		o.detectDeadlocks = true
+	}
+}
+
+func goroutineID() int64 {
+	b := make([]byte, 64)
+	b = b[:runtime.Stack(b, false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+
+	id, _ := strconv.ParseInt(string(b), 10, 64)
+	return id
+}
+
+// enqueue records that the goroutine is waiting for the key, unless the wait
+// closes a cycle of the goroutines waiting for the keys held by each other
+func (l *lockingCenter) enqueue(goroutine int64, key string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	cycle := []string{key}
+	visited := map[int64]bool{}
+
+	for next := key; ; {
+		h, has := l.held[next]
+		if !has || h.goroutine == 0 {
+			break
+		}
+		if h.goroutine == goroutine {
+			return &DeadlockError{Cycle: cycle}
+		}
+		if visited[h.goroutine] {
+			break
+		}
+		visited[h.goroutine] = true
+
+		waiting, has := l.waiting[h.goroutine]
+		if !has {
+			break
+		}
+		cycle = append(cycle, waiting)
+		next = waiting
+	}
+
+	l.waiting[goroutine] = key
+
+	return nil
+}
+
+func (l *lockingCenter) dequeue(goroutine int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	delete(l.waiting, goroutine)
+}
@@ -0,0 +1,145 @@
+package mutex
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+type DebugEventKind int
+
+const (
+	// DebugOperation is a completed operation or query with its duration
+	DebugOperation DebugEventKind = iota + 1
+	// DebugRetry is a failed attempt of an operation with the delay before
+	// the next one
+	DebugRetry
+	// DebugConnect is a new connection to the server, or the failure of it
+	DebugConnect
+	// DebugWarning is a warning written to the logger
+	DebugWarning
+)
+
+func (k DebugEventKind) String() string {
+	switch k {
+	case DebugOperation:
+		return "operation"
+	case DebugRetry:
+		return "retry"
+	case DebugConnect:
+		return "connect"
+	case DebugWarning:
+		return "warning"
+	}
+	return "unknown"
+}
+
+// DebugEvent is an event of the client kept by WithDebugEvents. The fields not
+// related to the kind of the event are empty.
+type DebugEvent struct {
+	At       time.Time
+	Kind     DebugEventKind
+	Action   wire.Action
+	Key      string
+	Address  string
+	Attempt  int
+	Duration time.Duration
+	Err      error
+	Message  string
+}
+
+func (e DebugEvent) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s", e.At.Format(time.RFC3339Nano), e.Kind)
+	if e.Action != 0 {
+		fmt.Fprintf(&b, " %s", e.Action)
+	}
+	if len(e.Key) > 0 {
+		fmt.Fprintf(&b, " key=%s", e.Key)
+	}
+	if len(e.Address) > 0 {
+		fmt.Fprintf(&b, " address=%s", e.Address)
+	}
+	if e.Attempt > 0 {
+		fmt.Fprintf(&b, " attempt=%d", e.Attempt)
+	}
+	if e.Duration > 0 {
+		fmt.Fprintf(&b, " duration=%s", e.Duration)
+	}
+	if e.Err != nil {
+		fmt.Fprintf(&b, " error=%q", e.Err)
+	}
+	if len(e.Message) > 0 {
+		fmt.Fprintf(&b, " %s", e.Message)
+	}
+	return b.String()
+}
+
+// WithDebugEvents keeps the last n events of the client, the operations, the
+// retries, the connections and the warnings, returned by DebugEvents so the
+// recent history can be attached to a bug report.
+func WithDebugEvents(n int) Option {
+	return func(o *options) {
+		o.debugEvents = n
+	}
+}
+
+// eventRing keeps the last events, overwriting the oldest one when it is full
+type eventRing struct {
+	mutex  sync.Mutex
+	events []DebugEvent
+	next   int
+	full   bool
+}
+
+func newEventRing(size int) *eventRing {
+	if size <= 0 {
+		return nil
+	}
+	return &eventRing{events: make([]DebugEvent, size)}
+}
+
+func (r *eventRing) add(e DebugEvent) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.events[r.next] = e
+	r.next++
+	if r.next == len(r.events) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+func (r *eventRing) snapshot() []DebugEvent {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.full {
+		return append([]DebugEvent(nil), r.events[:r.next]...)
+	}
+
+	events := make([]DebugEvent, 0, len(r.events))
+	events = append(events, r.events[r.next:]...)
+	return append(events, r.events[:r.next]...)
+}
+
+// DebugEvents returns the kept events from the oldest one, nil without
+// WithDebugEvents
+func (l *lockingCenter) DebugEvents() []DebugEvent {
+	if l.events == nil {
+		return nil
+	}
+	return l.events.snapshot()
+}
+
+func (l *lockingCenter) debug(e DebugEvent) {
+	if l.events == nil {
+		return
+	}
+	e.At = l.options.clock.Now()
+	l.events.add(e)
+}
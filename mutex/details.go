@@ -0,0 +1,87 @@
+package mutex
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+// ServerError is a rejection detailed by the server, it matches
+// ErrPermissionDenied for the denials and ErrServerRejected otherwise.
+type ServerError struct {
+	Action wire.Action
+	Code   wire.Code
+	Reason string
+	Denied bool
+}
+
+func (e *ServerError) Error() string {
+	if len(e.Reason) == 0 {
+		return fmt.Sprintf("%s is rejected by the server: %s", e.Action, e.Code)
+	}
+	return fmt.Sprintf("%s is rejected by the server: %s: %s", e.Action, e.Code, e.Reason)
+}
+
+func (e *ServerError) Unwrap() error {
+	if e.Denied {
+		return ErrPermissionDenied
+	}
+	return ErrServerRejected
+}
+
+// WithErrorDetails sends the hello frame on every new connection when the
+// server has agreed on the detailed rejections by WithNegotiation, so their
+// code and reason are returned in a *ServerError.
+func WithErrorDetails() Option {
+	return func(o *options) {
+		o.errorDetails = true
+	}
+}
+
+// detailedConn is a connection getting the detailed rejections
+type detailedConn struct {
+	net.Conn
+}
+
+// detail agrees on the detailed rejections on the new connection, which is
+// closed when it fails. The v2 frames carry them without the hello frame.
+func (l *lockingCenter) detail(conn net.Conn) (net.Conn, error) {
+	if !l.options.errorDetails || !l.agrees(wire.CapErrorDetails) || l.framesV2() {
+		return conn, nil
+	}
+
+	hello, err := l.hello(conn)
+	if err == nil {
+		err = conn.SetDeadline(time.Time{})
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if hello == nil || !hello.Has(wire.CapErrorDetails) {
+		return conn, nil
+	}
+	return &detailedConn{Conn: conn}, nil
+}
+
+// decode reads the response of the action, detailed when the connection has
+// agreed on it
+func decode(conn net.Conn, action wire.Action) (wire.Response, error) {
+	if _, detailed := conn.(*detailedConn); detailed {
+		return wire.DecodeDetailed(conn, action)
+	}
+	return wire.Decode(conn, action)
+}
+
+// rejection is the error of the rejected response of the action
+func rejection(action mutexAction, resp wire.Response) error {
+	if resp.Code != wire.CodeUnspecified || len(resp.Reason) > 0 {
+		return &ServerError{Action: wire.Action(action), Code: resp.Code, Reason: resp.Reason, Denied: resp.Denied}
+	}
+	if resp.Denied {
+		return ErrPermissionDenied
+	}
+	return ErrServerRejected
+}
@@ -0,0 +1,109 @@
+package mutex
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Driver opens the clients of a backend, it is registered for the scheme of
+// the uris it accepts.
+type Driver interface {
+	Open(uri *url.URL, opts ...Option) (LockingCenter, error)
+}
+
+// DriverFunc is the Driver of a function
+type DriverFunc func(uri *url.URL, opts ...Option) (LockingCenter, error)
+
+func (f DriverFunc) Open(uri *url.URL, opts ...Option) (LockingCenter, error) {
+	return f(uri, opts...)
+}
+
+var (
+	driversMutex sync.RWMutex
+	drivers      = map[string]Driver{
+		"tcp":         DriverFunc(openTCP),
+		"tls":         DriverFunc(openTCP),
+		uriScheme:     DriverFunc(openURI),
+		unixURIScheme: DriverFunc(openURI),
+	}
+)
+
+// Register makes the driver available for the scheme, it panics when the
+// driver is nil or the scheme is already registered.
+func Register(scheme string, driver Driver) {
+	driversMutex.Lock()
+	defer driversMutex.Unlock()
+
+	if driver == nil {
+		panic("mutex: register driver is nil")
+	}
+	if _, has := drivers[scheme]; has {
+		panic(fmt.Sprintf("mutex: register called twice for driver %s", scheme))
+	}
+	drivers[scheme] = driver
+}
+
+// Drivers returns the sorted schemes of the registered drivers.
+func Drivers() []string {
+	driversMutex.RLock()
+	defer driversMutex.RUnlock()
+
+	schemes := make([]string, 0, len(drivers))
+	for scheme := range drivers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+
+	return schemes
+}
+
+// Open creates the client with the driver of the uri scheme, the address
+// without a scheme is opened by the tcp driver.
+func Open(uri string, opts ...Option) (LockingCenter, error) {
+	if !strings.Contains(uri, "://") {
+		return NewLockingCenter(uri, opts...)
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	driversMutex.RLock()
+	driver, has := drivers[u.Scheme]
+	driversMutex.RUnlock()
+
+	if !has {
+		return nil, fmt.Errorf("unknown driver %s (forgotten import?)", u.Scheme)
+	}
+	return driver.Open(u, opts...)
+}
+
+// openTCP connects to the host of the uri, the source query parameter is the
+// source address and the tls scheme encrypts the connections
+func openTCP(uri *url.URL, opts ...Option) (LockingCenter, error) {
+	if len(uri.Host) == 0 {
+		return nil, fmt.Errorf("%s uri requires the host", uri.Scheme)
+	}
+
+	if uri.Scheme == "tls" {
+		opts = append([]Option{WithTLS(&tls.Config{})}, opts...)
+	}
+
+	var sourceAddr *string
+	if query := uri.Query(); len(query["source"]) > 0 {
+		s := query.Get("source")
+		sourceAddr = &s
+	}
+
+	return NewLockingCenterWithSourceAddr(uri.Host, sourceAddr, opts...)
+}
+
+// openURI creates the client of the connection string
+func openURI(uri *url.URL, opts ...Option) (LockingCenter, error) {
+	return NewLockingCenter(uri.String(), opts...)
+}
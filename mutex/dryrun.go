@@ -0,0 +1,68 @@
+package mutex
+
+import (
+	"fmt"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+// DryRun decides the canned results of the operations of a dry run client.
+// Err returns the failure of an operation and Locked answers IsLocked, the
+// operations succeed and the keys are free when they are nil.
+type DryRun struct {
+	Err    func(action wire.Action, key string) error
+	Locked func(key string) bool
+}
+
+// WithDryRun validates the keys of every operation and logs it without
+// contacting the server, the operations return the canned results of the dry
+// run instead. The client is created without connecting to the server, so it
+// suits the shadow deployments and checking the keys locked by a code path
+// without risking a real contention.
+func WithDryRun(dryRun DryRun) Option {
+	return func(o *options) {
+		o.dryRun = &dryRun
+	}
+}
+
+// dryRun is the result of the operation of the dry run, nil when the client is
+// bypassed by its config
+func (l *lockingCenter) dryRun(action mutexAction, key string) error {
+	d := l.options.dryRun
+	if d == nil {
+		return nil
+	}
+
+	operation := wire.Action(action).String()
+	if action.hasKey() {
+		operation = fmt.Sprintf("%s %s", operation, key)
+
+		encoded := key
+		if len(encoded) > 0 {
+			encoded = l.options.encodeKey(key)
+		}
+		if err := ValidateKey(encoded); err != nil {
+			l.options.logger.Printf("DRY-RUN: %s: %s\n", operation, err)
+			return err
+		}
+	}
+	l.options.logger.Printf("DRY-RUN: %s\n", operation)
+
+	if d.Err == nil {
+		return nil
+	}
+	return d.Err(wire.Action(action), key)
+}
+
+// dryInquiry is the canned answer of the query
+func (l *lockingCenter) dryInquiry(action mutexAction, key string) ([]byte, error) {
+	if err := l.dryRun(action, key); err != nil {
+		return nil, err
+	}
+
+	d := l.options.dryRun
+	if d != nil && d.Locked != nil && action == maStatus && d.Locked(key) {
+		return []byte{1}, nil
+	}
+	return nil, nil
+}
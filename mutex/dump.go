@@ -0,0 +1,92 @@
+package mutex
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// ClientState is the snapshot of what the client believes it holds, written
+// as json by DumpState for the crash reports and the debug endpoints.
+type ClientState struct {
+	Address    string `json:"address"`
+	SourceAddr string `json:"sourceAddr,omitempty"`
+	Closed     bool   `json:"closed"`
+	// Session is the id of WithSession, SessionRegistered reports if it is
+	// kept alive on the server by its connection
+	Session           string `json:"session,omitempty"`
+	SessionRegistered bool   `json:"sessionRegistered,omitempty"`
+
+	Held []HeldState `json:"held"`
+	// PassedKeys are the remote locks kept by the local hand off for the next
+	// goroutine waiting for them
+	PassedKeys []string `json:"passedKeys,omitempty"`
+	// Pending are the keys of the operations in flight
+	Pending []string `json:"pending,omitempty"`
+}
+
+// HeldState is a lock in the snapshot of the client. Owned is the lock of
+// LockOwned, the token itself is never dumped. Bounded is the lock of LockFor
+// whose release timers are running.
+type HeldState struct {
+	Key        string    `json:"key"`
+	AcquiredAt time.Time `json:"acquiredAt"`
+	HeldFor    int64     `json:"heldForMs"`
+	MaxHold    int64     `json:"maxHoldMs,omitempty"`
+	Owned      bool      `json:"owned,omitempty"`
+	Bounded    bool      `json:"bounded,omitempty"`
+	Overdue    bool      `json:"overdue,omitempty"`
+	Leaked     bool      `json:"leaked,omitempty"`
+	Releasing  bool      `json:"releasing,omitempty"`
+	Goroutine  int64     `json:"goroutine,omitempty"`
+	Stack      string    `json:"stack,omitempty"`
+}
+
+// DumpState writes the snapshot of the client as json, it does not reach the
+// server.
+func (l *lockingCenter) DumpState() ([]byte, error) {
+	l.mutex.Lock()
+
+	state := ClientState{
+		Address:           l.address,
+		Closed:            l.closed,
+		Session:           l.options.session,
+		SessionRegistered: l.session != nil,
+		Held:              make([]HeldState, 0, len(l.held)),
+	}
+	if l.sourceAddr != nil {
+		state.SourceAddr = *l.sourceAddr
+	}
+	for key, h := range l.held {
+		lock := l.heldLock(key, h)
+		state.Held = append(state.Held, HeldState{
+			Key:        key,
+			AcquiredAt: lock.AcquiredAt,
+			HeldFor:    int64(lock.HeldFor() / time.Millisecond),
+			MaxHold:    int64(lock.MaxHold / time.Millisecond),
+			Owned:      len(h.token) > 0,
+			Bounded:    len(h.timers) > 0,
+			Overdue:    lock.Overdue(),
+			Leaked:     h.leaked,
+			Releasing:  h.releasing,
+			Goroutine:  h.goroutine,
+			Stack:      lock.Stack,
+		})
+	}
+	for key, g := range l.gates {
+		if g.remote {
+			state.PassedKeys = append(state.PassedKeys, key)
+		}
+	}
+	for op := range l.pending {
+		state.Pending = append(state.Pending, op.key)
+	}
+
+	l.mutex.Unlock()
+
+	sort.Slice(state.Held, func(i, j int) bool { return state.Held[i].Key < state.Held[j].Key })
+	sort.Strings(state.PassedKeys)
+	sort.Strings(state.Pending)
+
+	return json.MarshalIndent(state, "", "  ")
+}
@@ -0,0 +1,177 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const electionCheckInterval = time.Second
+
+type Election struct {
+	lc  LockingCenter
+	key string
+	// heldKey is the key among HeldLocks, normalized like the client keeps it
+	heldKey string
+
+	mutex      sync.Mutex
+	leader     bool
+	leadership chan bool
+	cancel     context.CancelFunc
+	done       chan struct{}
+	resignErr  error
+}
+
+func NewElection(lc LockingCenter, key string) *Election {
+	heldKey := key
+	if l, ok := lc.(*lockingCenter); ok {
+		heldKey = l.options.normalize(key)
+	}
+
+	return &Election{
+		lc:         lc,
+		key:        key,
+		heldKey:    heldKey,
+		leadership: make(chan bool, 1),
+	}
+}
+
+func (e *Election) Campaign() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	e.done = make(chan struct{})
+
+	go e.run(ctx, e.done)
+}
+
+func (e *Election) Resign() error {
+	e.mutex.Lock()
+	cancel, done := e.cancel, e.done
+	e.mutex.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	<-done
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// the campaign is only forgotten once it has stopped, so another one can
+	// not run along with it
+	if e.done == done {
+		e.cancel = nil
+	}
+	return e.resignErr
+}
+
+func (e *Election) IsLeader() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.leader
+}
+
+func (e *Election) Leadership() <-chan bool {
+	return e.leadership
+}
+
+func (e *Election) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	for {
+		if err := e.lc.LockContext(ctx, e.key); err != nil {
+			if ctx.Err() != nil || errors.Is(err, ErrClosed) {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-after(e.lc.Clock(), electionCheckInterval):
+			}
+			continue
+		}
+
+		e.set(true)
+
+		if !e.hold(ctx) {
+			err := e.lc.Unlock(e.key)
+
+			e.mutex.Lock()
+			e.resignErr = err
+			e.mutex.Unlock()
+
+			e.set(false)
+			return
+		}
+
+		// leadership is lost, campaign again
+		e.set(false)
+	}
+}
+
+func (e *Election) hold(ctx context.Context) bool {
+	ticker := e.lc.Clock().NewTicker(electionCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C():
+			if !e.held() {
+				return true
+			}
+		}
+	}
+}
+
+// held reports if the leader still holds the key, the server is asked as well
+// so the leadership is also lost when the key is reset or expired on it
+func (e *Election) held() bool {
+	local := false
+	for _, lock := range e.lc.HeldLocks() {
+		if lock.Key == e.heldKey {
+			local = true
+			break
+		}
+	}
+	if !local {
+		return false
+	}
+
+	locked, err := e.lc.IsLocked(e.key)
+	if err != nil {
+		// the local check stands when the server can not tell, like without
+		// the status support
+		return true
+	}
+	return locked
+}
+
+func (e *Election) set(leader bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.leader == leader {
+		return
+	}
+	e.leader = leader
+
+	select {
+	case <-e.leadership:
+	default:
+	}
+	e.leadership <- leader
+}
@@ -0,0 +1,195 @@
+package mutex
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// endpointLatencyWeight is the weight of a new dial duration in the
+	// average latency of the endpoint
+	endpointLatencyWeight = 0.3
+	// slowEndpointFactor demotes the endpoints slower than the fastest one by
+	// the factor, the ones under minSlowEndpointLatency are never slow
+	slowEndpointFactor     = 3
+	minSlowEndpointLatency = time.Millisecond * 5
+	// endpointRecheckInterval is the time after which a demoted endpoint is
+	// tried again in its place
+	endpointRecheckInterval = time.Second * 30
+)
+
+// Endpoint is an address of the server with its weight among the endpoints of
+// the same preference and its zone.
+type Endpoint struct {
+	Address string
+	Weight  int
+	Zone    string
+}
+
+// WithEndpoints connects to the endpoints, along with the address of the
+// client and the fallback addresses of the weight 1 without a zone. Every
+// connection is opened to an endpoint picked by its weight, the endpoints of
+// the local zone first. The endpoints dialing slower than the fastest one, or
+// failing, are demoted behind the others until they are tried again after a
+// while.
+func WithEndpoints(endpoints ...Endpoint) Option {
+	return func(o *options) {
+		o.endpoints = append(o.endpoints, endpoints...)
+	}
+}
+
+// WithLocalZone prefers the endpoints of the zone to the others
+func WithLocalZone(zone string) Option {
+	return func(o *options) {
+		o.localZone = zone
+	}
+}
+
+type endpointState struct {
+	Endpoint
+	host string
+
+	latency  time.Duration
+	down     bool
+	measured time.Time
+}
+
+// endpointSet orders the endpoints of a client for the next connection
+type endpointSet struct {
+	localZone string
+	clock     Clock
+
+	mutex  sync.Mutex
+	states []*endpointState
+}
+
+func newEndpointSet(address string, o options) (*endpointSet, error) {
+	all := append([]Endpoint(nil), o.endpoints...)
+	all = append(all, Endpoint{Address: address})
+	for _, fallback := range o.fallbacks {
+		all = append(all, Endpoint{Address: fallback})
+	}
+
+	s := &endpointSet{localZone: o.localZone, clock: o.clock}
+	seen := make(map[string]bool, len(all))
+	for _, e := range all {
+		if seen[e.Address] {
+			continue
+		}
+		seen[e.Address] = true
+
+		host, _, err := net.SplitHostPort(e.Address)
+		if err != nil {
+			return nil, err
+		}
+		if e.Weight < 1 {
+			e.Weight = 1
+		}
+		s.states = append(s.states, &endpointState{Endpoint: e, host: host})
+	}
+	return s, nil
+}
+
+// order returns the endpoints to try, the healthy ones of the local zone, the
+// healthy others, then the slow and the failed ones, each group shuffled by
+// the weights
+func (s *endpointSet) order(random func() float64) []*endpointState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.clock.Now()
+
+	var best time.Duration
+	for _, e := range s.states {
+		if s.fresh(e, now) && !e.down && e.latency > 0 && (best == 0 || e.latency < best) {
+			best = e.latency
+		}
+	}
+
+	groups := make([][]*endpointState, 4)
+	for _, e := range s.states {
+		group := 1
+		switch {
+		case s.fresh(e, now) && e.down:
+			group = 3
+		case s.fresh(e, now) && e.latency > minSlowEndpointLatency && e.latency > best*slowEndpointFactor:
+			group = 2
+		case len(s.localZone) > 0 && e.Zone == s.localZone:
+			group = 0
+		}
+		groups[group] = append(groups[group], e)
+	}
+
+	ordered := make([]*endpointState, 0, len(s.states))
+	for _, group := range groups {
+		ordered = append(ordered, shuffleByWeight(group, random)...)
+	}
+	return ordered
+}
+
+// fresh reports if the last measurement of the endpoint can still demote it
+func (s *endpointSet) fresh(e *endpointState, now time.Time) bool {
+	return now.Sub(e.measured) < endpointRecheckInterval
+}
+
+func shuffleByWeight(group []*endpointState, random func() float64) []*endpointState {
+	total := 0
+	for _, e := range group {
+		total += e.Weight
+	}
+
+	left := append([]*endpointState(nil), group...)
+	shuffled := make([]*endpointState, 0, len(group))
+	for len(left) > 0 {
+		pick := int(random() * float64(total))
+
+		i := 0
+		for ; i < len(left)-1 && pick >= left[i].Weight; i++ {
+			pick -= left[i].Weight
+		}
+
+		shuffled = append(shuffled, left[i])
+		total -= left[i].Weight
+		left = append(left[:i], left[i+1:]...)
+	}
+	return shuffled
+}
+
+// observe averages the dial duration of the endpoint into its latency
+func (s *endpointSet) observe(e *endpointState, d time.Duration, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.clock.Now()
+	stale := !s.fresh(e, now)
+
+	e.measured = now
+	if err != nil {
+		e.down = true
+		return
+	}
+	e.down = false
+
+	if e.latency == 0 || stale {
+		e.latency = d
+		return
+	}
+	e.latency += time.Duration(endpointLatencyWeight * float64(d-e.latency))
+}
+
+// openEndpoint connects to the endpoints in their order until one succeeds
+func (l *lockingCenter) openEndpoint() (net.Conn, error) {
+	var lastErr error
+	for _, e := range l.endpoints.order(l.jitter.float64) {
+		started := l.options.clock.Now()
+
+		conn, err := l.openAddr("tcp", e.Address, e.host)
+		l.endpoints.observe(e, since(l.options.clock, started), err)
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
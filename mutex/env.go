@@ -0,0 +1,146 @@
+package mutex
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	EnvAddr             = "LOCKING_CENTER_ADDR"
+	EnvSourceAddr       = "LOCKING_CENTER_SOURCE_ADDR"
+	EnvSourceLabel      = "LOCKING_CENTER_SOURCE_LABEL"
+	EnvNamespace        = "LOCKING_CENTER_NAMESPACE"
+	EnvDialTimeout      = "LOCKING_CENTER_DIAL_TIMEOUT"
+	EnvRetryInterval    = "LOCKING_CENTER_RETRY_INTERVAL"
+	EnvRetryMaxInterval = "LOCKING_CENTER_RETRY_MAX_INTERVAL"
+	EnvTLS              = "LOCKING_CENTER_TLS"
+	EnvTLSCA            = "LOCKING_CENTER_TLS_CA"
+	EnvTLSCert          = "LOCKING_CENTER_TLS_CERT"
+	EnvTLSKey           = "LOCKING_CENTER_TLS_KEY"
+	EnvTLSServerName    = "LOCKING_CENTER_TLS_SERVER_NAME"
+	EnvTLSInsecure      = "LOCKING_CENTER_TLS_INSECURE"
+)
+
+// NewFromEnv creates the client from the LOCKING_CENTER_* environment
+// variables. The durations are in the time.ParseDuration format, and the
+// retry interval backs off up to the max retry interval when it is set. The
+// options given override the environment.
+func NewFromEnv(opts ...Option) (LockingCenter, error) {
+	address := os.Getenv(EnvAddr)
+	if len(address) == 0 {
+		return nil, fmt.Errorf("%s is not set", EnvAddr)
+	}
+
+	envOpts, err := envOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	var sourceAddr *string
+	if s, has := os.LookupEnv(EnvSourceAddr); has {
+		sourceAddr = &s
+	}
+
+	return NewLockingCenterWithSourceAddr(address, sourceAddr, append(envOpts, opts...)...)
+}
+
+func envOptions() ([]Option, error) {
+	var opts []Option
+
+	if namespace := os.Getenv(EnvNamespace); len(namespace) > 0 {
+		opts = append(opts, WithNamespace(namespace))
+	}
+
+	dialTimeout, err := envDuration(EnvDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if dialTimeout > 0 {
+		opts = append(opts, WithDialTimeout(dialTimeout))
+	}
+
+	retryInterval, err := envDuration(EnvRetryInterval)
+	if err != nil {
+		return nil, err
+	}
+	retryMaxInterval, err := envDuration(EnvRetryMaxInterval)
+	if err != nil {
+		return nil, err
+	}
+	if retryInterval > 0 {
+		opts = append(opts, WithRetryInterval(retryInterval))
+	}
+	if retryMaxInterval > 0 {
+		if retryInterval <= 0 {
+			retryInterval = defaultRetryInterval
+		}
+		if retryMaxInterval < retryInterval {
+			return nil, fmt.Errorf("%s can not be less than the retry interval", EnvRetryMaxInterval)
+		}
+		opts = append(opts, WithAdaptiveRetry(retryInterval, retryMaxInterval))
+	}
+
+	config, err := envTLS()
+	if err != nil {
+		return nil, err
+	}
+	if config != nil {
+		opts = append(opts, WithTLS(config))
+	}
+
+	return opts, nil
+}
+
+func envDuration(name string) (time.Duration, error) {
+	value := os.Getenv(name)
+	if len(value) == 0 {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %s", name, err)
+	}
+	return d, nil
+}
+
+func envBool(name string) (bool, error) {
+	value := os.Getenv(name)
+	if len(value) == 0 {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %s", name, err)
+	}
+	return b, nil
+}
+
+// envTLS is set when TLS is enabled or any of the TLS files is given
+func envTLS() (*tls.Config, error) {
+	enabled, err := envBool(EnvTLS)
+	if err != nil {
+		return nil, err
+	}
+	insecure, err := envBool(EnvTLSInsecure)
+	if err != nil {
+		return nil, err
+	}
+
+	files := TLSFiles{
+		CA:         os.Getenv(EnvTLSCA),
+		Cert:       os.Getenv(EnvTLSCert),
+		Key:        os.Getenv(EnvTLSKey),
+		ServerName: os.Getenv(EnvTLSServerName),
+		Insecure:   insecure,
+	}
+	if !enabled && len(files.CA) == 0 && len(files.Cert) == 0 && len(files.Key) == 0 {
+		return nil, nil
+	}
+
+	return files.Load()
+}
@@ -0,0 +1,59 @@
+package mutex
+
+import (
+	"net"
+	"testing"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+// acceptingConn accepts every request written on it without a server
+type acceptingConn struct {
+	net.Conn
+	answer  []byte
+	pending int
+}
+
+func (c *acceptingConn) Write(b []byte) (int, error) {
+	c.pending = len(c.answer)
+	return len(b), nil
+}
+
+func (c *acceptingConn) Read(b []byte) (int, error) {
+	n := copy(b, c.answer[len(c.answer)-c.pending:])
+	c.pending -= n
+	return n, nil
+}
+
+func benchmarkExchange(b *testing.B, peer *wire.HelloPayload, answer []byte) {
+	lc, err := NewLockingCenter("127.0.0.1:22119", WithLazyConnect())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer lc.Close()
+
+	l := lc.(*lockingCenter)
+	if peer != nil {
+		l.peer.Store(peer)
+	}
+	conn := &acceptingConn{answer: answer}
+	sourceAddr := "10.0.0.1:4242"
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := l.exchange(conn, maLock, "orders/42", &sourceAddr, uint64(i+1), 0, FairnessFIFO, 0, ""); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExchange(b *testing.B) {
+	b.Run("v1", func(b *testing.B) {
+		benchmarkExchange(b, nil, wire.EncodeResponse(wire.Lock, wire.Response{Accepted: true}))
+	})
+	b.Run("v2", func(b *testing.B) {
+		peer := &wire.HelloPayload{Version: wire.ProtocolVersion, Capabilities: wire.Capabilities}
+		benchmarkExchange(b, peer, wire.EncodeResponseV2(wire.Lock, wire.Response{Accepted: true}))
+	})
+}
@@ -0,0 +1,66 @@
+package mutex
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+)
+
+// WithExpvar publishes the counters of the client as an expvar map under the
+// name: the operations, the failed ones, the retries, the held locks and the
+// histograms of WithLatencyHistograms. The name can not be published again, so
+// it should be unique to the client.
+func WithExpvar(name string) Option {
+	return func(o *options) {
+		o.expvarName = name
+	}
+}
+
+type counters struct {
+	operations expvar.Int
+	errors     expvar.Int
+	retries    expvar.Int
+}
+
+var publishing sync.Mutex
+
+func (l *lockingCenter) publish() error {
+	name := l.options.expvarName
+	if len(name) == 0 {
+		return nil
+	}
+
+	publishing.Lock()
+	defer publishing.Unlock()
+
+	if expvar.Get(name) != nil {
+		return fmt.Errorf("expvar %s is already published", name)
+	}
+
+	m := new(expvar.Map).Init()
+	m.Set("operations", &l.counters.operations)
+	m.Set("errors", &l.counters.errors)
+	m.Set("retries", &l.counters.retries)
+	m.Set("held", expvar.Func(func() interface{} {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+
+		return len(l.held)
+	}))
+	if l.latencies != nil {
+		m.Set("latency", expvar.Func(func() interface{} {
+			return l.LatencyHistograms()
+		}))
+	}
+	expvar.Publish(name, m)
+
+	return nil
+}
+
+func (l *lockingCenter) count(err error) error {
+	l.counters.operations.Add(1)
+	if err != nil {
+		l.counters.errors.Add(1)
+	}
+	return err
+}
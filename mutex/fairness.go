@@ -0,0 +1,63 @@
+package mutex
+
+import (
+	"context"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+// Fairness is how a lock is queued behind the waiters of its key
+type Fairness uint8
+
+const (
+	// FairnessFIFO grants the key to the waiters in the order they are queued
+	FairnessFIFO Fairness = iota
+	// FairnessBarging lets the lock take the released key ahead of the waiters
+	// queued before it, trading their fairness for its latency
+	FairnessBarging
+)
+
+func (f Fairness) String() string {
+	if f == FairnessBarging {
+		return "barging"
+	}
+	return "fifo"
+}
+
+type fairnessKey struct{}
+
+// WithFairness sets the fairness of the locks of the client, the locks are
+// queued in the FIFO order by default. The barging locks are sent to the
+// servers agreeing on them by the negotiation in the v2 frames, and queued in
+// the FIFO order by the others.
+func WithFairness(fairness Fairness) Option {
+	return func(o *options) {
+		o.fairness = fairness
+	}
+}
+
+// FairnessContext attaches the fairness to the locks acquired with the context
+// in place of the one of the client
+func FairnessContext(ctx context.Context, fairness Fairness) context.Context {
+	return context.WithValue(ctx, fairnessKey{}, fairness)
+}
+
+// FairnessOf returns the lock fairness attached to the context
+func FairnessOf(ctx context.Context) (Fairness, bool) {
+	fairness, has := ctx.Value(fairnessKey{}).(Fairness)
+	return fairness, has
+}
+
+// fairness returns the fairness of the lock acquired with the context
+func (l *lockingCenter) fairness(ctx context.Context) Fairness {
+	if fairness, has := FairnessOf(ctx); has {
+		return fairness
+	}
+	return l.options.fairness
+}
+
+// sendsBarging reports if the server has agreed on receiving the barging
+// locks, they are only encoded in the v2 frames
+func (l *lockingCenter) sendsBarging() bool {
+	return l.framesV2() && l.agrees(wire.CapBarging)
+}
@@ -0,0 +1,156 @@
+package mutex
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+var errDroppedByFaults = errors.New("connection is dropped by the fault injection")
+
+// Faults injects the failures of a degraded server into the connections of the
+// clients given WithFaults, without reaching the server. Each fault is applied
+// to the given number of the next requests and a negative number applies it
+// until Reset. They can be changed while the clients are in use.
+type Faults struct {
+	mutex   sync.Mutex
+	drop    int
+	corrupt int
+	refuse  int
+}
+
+func NewFaults() *Faults {
+	return &Faults{}
+}
+
+// WithFaults passes the connections of the client through the fault injection.
+func WithFaults(faults *Faults) Option {
+	return func(o *options) {
+		o.faults = faults
+	}
+}
+
+// DropConnections closes the connections of the next n requests before they
+// are sent.
+func (f *Faults) DropConnections(n int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.drop = n
+}
+
+// CorruptResponses inverts the bytes of the responses of the next n requests.
+func (f *Faults) CorruptResponses(n int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.corrupt = n
+}
+
+// RefuseRequests answers the next n requests with the rejection in place of
+// the server.
+func (f *Faults) RefuseRequests(n int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.refuse = n
+}
+
+// Reset stops all the faults.
+func (f *Faults) Reset() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.drop, f.corrupt, f.refuse = 0, 0, 0
+}
+
+type fault int
+
+const (
+	noFault fault = iota
+	dropFault
+	corruptFault
+	refuseFault
+)
+
+// next picks the fault of a request, the drop comes first, then the refusal
+// and the corruption
+func (f *Faults) next() fault {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	take := func(n *int) bool {
+		if *n == 0 {
+			return false
+		}
+		if *n > 0 {
+			*n--
+		}
+		return true
+	}
+
+	switch {
+	case take(&f.drop):
+		return dropFault
+	case take(&f.refuse):
+		return refuseFault
+	case take(&f.corrupt):
+		return corruptFault
+	}
+	return noFault
+}
+
+func (f *Faults) wrap(conn net.Conn) net.Conn {
+	return &faultyConn{Conn: conn, faults: f}
+}
+
+type faultyConn struct {
+	net.Conn
+	faults *Faults
+
+	mutex    sync.Mutex
+	refused  int
+	corrupts int
+}
+
+func (c *faultyConn) Write(b []byte) (int, error) {
+	switch c.faults.next() {
+	case dropFault:
+		_ = c.Conn.Close()
+		return 0, errDroppedByFaults
+	case refuseFault:
+		c.mutex.Lock()
+		c.refused++
+		c.mutex.Unlock()
+		return len(b), nil
+	case corruptFault:
+		c.mutex.Lock()
+		c.corrupts++
+		c.mutex.Unlock()
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *faultyConn) Read(b []byte) (int, error) {
+	c.mutex.Lock()
+	if c.refused > 0 && len(b) > 0 {
+		c.refused--
+		c.mutex.Unlock()
+
+		b[0] = '-'
+		return 1, nil
+	}
+	corrupt := c.corrupts > 0
+	if corrupt {
+		c.corrupts--
+	}
+	c.mutex.Unlock()
+
+	n, err := c.Conn.Read(b)
+	if corrupt {
+		for i := 0; i < n; i++ {
+			b[i] = ^b[i]
+		}
+	}
+	return n, err
+}
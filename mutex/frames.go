@@ -0,0 +1,39 @@
+package mutex
+
+import (
+	"net"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+// framesV2 reports if the server has agreed on the v2 frames by the
+// negotiation, they lift the limits of the sizes of the keys and the source
+// addresses. The client speaks the v1 frames to the other servers.
+func (l *lockingCenter) framesV2() bool {
+	peer := l.agreed()
+	return peer != nil && peer.Version >= 2
+}
+
+// decode reads the response of the action sent by preparePackage, the
+// rejections of the v2 frames are detailed only when they are asked for
+func (l *lockingCenter) decode(conn net.Conn, action wire.Action) (wire.Response, error) {
+	if !l.framesV2() {
+		return decode(conn, action)
+	}
+
+	resp, err := wire.DecodeV2(conn, action)
+	if err == nil && !l.options.errorDetails {
+		resp.Code, resp.Reason = wire.CodeUnspecified, ""
+	}
+	return resp, err
+}
+
+func (l *lockingCenter) validateKey(key string) error {
+	if !l.framesV2() {
+		return ValidateKey(key)
+	}
+	if len(key) == 0 || len(key) > wire.MaxKeySizeV2 {
+		return &KeyError{Key: key, limit: wire.MaxKeySizeV2}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrGroupHeld = errors.New("lock group is already held")
+
+// LockGroup runs a group of functions while holding a set of keys. The first
+// failure cancels the context of the group, and the keys are released once all
+// the functions have returned.
+type LockGroup struct {
+	lc         Locker
+	ordered    []string
+	concurrent []string
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+
+	mutex sync.Mutex
+	held  []string
+
+	once sync.Once
+	err  error
+}
+
+// NewLockGroup acquires the keys in their sorted order and returns the group
+// with the context of its functions. When one of the acquisitions fails, the
+// keys already locked are released.
+func NewLockGroup(ctx context.Context, lc Locker, keys ...string) (*LockGroup, context.Context, error) {
+	g := NewLockGroupOf(lc)
+	g.Add(keys...)
+
+	ctx, err := g.AcquireAll(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return g, ctx, nil
+}
+
+// NewLockGroupOf returns the group without any keys, they are registered by
+// Add and AddConcurrent and acquired by AcquireAll.
+func NewLockGroupOf(lc Locker) *LockGroup {
+	return &LockGroup{lc: lc, cancel: func() {}}
+}
+
+// Add registers the keys acquired one by one in their sorted order, so the
+// groups sharing some of them can not deadlock.
+func (g *LockGroup) Add(keys ...string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.ordered = append(g.ordered, keys...)
+}
+
+// AddConcurrent registers the keys acquired concurrently with the others. It
+// is only safe for the keys that are never held along with another key by the
+// other holders, a key also registered by Add is acquired in order.
+func (g *LockGroup) AddConcurrent(keys ...string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.concurrent = append(g.concurrent, keys...)
+}
+
+// AcquireAll acquires the registered keys and returns the context of the
+// functions of the group. When one of the acquisitions fails, the others are
+// cancelled and the keys already locked are released.
+func (g *LockGroup) AcquireAll(ctx context.Context) (context.Context, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if len(g.held) > 0 {
+		return nil, ErrGroupHeld
+	}
+
+	normalize := func(key string) string { return key }
+	if l, ok := g.lc.(*lockingCenter); ok {
+		normalize = l.options.normalize
+	}
+	ordered := canonicalKeys(g.ordered, normalize)
+	inOrder := make(map[string]bool, len(ordered))
+	for _, key := range ordered {
+		inOrder[key] = true
+	}
+	var concurrent []string
+	for _, key := range canonicalKeys(g.concurrent, normalize) {
+		if !inOrder[key] {
+			concurrent = append(concurrent, key)
+		}
+	}
+
+	acquireCtx, cancelAcquire := context.WithCancel(ctx)
+	defer cancelAcquire()
+
+	var mutex sync.Mutex
+	var locked []string
+	var failure error
+
+	acquire := func(key string) bool {
+		err := g.lc.LockContext(acquireCtx, key)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if err != nil {
+			if failure == nil {
+				failure = err
+			}
+			cancelAcquire()
+			return false
+		}
+		locked = append(locked, key)
+		return true
+	}
+
+	var wg sync.WaitGroup
+	for _, key := range concurrent {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			acquire(key)
+		}(key)
+	}
+	for _, key := range ordered {
+		if !acquire(key) {
+			break
+		}
+	}
+	wg.Wait()
+
+	if failure != nil {
+		for i := len(locked) - 1; i >= 0; i-- {
+			_ = g.lc.Unlock(locked[i])
+		}
+		return nil, failure
+	}
+
+	g.held = locked
+	ctx, g.cancel = context.WithCancel(ctx)
+
+	return ctx, nil
+}
+
+// ReleaseAll releases the keys held by the group in the reverse order of their
+// acquisition, cancels the context of the group and returns the first failure.
+// It can be called more than once, like deferred right after AcquireAll.
+func (g *LockGroup) ReleaseAll() error {
+	g.mutex.Lock()
+	held := g.held
+	g.held = nil
+	cancel := g.cancel
+	g.mutex.Unlock()
+
+	cancel()
+
+	var err error
+	for i := len(held) - 1; i >= 0; i-- {
+		if unlockErr := g.lc.Unlock(held[i]); unlockErr != nil && err == nil {
+			err = unlockErr
+		}
+	}
+	return err
+}
+
+func (g *LockGroup) Go(fn func() error) {
+	g.wg.Add(1)
+
+	go func() {
+		defer g.wg.Done()
+
+		if err := fn(); err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+func (g *LockGroup) fail(err error) {
+	g.once.Do(func() {
+		g.err = err
+		g.cancel()
+	})
+}
+
+// Wait waits for the functions, releases the keys and returns the first
+// failure of the functions or of the releases.
+func (g *LockGroup) Wait() error {
+	g.wg.Wait()
+
+	if err := g.ReleaseAll(); err != nil {
+		g.fail(err)
+	}
+	return g.err
+}
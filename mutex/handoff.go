@@ -0,0 +1,93 @@
+package mutex
+
+import "context"
+
+// WithLocalHandOff serializes the locks of the same key in the client like
+// WithKeySerialization and passes the remote lock of an unlocked key directly
+// to the next goroutine waiting for it, so the intra-process contention costs a
+// single remote lock. To stay fair to the other clients, the remote lock is
+// released after it is passed limit times in a row.
+func WithLocalHandOff(limit int) Option {
+	return func(o *options) {
+		if limit <= 0 {
+			return
+		}
+		o.serializeKeys = true
+		o.handOffLimit = limit
+	}
+}
+
+func sameSource(a *string, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// handOff keeps the remote lock of the key for the next goroutine waiting in
+// the gate instead of unlocking it on the server
+func (l *lockingCenter) handOff(key string) bool {
+	if l.options.handOffLimit == 0 {
+		return false
+	}
+
+	l.mutex.Lock()
+	g, has := l.gates[key]
+	h, held := l.held[key]
+	if !has || !held || g.refs < 2 || g.handOffs >= l.options.handOffLimit {
+		if has {
+			g.handOffs = 0
+		}
+		l.mutex.Unlock()
+		return false
+	}
+
+	g.remote = true
+	g.handOffs++
+	delete(l.held, key)
+	l.leaveGate(key)
+	l.mutex.Unlock()
+
+	l.measureHold(key, since(l.options.clock, h.acquiredAt))
+
+	return true
+}
+
+// takeHandOff acquires the key without the server when the previous holder in
+// the process has passed its remote lock. The lock of another source is
+// released to be requested again.
+func (l *lockingCenter) takeHandOff(key string, sourceAddr *string, token string) bool {
+	l.mutex.Lock()
+	g, has := l.gates[key]
+	if !has || !g.remote {
+		l.mutex.Unlock()
+		return false
+	}
+	g.remote = false
+
+	if sameSource(g.source, sourceAddr) {
+		l.held[key] = l.hold()
+		l.held[key].token = token
+		l.mutex.Unlock()
+		return true
+	}
+	l.mutex.Unlock()
+
+	if err := l.release(context.Background(), key); err != nil {
+		l.logf("WARN: unlocking error: %s\n", err)
+	}
+	return false
+}
+
+// passed collects the remote locks that are passed but not taken yet, it should
+// be called holding the mutex
+func (l *lockingCenter) passed() []string {
+	var keys []string
+	for key, g := range l.gates {
+		if g.remote {
+			g.remote = false
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,88 @@
+package mutex
+
+import (
+	"net"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+const (
+	heartbeatKey     = "locking-center-client/heartbeat"
+	heartbeatTimeout = time.Second * 5
+)
+
+// heartbeat probes the connections idle for the heartbeat interval until the
+// pool is closed or has no idle connections left, it is started again by the
+// next idle connection
+func (p *connPool) heartbeat() {
+	interval := p.config.HeartbeatInterval
+
+	ticker := p.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C() {
+		p.mutex.Lock()
+		if p.closed || len(p.idle) == 0 {
+			p.beating = false
+			p.mutex.Unlock()
+			return
+		}
+		p.evict()
+
+		var due []idleConn
+		fresh := p.idle[:0]
+		for _, c := range p.idle {
+			if since(p.clock, c.since) >= interval {
+				due = append(due, c)
+				continue
+			}
+			fresh = append(fresh, c)
+		}
+		p.idle = fresh
+		p.mutex.Unlock()
+
+		for _, c := range due {
+			if err := beat(c.conn); err != nil || !p.restore(c) {
+				_ = c.conn.Close()
+				p.release()
+			}
+		}
+	}
+}
+
+// restore gives the probed connection back keeping its idle time, it returns
+// false when the pool is closed or full
+func (p *connPool) restore(c idleConn) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed || len(p.idle) >= p.config.MaxIdle {
+		return false
+	}
+
+	p.idle = append(p.idle, c)
+	p.signal()
+
+	return true
+}
+
+// beat sends a status query of the heartbeat key, any answer of the server
+// means that the connection is alive
+func beat(conn net.Conn) error {
+	frame, err := wire.Encode(wire.Request{Action: wire.Status, Key: heartbeatKey})
+	if err != nil {
+		return err
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(heartbeatTimeout)); err != nil {
+		return err
+	}
+	if _, err := conn.Write(frame); err != nil {
+		return err
+	}
+	if _, err := decode(conn, wire.Status); err != nil {
+		return err
+	}
+	return conn.SetDeadline(time.Time{})
+}
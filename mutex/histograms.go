@@ -0,0 +1,187 @@
+package mutex
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets are the upper bounds of the buckets of the latency
+// histograms by default
+var DefaultLatencyBuckets = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond,
+	500 * time.Millisecond, time.Second, 5 * time.Second, 10 * time.Second, time.Minute,
+}
+
+// WithLatencyHistograms measures the acquisition latencies and the hold
+// durations of the locks in the histograms of the key families, so the
+// families causing the tail latencies can be told apart. A pattern matches the
+// keys by path.Match, or by their prefix when it ends with "/", the keys
+// matching none of them are measured in the family of the empty pattern. The
+// buckets are DefaultLatencyBuckets when they are not given.
+func WithLatencyHistograms(buckets []time.Duration, patterns ...string) Option {
+	return func(o *options) {
+		o.latencyBuckets = buckets
+		o.latencyPatterns = append(o.latencyPatterns, patterns...)
+		o.latencyHistograms = true
+	}
+}
+
+// Histogram counts the durations in the buckets of their upper bounds, the
+// last count is of the ones above all the bounds
+type Histogram struct {
+	Bounds []time.Duration
+	Counts []uint64
+	Sum    time.Duration
+	Max    time.Duration
+}
+
+func (h Histogram) Count() uint64 {
+	var count uint64
+	for _, c := range h.Counts {
+		count += c
+	}
+	return count
+}
+
+// Quantile returns the upper bound of the bucket of the quantile, or the
+// longest duration when it is shorter or above all the bounds
+func (h Histogram) Quantile(q float64) time.Duration {
+	count := h.Count()
+	if count == 0 {
+		return 0
+	}
+
+	rank := uint64(q * float64(count))
+	if rank >= count {
+		rank = count - 1
+	}
+
+	var seen uint64
+	for i, c := range h.Counts {
+		if seen += c; seen > rank {
+			if i < len(h.Bounds) && h.Bounds[i] < h.Max {
+				return h.Bounds[i]
+			}
+			break
+		}
+	}
+	return h.Max
+}
+
+func (h Histogram) String() string {
+	return fmt.Sprintf("count=%d p50=%s p99=%s max=%s", h.Count(), h.Quantile(0.5), h.Quantile(0.99), h.Max)
+}
+
+// PatternLatency are the histograms of the keys of a pattern
+type PatternLatency struct {
+	Pattern string
+	Acquire Histogram
+	Hold    Histogram
+}
+
+type latencyHistograms struct {
+	patterns []string
+
+	mutex   sync.Mutex
+	acquire []Histogram
+	hold    []Histogram
+}
+
+func newLatencyHistograms(o options) *latencyHistograms {
+	if !o.latencyHistograms {
+		return nil
+	}
+
+	bounds := append([]time.Duration(nil), o.latencyBuckets...)
+	if len(bounds) == 0 {
+		bounds = DefaultLatencyBuckets
+	}
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+
+	h := &latencyHistograms{patterns: append(append([]string(nil), o.latencyPatterns...), "")}
+	for range h.patterns {
+		h.acquire = append(h.acquire, Histogram{Bounds: bounds, Counts: make([]uint64, len(bounds)+1)})
+		h.hold = append(h.hold, Histogram{Bounds: bounds, Counts: make([]uint64, len(bounds)+1)})
+	}
+	return h
+}
+
+func (o options) validateLatencyPatterns() error {
+	for _, pattern := range o.latencyPatterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("latency pattern %s is not valid: %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+// family is the index of the first pattern matching the key
+func (h *latencyHistograms) family(key string) int {
+	for i, pattern := range h.patterns[:len(h.patterns)-1] {
+		if strings.HasSuffix(pattern, "/") && strings.HasPrefix(key, pattern) {
+			return i
+		}
+		if matched, _ := path.Match(pattern, key); matched {
+			return i
+		}
+	}
+	return len(h.patterns) - 1
+}
+
+func (h *latencyHistograms) observe(histograms []Histogram, key string, d time.Duration) {
+	family := h.family(key)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	histogram := &histograms[family]
+	i := sort.Search(len(histogram.Bounds), func(i int) bool { return d <= histogram.Bounds[i] })
+	histogram.Counts[i]++
+	histogram.Sum += d
+	if d > histogram.Max {
+		histogram.Max = d
+	}
+}
+
+// LatencyHistograms returns the histograms of the key families in the order
+// of their patterns, nil without WithLatencyHistograms
+func (l *lockingCenter) LatencyHistograms() []PatternLatency {
+	h := l.latencies
+	if h == nil {
+		return nil
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	latencies := make([]PatternLatency, 0, len(h.patterns))
+	for i, pattern := range h.patterns {
+		latencies = append(latencies, PatternLatency{
+			Pattern: pattern,
+			Acquire: copyHistogram(h.acquire[i]),
+			Hold:    copyHistogram(h.hold[i]),
+		})
+	}
+	return latencies
+}
+
+func copyHistogram(h Histogram) Histogram {
+	h.Counts = append([]uint64(nil), h.Counts...)
+	return h
+}
+
+func (l *lockingCenter) observeAcquire(key string, d time.Duration) {
+	if l.latencies != nil {
+		l.latencies.observe(l.latencies.acquire, key, d)
+	}
+}
+
+func (l *lockingCenter) observeHold(key string, d time.Duration) {
+	if l.latencies != nil {
+		l.latencies.observe(l.latencies.hold, key, d)
+	}
+}
@@ -0,0 +1,242 @@
+package mutex
+
+import (
+	"fmt"
+	"path"
+	"runtime/debug"
+	"sort"
+	"time"
+)
+
+const (
+	holdCheckInterval    = time.Second
+	minHoldCheckInterval = time.Millisecond * 10
+)
+
+type heldLock struct {
+	acquiredAt time.Time
+	reported   bool
+	leaked     bool
+	releasing  bool
+	token      string
+	stack      []byte
+	goroutine  int64
+	// the bound of LockFor and its timers
+	maxHold time.Duration
+	timers  []Timer
+}
+
+type HeldLock struct {
+	Key        string
+	AcquiredAt time.Time
+	MaxHold    time.Duration
+	Stack      string
+
+	clock Clock
+}
+
+func (h HeldLock) HeldFor() time.Duration {
+	if h.clock == nil {
+		return time.Since(h.AcquiredAt)
+	}
+	return since(h.clock, h.AcquiredAt)
+}
+
+func (h HeldLock) Overdue() bool {
+	return h.MaxHold > 0 && h.HeldFor() > h.MaxHold
+}
+
+type holdBound struct {
+	pattern string
+	maxHold time.Duration
+}
+
+type OverdueHandler func(lock HeldLock)
+
+type LeakHandler func(lock HeldLock)
+
+type SlowHoldHandler func(key string, held time.Duration)
+
+func WithMaxHold(pattern string, maxHold time.Duration) Option {
+	return func(o *options) {
+		o.holdBounds = append(o.holdBounds, holdBound{pattern: pattern, maxHold: maxHold})
+	}
+}
+
+func WithOverdueHandler(handler OverdueHandler) Option {
+	return func(o *options) {
+		o.overdueHandler = handler
+	}
+}
+
+// WithLeakDetection records the stack trace of every acquisition and reports
+// the locks held longer than the threshold to the handler, or to the logger
+// when the handler is nil
+func WithLeakDetection(threshold time.Duration, handler LeakHandler) Option {
+	return func(o *options) {
+		o.leakThreshold = threshold
+		o.leakHandler = handler
+	}
+}
+
+// WithSlowHoldThreshold measures the time in between the lock and the unlock
+// of the keys and reports the ones longer than the threshold to the handler,
+// or to the logger when the handler is nil
+func WithSlowHoldThreshold(threshold time.Duration, handler SlowHoldHandler) Option {
+	return func(o *options) {
+		o.slowHoldThreshold = threshold
+		o.slowHoldHandler = handler
+	}
+}
+
+func (o options) maxHold(key string) time.Duration {
+	for _, b := range o.holdBounds {
+		if matched, _ := path.Match(b.pattern, key); matched {
+			return b.maxHold
+		}
+	}
+	return 0
+}
+
+func (o options) validateHoldBounds() error {
+	for _, b := range o.holdBounds {
+		if _, err := path.Match(b.pattern, ""); err != nil {
+			return fmt.Errorf("hold bound pattern %s is not valid: %s", b.pattern, err)
+		}
+	}
+	return nil
+}
+
+func (o options) watchesHolds() bool {
+	return len(o.holdBounds) > 0 || o.leakThreshold > 0
+}
+
+func (o options) holdCheckInterval() time.Duration {
+	interval := holdCheckInterval
+	if o.leakThreshold > 0 && o.leakThreshold/2 < interval {
+		interval = o.leakThreshold / 2
+	}
+	if interval < minHoldCheckInterval {
+		interval = minHoldCheckInterval
+	}
+	return interval
+}
+
+func (l *lockingCenter) hold() *heldLock {
+	h := &heldLock{acquiredAt: l.options.clock.Now()}
+	if l.options.leakThreshold > 0 {
+		h.stack = debug.Stack()
+	}
+	if l.options.tracksGoroutines() {
+		h.goroutine = goroutineID()
+	}
+	return h
+}
+
+func (l *lockingCenter) heldLock(key string, h *heldLock) HeldLock {
+	maxHold := h.maxHold
+	if maxHold <= 0 {
+		maxHold = l.options.maxHold(key)
+	}
+
+	return HeldLock{
+		Key:        key,
+		AcquiredAt: h.acquiredAt,
+		MaxHold:    maxHold,
+		Stack:      string(h.stack),
+		clock:      l.options.clock,
+	}
+}
+
+func (l *lockingCenter) HeldLocks() []HeldLock {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	locks := make([]HeldLock, 0, len(l.held))
+	for key, h := range l.held {
+		locks = append(locks, l.heldLock(key, h))
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].Key < locks[j].Key })
+
+	return locks
+}
+
+func (l *lockingCenter) watchHolds() {
+	ticker := l.options.clock.NewTicker(l.options.holdCheckInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.abort:
+			return
+		case <-ticker.C():
+			l.checkHolds()
+		}
+	}
+}
+
+// checkHolds reports the overdue and the leaked locks, a panic of a report
+// does not stop the watch
+func (l *lockingCenter) checkHolds() {
+	defer l.rescue("hold watch")
+
+	overdue, leaked := l.inspectHolds()
+	for _, lock := range overdue {
+		l.reportOverdue(lock)
+	}
+	for _, lock := range leaked {
+		l.reportLeak(lock)
+	}
+}
+
+func (l *lockingCenter) inspectHolds() ([]HeldLock, []HeldLock) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	overdue := make([]HeldLock, 0)
+	leaked := make([]HeldLock, 0)
+
+	for key, h := range l.held {
+		lock := l.heldLock(key, h)
+
+		if !h.reported && lock.Overdue() {
+			h.reported = true
+			overdue = append(overdue, lock)
+		}
+
+		if !h.leaked && l.options.leakThreshold > 0 && lock.HeldFor() > l.options.leakThreshold {
+			h.leaked = true
+			leaked = append(leaked, lock)
+		}
+	}
+
+	return overdue, leaked
+}
+
+func (l *lockingCenter) reportOverdue(lock HeldLock) {
+	if l.options.overdueHandler != nil {
+		l.options.overdueHandler(lock)
+		return
+	}
+	l.logf("WARN: lock %s is held for %s, more than the declared %s\n", lock.Key, lock.HeldFor().Round(time.Millisecond), lock.MaxHold)
+}
+
+func (l *lockingCenter) reportLeak(lock HeldLock) {
+	if l.options.leakHandler != nil {
+		l.options.leakHandler(lock)
+		return
+	}
+	l.logf("WARN: lock %s is held for %s without unlock, acquired at:\n%s\n", lock.Key, lock.HeldFor().Round(time.Millisecond), lock.Stack)
+}
+
+func (l *lockingCenter) measureHold(key string, held time.Duration) {
+	if l.options.slowHoldThreshold <= 0 || held < l.options.slowHoldThreshold {
+		return
+	}
+
+	if l.options.slowHoldHandler != nil {
+		l.options.slowHoldHandler(key, held)
+		return
+	}
+	l.logf("WARN: lock %s was held for %s, more than the slow hold threshold %s\n", key, held.Round(time.Millisecond), l.options.slowHoldThreshold)
+}
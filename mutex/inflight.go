@@ -0,0 +1,54 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrTooManyInFlight = errors.New("too many operations in flight")
+
+// WithMaxInFlight bounds the operations of the client in flight at once, so a
+// burst of goroutines does not turn into as many dials. The operations over the
+// limit wait for their turn when wait is set, or fail with ErrTooManyInFlight
+// otherwise. The locks waiting in the queue of the server are in flight until
+// they are granted.
+func WithMaxInFlight(limit int, wait bool) Option {
+	return func(o *options) {
+		o.maxInFlight = limit
+		o.waitInFlight = wait
+	}
+}
+
+func newInFlightSlots(limit int) chan struct{} {
+	if limit <= 0 {
+		return nil
+	}
+	return make(chan struct{}, limit)
+}
+
+// takeSlot takes an in flight slot of the operation and returns its release
+func (l *lockingCenter) takeSlot(ctx context.Context) (func(), error) {
+	if l.slots == nil {
+		return func() {}, nil
+	}
+	release := func() { <-l.slots }
+
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	if !l.options.waitInFlight {
+		return nil, ErrTooManyInFlight
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-l.abort:
+		return nil, ErrClosed
+	}
+}
@@ -0,0 +1,53 @@
+package mutex
+
+import (
+	"fmt"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+// Info is the protocol of the server answering on the address, the servers
+// without the negotiation speak the version zero without any capability.
+type Info struct {
+	Address      string
+	Version      uint16
+	Capabilities wire.Capability
+}
+
+func (i Info) Has(c wire.Capability) bool {
+	return i.Capabilities&c == c
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("%s protocol version %d (%s)", i.Address, i.Version, i.Capabilities)
+}
+
+// ServerInfo asks the protocol of the server by the hello frame on a new
+// connection, with or without the negotiation of the client.
+func (l *lockingCenter) ServerInfo() (Info, error) {
+	if l.isAborted() {
+		return Info{}, ErrClosed
+	}
+	if l.options.dryRun != nil {
+		// the dry run speaks the protocol of the package
+		return Info{Address: l.address, Version: wire.ProtocolVersion, Capabilities: wire.Capabilities}, nil
+	}
+
+	conn, err := l.connect()
+	if err != nil {
+		return Info{}, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	info := Info{Address: conn.RemoteAddr().String()}
+
+	hello, err := l.hello(conn)
+	if err != nil {
+		return Info{}, err
+	}
+	if hello != nil {
+		info.Version = hello.Version
+		info.Capabilities = hello.Capabilities
+	}
+	return info, nil
+}
@@ -0,0 +1,296 @@
+package mutex
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+// inquire sends a query frame which is answered by "+", the little endian
+// uint32 size of the payload and the payload itself. Queries are not retried.
+func (l *lockingCenter) inquire(ctx context.Context, action mutexAction, key string, sourceAddr *string) (payload []byte, err error) {
+	defer func(key string, started time.Time) {
+		l.debug(DebugEvent{Kind: DebugOperation, Action: wire.Action(action), Key: key, Duration: since(l.options.clock, started), Err: err})
+	}(key, l.options.clock.Now())
+	defer l.recovered(&err)
+
+	key = l.options.normalize(key)
+
+	op, err := l.begin(action, key)
+	if err != nil {
+		return nil, err
+	}
+	defer l.end(op)
+
+	if l.options.resolve().bypass {
+		return l.dryInquiry(action, key)
+	}
+
+	if !l.supports(capabilityOf(action)) {
+		return nil, ErrNotSupported
+	}
+
+	leave, err := l.admit(action)
+	if err != nil {
+		return nil, err
+	}
+	defer leave()
+
+	release, err := l.takeSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if err := l.throttle(ctx); err != nil {
+		return nil, err
+	}
+
+	started := time.Now()
+
+	replica := false
+	var conn net.Conn
+	if l.options.readsReplica(action) {
+		if conn, err = l.dialReplica(); err == nil {
+			replica = true
+		} else if err != ErrClosed {
+			l.logf("WARN: replica connection failure (querying the server): %s\n", err)
+		}
+	}
+	if !replica {
+		if conn, err = l.dial(ctx, action); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := l.bound(conn, action, started); err != nil {
+		if replica {
+			l.finishReplica(conn, func() {})
+		} else {
+			l.hangUp(conn)
+		}
+		return nil, err
+	}
+
+	stop := l.watch(ctx, conn)
+
+	reusable := false
+	defer func() {
+		if replica {
+			l.finishReplica(conn, stop)
+			return
+		}
+		l.finish(conn, stop, reusable)
+	}()
+
+	id := l.requestID(action)
+	payload, err = l.exchange(conn, action, key, sourceAddr, id, 0, FairnessFIFO, 0, "")
+	if err != nil {
+		if errors.Is(err, ErrServerRejected) && !errors.Is(err, ErrPermissionDenied) {
+			return nil, l.failure(id, ErrNotSupported)
+		}
+		if ctx.Err() != nil {
+			return nil, l.failure(id, ctx.Err())
+		}
+		return nil, l.failure(id, err)
+	}
+
+	reusable = true
+	return payload, nil
+}
+
+// QueuePosition returns the number of waiters queued ahead of the client for
+// the key, or -1 when the client is not waiting for it
+func (l *lockingCenter) QueuePosition(key string) (int, error) {
+	payload, err := l.inquire(context.Background(), maQueuePosition, key, l.sourceAddr)
+	if err != nil {
+		return 0, err
+	}
+	if len(payload) == 0 {
+		return -1, nil
+	}
+	if len(payload) != 4 {
+		return 0, errMalformed
+	}
+
+	return int(int32(binary.LittleEndian.Uint32(payload))), nil
+}
+
+func (l *lockingCenter) IsLocked(key string) (bool, error) {
+	payload, err := l.inquire(context.Background(), maStatus, key, nil)
+	if err != nil {
+		return false, err
+	}
+	if len(payload) == 0 {
+		return false, nil
+	}
+
+	return payload[0] == 1, nil
+}
+
+// LockInfo is a lock held on the server. The labels of the holder and the
+// reason of the acquisition are only known by the servers agreeing on the
+// labels.
+type LockInfo struct {
+	Key        string
+	SourceAddr string
+	HeldFor    time.Duration
+	Labels     map[string]string
+	Reason     string
+}
+
+func (l *lockingCenter) ListLocks() ([]LockInfo, error) {
+	payload, err := l.inquire(context.Background(), maList, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return l.decodeLocks(payload)
+}
+
+// LocksBySource returns the locks held by the source address, the ones
+// ResetBySource releases
+func (l *lockingCenter) LocksBySource(sourceAddr string) ([]LockInfo, error) {
+	locks, err := l.ListLocks()
+	if err != nil {
+		return nil, err
+	}
+	return FilterBySource(locks, sourceAddr), nil
+}
+
+// FilterBySource returns the locks of the source address among the locks
+func FilterBySource(locks []LockInfo, sourceAddr string) []LockInfo {
+	filtered := make([]LockInfo, 0)
+	for _, lock := range locks {
+		if lock.SourceAddr == sourceAddr {
+			filtered = append(filtered, lock)
+		}
+	}
+	return filtered
+}
+
+// decodeLocks reads the uint32 count of the entries, each of them is the key,
+// the source address, both prefixed by their uint8 size or by their uvarint
+// size for the v2 frames, and the int64 hold
+// duration in milliseconds, followed by the labels of the holder when they are
+// asked for
+func (l *lockingCenter) decodeLocks(payload []byte) ([]LockInfo, error) {
+	locks := make([]LockInfo, 0)
+	if len(payload) == 0 {
+		return locks, nil
+	}
+
+	r := &payloadReader{payload: payload, varint: l.framesV2()}
+
+	labelled := l.sendsLabels()
+
+	count := r.uint32()
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		key := r.string()
+		sourceAddr := r.string()
+		heldFor := time.Duration(r.int64()) * time.Millisecond
+
+		var labels map[string]string
+		var reason string
+		if labelled {
+			labels, reason = splitReason(r.labels())
+		}
+
+		if len(l.options.namespace) > 0 {
+			prefix := l.options.qualify("")
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			key = strings.TrimPrefix(key, prefix)
+		}
+
+		locks = append(locks, LockInfo{Key: key, SourceAddr: sourceAddr, HeldFor: heldFor, Labels: labels, Reason: reason})
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return locks, nil
+}
+
+type payloadReader struct {
+	payload []byte
+	// varint reads the sizes of the strings of the v2 frames
+	varint bool
+	err    error
+}
+
+func (r *payloadReader) next(size int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.payload) < size {
+		r.err = errMalformed
+		return nil
+	}
+
+	b := r.payload[:size]
+	r.payload = r.payload[size:]
+
+	return b
+}
+
+func (r *payloadReader) uint32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (r *payloadReader) int64() int64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	return int64(binary.LittleEndian.Uint64(b))
+}
+
+func (r *payloadReader) string8() string {
+	size := r.next(1)
+	if size == nil {
+		return ""
+	}
+	return string(r.next(int(size[0])))
+}
+
+func (r *payloadReader) string() string {
+	if !r.varint {
+		return r.string8()
+	}
+	if r.err != nil {
+		return ""
+	}
+
+	size, n := binary.Uvarint(r.payload)
+	if n <= 0 || size > uint64(len(r.payload)-n) {
+		r.err = errMalformed
+		return ""
+	}
+	r.payload = r.payload[n:]
+
+	return string(r.next(int(size)))
+}
+
+func (r *payloadReader) labels() map[string]string {
+	count := r.next(1)
+	if count == nil || count[0] == 0 {
+		return nil
+	}
+
+	labels := make(map[string]string, count[0])
+	for i := byte(0); i < count[0] && r.err == nil; i++ {
+		name := r.string8()
+		labels[name] = r.string8()
+	}
+	return labels
+}
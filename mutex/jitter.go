@@ -0,0 +1,63 @@
+package mutex
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// WithRetryJitter spreads each retry delay randomly by up to the factor of the
+// delay in both directions, so the clients failing together do not retry
+// together. The factor is capped at 1.
+func WithRetryJitter(factor float64) Option {
+	return func(o *options) {
+		if factor > 1 {
+			factor = 1
+		}
+		o.jitter = factor
+	}
+}
+
+// WithRandSource sets the random source of the retry jitter in place of the one
+// seeded by the time, so the delays are reproducible in the tests and the
+// simulations. The source is only used by the client.
+func WithRandSource(source rand.Source) Option {
+	return func(o *options) {
+		o.randSource = source
+	}
+}
+
+// WithRandSeed is WithRandSource of the source seeded by the seed
+func WithRandSeed(seed int64) Option {
+	return WithRandSource(rand.NewSource(seed))
+}
+
+// jitterSource guards the random source which is not safe for concurrent use
+type jitterSource struct {
+	mutex sync.Mutex
+	rand  *rand.Rand
+}
+
+func newJitterSource(source rand.Source) *jitterSource {
+	if source == nil {
+		source = rand.NewSource(time.Now().UnixNano())
+	}
+	return &jitterSource{rand: rand.New(source)}
+}
+
+func (j *jitterSource) float64() float64 {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return j.rand.Float64()
+}
+
+func (l *lockingCenter) jittered(delay time.Duration) time.Duration {
+	factor := l.options.jitter
+	if factor <= 0 || delay <= 0 {
+		return delay
+	}
+
+	spread := float64(delay) * factor
+	return delay + time.Duration(spread*(2*l.jitter.float64()-1))
+}
@@ -0,0 +1,96 @@
+package mutex
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const defaultKeySeparator = "/"
+
+// KeyBuilder joins the segments of the composite keys with the separator, "/"
+// when it is empty. The separator and "%" are percent escaped in the values,
+// so the segments can not run into each other. The prefix segments are put in
+// front of every key of the builder.
+type KeyBuilder struct {
+	Separator string
+	Prefix    []interface{}
+}
+
+// Key formats the segments, which are strings, Keyer and fmt.Stringer types,
+// integers or booleans, and validates the result.
+func (b KeyBuilder) Key(segments ...interface{}) (string, error) {
+	separator := b.Separator
+	if len(separator) == 0 {
+		separator = defaultKeySeparator
+	}
+
+	escaper := strings.NewReplacer("%", "%25", separator, escapeSeparator(separator))
+
+	parts := make([]string, 0, len(b.Prefix)+len(segments))
+	for _, segment := range append(append([]interface{}{}, b.Prefix...), segments...) {
+		s, err := keySegment(segment)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, escaper.Replace(s))
+	}
+
+	key := strings.Join(parts, separator)
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// MustKey is Key panicking on the invalid keys, for the keys built from the
+// constant segments.
+func (b KeyBuilder) MustKey(segments ...interface{}) string {
+	key, err := b.Key(segments...)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// With returns a builder extending the prefix with the segments.
+func (b KeyBuilder) With(segments ...interface{}) KeyBuilder {
+	prefix := make([]interface{}, 0, len(b.Prefix)+len(segments))
+	prefix = append(append(prefix, b.Prefix...), segments...)
+
+	return KeyBuilder{Separator: b.Separator, Prefix: prefix}
+}
+
+func escapeSeparator(separator string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(separator); i++ {
+		_, _ = fmt.Fprintf(&escaped, "%%%02X", separator[i])
+	}
+	return escaped.String()
+}
+
+func keySegment(segment interface{}) (string, error) {
+	switch v := segment.(type) {
+	case string:
+		return v, nil
+	case Keyer:
+		return v.Key(), nil
+	case fmt.Stringer:
+		return v.String(), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("unsupported key segment type %T", segment)
+}
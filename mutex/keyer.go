@@ -0,0 +1,70 @@
+package mutex
+
+import (
+	"context"
+	"sync"
+)
+
+// Keyer is a domain type naming its own lock key, like an order or a tenant
+// identifier.
+type Keyer interface {
+	Key() string
+}
+
+// Keyed is the view of the client taking the Keyer types as the keys, so the
+// call sites can not pass an arbitrary string by mistake.
+type Keyed struct {
+	lc LockingCenter
+}
+
+func NewKeyed(lc LockingCenter) Keyed {
+	return Keyed{lc: lc}
+}
+
+func (k Keyed) Lock(key Keyer) error {
+	return k.lc.Lock(key.Key())
+}
+
+func (k Keyed) LockContext(ctx context.Context, key Keyer) error {
+	return k.lc.LockContext(ctx, key.Key())
+}
+
+func (k Keyed) Unlock(key Keyer) error {
+	return k.lc.Unlock(key.Key())
+}
+
+func (k Keyed) LockAll(keys ...Keyer) error {
+	return k.lc.LockAll(keyStrings(keys), nil)
+}
+
+func (k Keyed) UnlockAll(keys ...Keyer) error {
+	return k.lc.UnlockAll(keyStrings(keys))
+}
+
+func (k Keyed) WaitContext(ctx context.Context, key Keyer) error {
+	return k.lc.WaitContext(ctx, key.Key())
+}
+
+func (k Keyed) IsLocked(key Keyer) (bool, error) {
+	return k.lc.IsLocked(key.Key())
+}
+
+func (k Keyed) WithLock(ctx context.Context, key Keyer, fn func() error) error {
+	return k.lc.WithLock(ctx, key.Key(), fn)
+}
+
+func (k Keyed) Locker(key Keyer) sync.Locker {
+	return k.lc.Locker(key.Key())
+}
+
+func (k Keyed) ResetByKey(key Keyer) error {
+	return k.lc.ResetByKey(key.Key())
+}
+
+func keyStrings(keys []Keyer) []string {
+	strs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		strs = append(strs, key.Key())
+	}
+	return strs
+}
@@ -0,0 +1,121 @@
+package mutex
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	maxKeySize         = 128
+	namespaceSeparator = "/"
+)
+
+var ErrKeyInvalid = errors.New("invalid key")
+
+// KeyError is the rejection of a key by the client before it is sent to the
+// server, it unwraps to ErrKeyInvalid.
+type KeyError struct {
+	Key   string
+	limit int
+}
+
+func (e *KeyError) Error() string {
+	limit := e.limit
+	if limit == 0 {
+		limit = maxKeySize
+	}
+	return fmt.Sprintf("key can not be empty or more than %d characters", limit)
+}
+
+func (e *KeyError) Unwrap() error {
+	return ErrKeyInvalid
+}
+
+func ValidateKey(key string) error {
+	if len(key) == 0 || len(key) > maxKeySize {
+		return &KeyError{Key: key}
+	}
+	return nil
+}
+
+type KeyNormalizer struct {
+	TrimSpace   bool
+	Lowercase   bool
+	Disallowed  string
+	Replacement rune
+}
+
+func (n KeyNormalizer) Normalize(key string) string {
+	if n.TrimSpace {
+		key = strings.TrimSpace(key)
+	}
+	if n.Lowercase {
+		key = strings.ToLower(key)
+	}
+	if len(n.Disallowed) == 0 {
+		return key
+	}
+
+	replacement := n.Replacement
+	if replacement == 0 {
+		replacement = '_'
+	}
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(n.Disallowed, r) {
+			return replacement
+		}
+		return r
+	}, key)
+}
+
+func WithKeyNormalizer(normalizer KeyNormalizer) Option {
+	return func(o *options) {
+		o.normalizer = &normalizer
+	}
+}
+
+func (o options) normalize(key string) string {
+	if o.normalizer == nil {
+		return key
+	}
+	return o.normalizer.Normalize(key)
+}
+
+// BytesKey converts a binary identifier to a lock key. Keys travel on the wire
+// as raw bytes and their limit is counted in bytes, so 128 bytes of a binary key
+// can be used as they are without any encoding.
+func BytesKey(key []byte) string {
+	return string(key)
+}
+
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+func WithLongKeyHashing() Option {
+	return func(o *options) {
+		o.hashLongKeys = true
+	}
+}
+
+func (o options) qualify(key string) string {
+	if len(o.namespace) == 0 {
+		return key
+	}
+	return o.namespace + namespaceSeparator + key
+}
+
+func (o options) encodeKey(key string) string {
+	qualified := o.qualify(key)
+	if len(qualified) <= maxKeySize || !o.hashLongKeys {
+		return qualified
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	return o.qualify(hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,36 @@
+package mutex
+
+import (
+	"context"
+	"runtime/pprof"
+	"strings"
+)
+
+// WithProfilerLabels labels the goroutines blocked in the lock and the passive
+// wait operations with the action and the first segment of the key, up to the
+// "/" separator, so the goroutine and the cpu profiles show the keys the
+// application is waiting for.
+func WithProfilerLabels() Option {
+	return func(o *options) {
+		o.profilerLabels = true
+	}
+}
+
+func (l *lockingCenter) labelled(ctx context.Context, action mutexAction, key string, fn func(ctx context.Context) error) error {
+	if !l.options.profilerLabels || (action != maLock && action != maObserve) {
+		return fn(ctx)
+	}
+
+	var err error
+	pprof.Do(ctx, pprof.Labels("lock_action", action.String(), "lock_key", keyPrefix(key)), func(ctx context.Context) {
+		err = fn(ctx)
+	})
+	return err
+}
+
+func keyPrefix(key string) string {
+	if i := strings.Index(key, defaultKeySeparator); i > 0 {
+		return key[:i]
+	}
+	return key
+}
@@ -0,0 +1,88 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	latchProbeTimeout = time.Millisecond * 250
+	latchPollInterval = time.Millisecond * 100
+)
+
+// Latch opens once its count is counted down to zero by the parties. A count
+// down is the lock of one of the count keys of the latch, it is held by the
+// client of the party until the latch is reset, so the client should not be
+// closed before the waiters have passed.
+type Latch struct {
+	lc    LockingCenter
+	key   string
+	count int
+}
+
+func NewLatch(lc LockingCenter, key string, count int) *Latch {
+	if count < 1 {
+		count = 1
+	}
+
+	return &Latch{
+		lc:    lc,
+		key:   key,
+		count: count,
+	}
+}
+
+func (l *Latch) countKey(index int) string {
+	return fmt.Sprintf("%s:c:%d", l.key, index)
+}
+
+// CountDown takes the first free count key, it does nothing when the latch is
+// already open.
+func (l *Latch) CountDown(ctx context.Context) error {
+	for i := 0; i < l.count; i++ {
+		lockCtx, cancel := context.WithTimeout(ctx, latchProbeTimeout)
+		err := l.lc.LockContext(lockCtx, l.countKey(i))
+		cancel()
+
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Wait blocks until the latch is open.
+func (l *Latch) Wait(ctx context.Context) error {
+	for i := 0; i < l.count; i++ {
+		for {
+			locked, err := probe(ctx, l.lc, l.countKey(i), latchProbeTimeout)
+			if err != nil {
+				return err
+			}
+			if locked {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-after(l.lc.Clock(), latchPollInterval):
+			}
+		}
+	}
+	return nil
+}
+
+// Reset releases the count keys so the latch can be counted down again.
+func (l *Latch) Reset() error {
+	keys := make([]string, 0, l.count)
+	for i := 0; i < l.count; i++ {
+		keys = append(keys, l.countKey(i))
+	}
+	return l.lc.ResetKeys(keys)
+}
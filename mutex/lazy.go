@@ -0,0 +1,68 @@
+package mutex
+
+import "errors"
+
+// WithLazyConnect creates the client without connecting to the server. The
+// first operation or Ping connects, negotiates and starts the session instead,
+// and their failures are returned by it. The address is still resolved by
+// the constructor and the source address can not be detected automatically.
+func WithLazyConnect() Option {
+	return func(o *options) {
+		o.lazyConnect = true
+	}
+}
+
+// lazySourceAddr sets the source address not depending on a connection
+func (l *lockingCenter) lazySourceAddr() error {
+	if l.sourceAddr == nil && l.options.sourceIdentity == nil && l.options.autoSourceAddr {
+		return errors.New("source address can not be detected with the lazy connect")
+	}
+	l.detectSourceAddr(nil)
+
+	return nil
+}
+
+// prepare completes the setup of the lazily connected client on its first
+// connection, the next operations try again when it fails
+func (l *lockingCenter) prepare() error {
+	if !l.options.lazyConnect {
+		return nil
+	}
+
+	l.setupMutex.Lock()
+	defer l.setupMutex.Unlock()
+
+	if l.prepared {
+		return nil
+	}
+	if err := l.ping(); err != nil {
+		return err
+	}
+	if len(l.options.session) > 0 {
+		if err := l.startSession(); err != nil {
+			return err
+		}
+	}
+	l.prepared = true
+
+	return nil
+}
+
+// Ping connects to the server to check that it is reachable.
+func (l *lockingCenter) Ping() error {
+	if l.isAborted() {
+		return ErrClosed
+	}
+	if l.options.dryRun != nil {
+		return nil
+	}
+	if err := l.prepare(); err != nil {
+		return err
+	}
+
+	conn, err := l.connect()
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,138 @@
+package mutex
+
+import (
+	"sync"
+	"time"
+)
+
+type LeasedLock struct {
+	lc    Locker
+	key   string
+	lease time.Duration
+
+	gate chan struct{}
+
+	mutex   sync.Mutex
+	locked  bool // the gate is taken by Lock until Unlock
+	held    bool
+	expires time.Time
+	timer   Timer
+}
+
+func NewLeasedLock(lc Locker, key string, lease time.Duration) *LeasedLock {
+	return &LeasedLock{
+		lc:    lc,
+		key:   key,
+		lease: lease,
+		gate:  make(chan struct{}, 1),
+	}
+}
+
+func (l *LeasedLock) Lock() error {
+	l.gate <- struct{}{}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+
+	if l.held && l.lc.Clock().Now().Before(l.expires) {
+		l.locked = true
+		return nil
+	}
+
+	if l.held {
+		// lease boundary, give the queued holders on the server a chance
+		if err := l.lc.Unlock(l.key); err != nil {
+			<-l.gate
+			return err
+		}
+		l.held = false
+	}
+
+	if err := l.lc.Lock(l.key); err != nil {
+		<-l.gate
+		return err
+	}
+	l.held = true
+	l.locked = true
+	l.expires = l.lc.Clock().Now().Add(l.lease)
+
+	return nil
+}
+
+// Unlock returns ErrNotHeld when the lock is not locked by Lock.
+func (l *LeasedLock) Unlock() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if !l.locked {
+		return ErrNotHeld
+	}
+	l.locked = false
+	defer func() { <-l.gate }()
+
+	if !l.held {
+		return nil
+	}
+
+	clock := l.lc.Clock()
+	remaining := l.expires.Sub(clock.Now())
+	if remaining > 0 {
+		l.timer = clock.AfterFunc(remaining, l.expire)
+		return nil
+	}
+
+	if err := l.lc.Unlock(l.key); err != nil {
+		return err
+	}
+	l.held = false
+
+	return nil
+}
+
+func (l *LeasedLock) Release() error {
+	l.gate <- struct{}{}
+	defer func() { <-l.gate }()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.release()
+}
+
+func (l *LeasedLock) expire() {
+	select {
+	case l.gate <- struct{}{}:
+	default:
+		// locally held, the next Unlock will take care of the lease
+		return
+	}
+	defer func() { <-l.gate }()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	_ = l.release()
+}
+
+func (l *LeasedLock) release() error {
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+
+	if !l.held {
+		return nil
+	}
+
+	if err := l.lc.Unlock(l.key); err != nil {
+		return err
+	}
+	l.held = false
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package mutex
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RateLimiter enforces a call rate shared by the clients of the key. Every call
+// locks one of the burst token keys and keeps it for the window of burst/rate,
+// so at most burst calls start in any window across the fleet.
+type RateLimiter struct {
+	lc     Locker
+	key    string
+	window time.Duration
+	free   chan int
+}
+
+func NewRateLimiter(lc Locker, key string, rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	free := make(chan int, burst)
+	for slot := 0; slot < burst; slot++ {
+		free <- slot
+	}
+
+	return &RateLimiter{
+		lc:     lc,
+		key:    key,
+		window: time.Duration(float64(burst) / rate * float64(time.Second)),
+		free:   free,
+	}
+}
+
+func (r *RateLimiter) tokenKey(slot int) string {
+	return fmt.Sprintf("%s:t:%d", r.key, slot)
+}
+
+// Wait returns once the call is allowed or the context is done.
+func (r *RateLimiter) Wait(ctx context.Context) error {
+	var slot int
+	select {
+	case slot = <-r.free:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	key := r.tokenKey(slot)
+	if err := r.lc.LockContext(ctx, key); err != nil {
+		r.free <- slot
+		return err
+	}
+
+	r.lc.Clock().AfterFunc(r.window, func() {
+		_ = r.lc.Unlock(key)
+		r.free <- slot
+	})
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package mutex
+
+import (
+	"fmt"
+	"sync"
+)
+
+type LockerErrorHandler func(key string, err error)
+
+func WithLockerErrorHandler(handler LockerErrorHandler) Option {
+	return func(o *options) {
+		o.lockerErrorHandler = handler
+	}
+}
+
+func panicOnLockerError(key string, err error) {
+	panic(fmt.Sprintf("locker of key %s failed: %s", key, err))
+}
+
+type keyLocker struct {
+	lc      *lockingCenter
+	key     string
+	handler LockerErrorHandler
+}
+
+func (l *lockingCenter) Locker(key string) sync.Locker {
+	return &keyLocker{
+		lc:      l,
+		key:     key,
+		handler: l.options.lockerErrorHandler,
+	}
+}
+
+func (k *keyLocker) Lock() {
+	if err := k.lc.Lock(k.key); err != nil {
+		k.handler(k.key, err)
+	}
+}
+
+func (k *keyLocker) Unlock() {
+	if err := k.lc.Unlock(k.key); err != nil {
+		k.handler(k.key, err)
+	}
+}
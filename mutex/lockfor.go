@@ -0,0 +1,114 @@
+package mutex
+
+import (
+	"context"
+	"time"
+)
+
+// ForcedReleaseHandler is warned of a lock of LockFor about to be released by
+// the client
+type ForcedReleaseHandler func(lock HeldLock)
+
+// WithForcedReleaseWarning calls the handler margin before a lock of LockFor is
+// released by the client. A warning is logged a tenth of the bound before the
+// release by default.
+func WithForcedReleaseWarning(margin time.Duration, handler ForcedReleaseHandler) Option {
+	return func(o *options) {
+		o.forcedReleaseMargin = margin
+		o.forcedReleaseHandler = handler
+	}
+}
+
+// LockFor locks the key for at most maxHold. The client releases the lock once
+// maxHold passes without its unlock, even when the caller has forgotten it or
+// hangs, so a stuck holder can not block the fleet. The late unlock of a
+// released lock returns ErrNotHeld by WithStrictUnlock, instead of releasing
+// the lock of its next holder.
+func (l *lockingCenter) LockFor(key string, maxHold time.Duration) error {
+	if err := l.Lock(key); err != nil {
+		return err
+	}
+	if maxHold > 0 {
+		l.timebox(l.options.normalize(key), maxHold)
+	}
+	return nil
+}
+
+// timebox arms the warning and the release of the held key
+func (l *lockingCenter) timebox(key string, maxHold time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	h, has := l.held[key]
+	if !has {
+		return
+	}
+	h.maxHold = maxHold
+
+	margin := l.options.forcedReleaseMargin
+	if margin <= 0 {
+		margin = maxHold / 10
+	}
+	if margin > 0 && margin < maxHold {
+		h.timers = append(h.timers, l.options.clock.AfterFunc(maxHold-margin, func() { l.warnRelease(key, h) }))
+	}
+	h.timers = append(h.timers, l.options.clock.AfterFunc(maxHold, func() { l.forceRelease(key, h) }))
+}
+
+// holding returns the lock of the acquisition when it is still held
+func (l *lockingCenter) holding(key string, h *heldLock) (HeldLock, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if current, has := l.held[key]; !has || current != h || h.releasing {
+		return HeldLock{}, false
+	}
+	return l.heldLock(key, h), true
+}
+
+func (l *lockingCenter) warnRelease(key string, h *heldLock) {
+	defer l.rescue("forced release warning")
+
+	lock, held := l.holding(key, h)
+	if !held {
+		return
+	}
+
+	if l.options.forcedReleaseHandler != nil {
+		l.options.forcedReleaseHandler(lock)
+		return
+	}
+	l.logf("WARN: lock %s is released by the client in %s\n", key, (lock.MaxHold - lock.HeldFor()).Round(time.Millisecond))
+}
+
+func (l *lockingCenter) forceRelease(key string, h *heldLock) {
+	defer l.rescue("forced release")
+
+	l.mutex.Lock()
+	current, has := l.held[key]
+	if !has || current != h || h.releasing {
+		l.mutex.Unlock()
+		return
+	}
+	h.releasing = true
+	lock := l.heldLock(key, h)
+	l.mutex.Unlock()
+
+	l.logf("WARN: lock %s has reached its bound of %s, releasing it\n", key, lock.MaxHold)
+	if err := l.execute(context.Background(), maUnlock, key, nil); err != nil {
+		l.logf("WARN: forced release error: %s\n", err)
+
+		l.mutex.Lock()
+		h.releasing = false
+		l.mutex.Unlock()
+	}
+}
+
+// stopTimers stops the timers of the acquisition, it should be called holding
+// the mutex
+func (h *heldLock) stopTimers() {
+	for _, t := range h.timers {
+		t.Stop()
+	}
+	h.timers = nil
+}
@@ -0,0 +1,33 @@
+package mutex
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+type stdoutLogger struct{}
+
+func (stdoutLogger) Printf(format string, v ...interface{}) {
+	fmt.Printf(format, v...)
+}
+
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		if logger != nil {
+			o.logger = logger
+		}
+	}
+}
+
+func (l *lockingCenter) logf(format string, v ...interface{}) {
+	l.options.logger.Printf(format, v...)
+
+	if l.events != nil {
+		message := strings.TrimPrefix(strings.TrimSuffix(fmt.Sprintf(format, v...), "\n"), "WARN: ")
+		l.debug(DebugEvent{Kind: DebugWarning, Message: message})
+	}
+}
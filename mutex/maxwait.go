@@ -0,0 +1,44 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+// maxWait returns the wait left to the lock by the deadline of its context,
+// sent to the servers agreeing on the max wait so they expire its place in the
+// queue themselves instead of granting the lock its caller has given up
+func (l *lockingCenter) maxWait(ctx context.Context) time.Duration {
+	deadline, has := ctx.Deadline()
+	if !has || !l.sendsMaxWait() {
+		return 0
+	}
+	if wait := time.Until(deadline); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// sendsMaxWait reports if the server has agreed on receiving the max waits of
+// the locks, they are only encoded in the v2 frames
+func (l *lockingCenter) sendsMaxWait() bool {
+	return l.framesV2() && l.agrees(wire.CapMaxWait)
+}
+
+// expiredInQueue reports if the lock is rejected by the server for its max
+// wait, which passes with the deadline of its context
+func (l *lockingCenter) expiredInQueue(ctx context.Context, err error) bool {
+	deadline, has := ctx.Deadline()
+	if !has || !l.sendsMaxWait() || time.Until(deadline) > time.Millisecond {
+		return false
+	}
+
+	var serverErr *ServerError
+	if errors.As(err, &serverErr) {
+		return serverErr.Code == wire.CodeExpired
+	}
+	return err == ErrServerRejected
+}
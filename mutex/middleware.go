@@ -0,0 +1,70 @@
+package mutex
+
+import (
+	"context"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+type Operation func(ctx context.Context, req wire.Request) error
+
+type Middleware func(next Operation) Operation
+
+// WithMiddleware wraps the lock, unlock, wait and reset operations of the
+// client. The first middleware is the outermost one and sees the key before it
+// is normalized.
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(o *options) {
+		o.middlewares = append(o.middlewares, middlewares...)
+	}
+}
+
+func (l *lockingCenter) execute(ctx context.Context, action mutexAction, key string, sourceAddr *string) (err error) {
+	defer l.recovered(&err)
+
+	if l.options.crossesTenant(action) {
+		return ErrCrossNamespace
+	}
+
+	ctx, cancel := l.actionContext(ctx, action)
+	defer cancel()
+
+	if action == maLock {
+		if err := l.await(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	return l.labelled(ctx, action, key, func(ctx context.Context) error {
+		return l.perform(ctx, action, key, sourceAddr)
+	})
+}
+
+func (l *lockingCenter) perform(ctx context.Context, action mutexAction, key string, sourceAddr *string) error {
+	id := l.requestID(action)
+	started := l.options.clock.Now()
+	if len(l.options.middlewares) == 0 {
+		return l.done(action, key, started, l.failure(id, l.run(ctx, action, key, sourceAddr, id)))
+	}
+
+	operation := Operation(func(ctx context.Context, req wire.Request) error {
+		return l.run(ctx, mutexAction(req.Action), req.Key, req.SourceAddr, req.ID)
+	})
+	for i := len(l.options.middlewares) - 1; i >= 0; i-- {
+		operation = l.options.middlewares[i](operation)
+	}
+
+	return l.done(action, key, started, l.failure(id, operation(ctx, wire.Request{Action: wire.Action(action), ID: id, Key: key, SourceAddr: sourceAddr})))
+}
+
+// done counts the completed operation and keeps its debug event
+func (l *lockingCenter) done(action mutexAction, key string, started time.Time, err error) error {
+	duration := since(l.options.clock, started)
+	if action == maLock && err == nil {
+		l.observeAcquire(key, duration)
+	}
+
+	l.debug(DebugEvent{Kind: DebugOperation, Action: wire.Action(action), Key: key, Duration: duration, Err: err})
+	return l.count(err)
+}
@@ -0,0 +1,53 @@
+package mutex
+
+import (
+	"context"
+	"sort"
+)
+
+// canonicalKeys normalizes the keys before deduping and sorting them, so the
+// keys equal after WithKeyNormalizer are only locked once
+func canonicalKeys(keys []string, normalize func(string) string) []string {
+	sorted := make([]string, 0, len(keys))
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		key = normalize(key)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+func (l *lockingCenter) LockAll(keys []string, sourceAddr *string) error {
+	if sourceAddr == nil {
+		sourceAddr = l.sourceAddr
+	}
+
+	sorted := canonicalKeys(keys, l.options.normalize)
+	for i, key := range sorted {
+		if err := l.execute(context.Background(), maLock, key, sourceAddr); err != nil {
+			_ = l.unlockAll(sorted[:i])
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *lockingCenter) UnlockAll(keys []string) error {
+	return l.unlockAll(canonicalKeys(keys, l.options.normalize))
+}
+
+func (l *lockingCenter) unlockAll(sorted []string) error {
+	var lastErr error
+	for i := len(sorted) - 1; i >= 0; i-- {
+		if err := l.Unlock(sorted[i]); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
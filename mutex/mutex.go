@@ -2,11 +2,15 @@ package mutex
 
 import (
 	"bytes"
-	"encoding/binary"
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
 )
 
 type mutexAction byte
@@ -16,213 +20,974 @@ const (
 	maUnlock        mutexAction = 2
 	maResetByKey    mutexAction = 3
 	maResetBySource mutexAction = 4
+	maAbandon       mutexAction = 5
+	maObserve       mutexAction = 6
+	maWatch         mutexAction = 7
+	maQueuePosition mutexAction = 8
+	maStatus        mutexAction = 9
+	maList          mutexAction = 10
+	maResetAll      mutexAction = 11
+	maSession       mutexAction = 13
+	maStats         mutexAction = 14
+	maMultiplex     mutexAction = 16
 )
 
-var queueRetryDuration = time.Millisecond * 500
+func (a mutexAction) String() string {
+	switch a {
+	case maLock:
+		return "locking"
+	case maUnlock:
+		return "unlocking"
+	case maResetByKey, maResetBySource, maResetAll:
+		return "reseting"
+	case maAbandon:
+		return "abandoning"
+	case maObserve:
+		return "observing"
+	case maWatch:
+		return "watching"
+	case maQueuePosition, maStatus, maList, maStats:
+		return "querying"
+	case maSession:
+		return "registering"
+	case maMultiplex:
+		return "multiplexing"
+	}
+	return "unknown"
+}
+
+func (a mutexAction) hasKey() bool {
+	return wire.Action(a).HasKey()
+}
+
+func (a mutexAction) hasSource() bool {
+	return wire.Action(a).HasSource()
+}
+
+// releases reports if the action frees the keys, so it is not starved of the
+// connections by the locks waiting for them
+func (a mutexAction) releases() bool {
+	switch a {
+	case maUnlock, maResetByKey, maResetBySource, maResetAll, maAbandon:
+		return true
+	}
+	return false
+}
+
+var ErrClosed = errors.New("locking center client is closed")
+
+var ErrNotSupported = errors.New("operation is not supported by the server")
+
+var ErrServerRejected = errors.New("remote server execution error")
+
+var ErrPermissionDenied = errors.New("operation is denied by the server")
+
+var ErrConnUnavailable = errors.New("connection to the server is not available")
+
+var errMalformed = wire.ErrMalformed
+
+// withdrawTimeout bounds the wait for the answer of an abandoned lock
+const withdrawTimeout = time.Second
+
+// ConnError is the failure of connecting to the server, it matches
+// ErrConnUnavailable and unwraps to the dial error.
+type ConnError struct {
+	Addr string
+	Err  error
+}
+
+func (e *ConnError) Error() string {
+	return fmt.Sprintf("unable to connect to %s: %s", e.Addr, e.Err)
+}
+
+func (e *ConnError) Is(target error) bool {
+	return target == ErrConnUnavailable
+}
+
+func (e *ConnError) Unwrap() error {
+	return e.Err
+}
+
+// IsRetryable reports if the failure is transient, like a connection failure,
+// and the operation may succeed when it is tried again. The invalid requests,
+// the rejections of the server and its malformed responses are permanent.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var deadlock *DeadlockError
+	var order *LockOrderError
+	if errors.As(err, &deadlock) || errors.As(err, &order) {
+		return false
+	}
+
+	for _, permanent := range []error{
+		ErrClosed,
+		ErrPoolExhausted,
+		ErrTooManyInFlight,
+		ErrNotSupported,
+		ErrNotOwner,
+		ErrUnauthenticated,
+		ErrPermissionDenied,
+		ErrCrossNamespace,
+		ErrQuotaExceeded,
+		ErrServerRejected,
+		ErrKeyInvalid,
+		wire.ErrKeySize,
+		wire.ErrSourceAddrSize,
+		wire.ErrMalformed,
+		context.Canceled,
+		context.DeadlineExceeded,
+	} {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+	return true
+}
 
+// LockingCenter is safe for concurrent use by multiple goroutines. An
+// operation has the connection to itself until it completes, and the shared
+// state of the client, including the pool, is guarded by its mutex.
 type LockingCenter interface {
-	Lock(key string)
-	Unlock(key string)
-	Wait(key string)
+	Locker
+	Admin
+	Observer
 
-	ResetByKey(key string)
-	ResetBySource(sourceAddr *string)
+	Batch(ctx context.Context, operations ...BatchOperation) ([]error, error)
+	Bulk(ctx context.Context, window int) (BulkSession, error)
+	Pipeline(ctx context.Context, batch int) (Pipeline, error)
+
+	Warmup(n int) error
+
+	ReleaseAll(ctx context.Context) error
+	Drain(ctx context.Context) *ShutdownReport
+	Close() *ShutdownReport
+}
+
+// Locker acquires and releases the keys and waits for them, the surface the
+// critical sections and the primitives need
+type Locker interface {
+	Lock(key string) error
+	LockContext(ctx context.Context, key string) error
+	LockFor(key string, maxHold time.Duration) error
+	LockAsync(ctx context.Context, key string, sourceAddr *string) <-chan error
+	Unlock(key string) error
+	LockOwned(ctx context.Context, key string) (string, error)
+	UnlockOwned(key string, token string) error
+	LockAll(keys []string, sourceAddr *string) error
+	UnlockAll(keys []string) error
+	Wait(key string) error
+	WaitTimeout(key string, d time.Duration) error
+	WaitContext(ctx context.Context, key string) error
+	PassiveWait(key string) error
+	WaitAll(ctx context.Context, keys ...string) error
+	WaitAny(ctx context.Context, keys ...string) (string, error)
+	WithLock(ctx context.Context, key string, fn func() error) error
+	Locker(key string) sync.Locker
+	Clock() Clock
+}
+
+// Admin releases the locks of the other holders
+type Admin interface {
+	Steal(key string, olderThan time.Duration) error
+	ResetByKey(key string) error
+	ResetBySource(sourceAddr *string) error
+	ResetKeys(keys []string) error
+	ResetByPrefix(prefix string) error
+	ResetAll() error
+}
+
+// Observer queries the state of the keys on the server and of the client
+// without changing it
+type Observer interface {
+	Watch(key string) (<-chan LockEvent, func())
+	QueuePosition(key string) (int, error)
+	IsLocked(key string) (bool, error)
+	ListLocks() ([]LockInfo, error)
+	LocksBySource(sourceAddr string) ([]LockInfo, error)
+	Stats(top int) (KeyspaceStats, error)
+
+	HeldLocks() []HeldLock
+	DebugEvents() []DebugEvent
+	LatencyHistograms() []PatternLatency
+	DumpState() ([]byte, error)
+
+	Ping() error
+	ServerInfo() (Info, error)
 }
 
 type lockingCenter struct {
-	address    *net.TCPAddr
+	network    string
+	address    string
+	host       string
+	endpoints  *endpointSet
 	sourceAddr *string
+	options    options
+
+	mutex    sync.Mutex
+	closed   bool
+	aborted  bool
+	abort    chan struct{}
+	inFlight sync.WaitGroup
+	pending  map[*operation]struct{}
+	conns    map[net.Conn]struct{}
+	held     map[string]*heldLock
+	waiting  map[int64]string
+	gates    map[string]*keyGate
+	pool     *connPool
+	limiter  *rateLimiter
+	slots    chan struct{}
+	backoffs map[string]time.Duration
+	jitter   *jitterSource
+	counters counters
+	events   *eventRing
+
+	latencies *latencyHistograms
+	// the retries shared by the operations
+	retryBudget *rateLimiter
+
+	credentials *credentialsCache
+	quota       *quotaState
+
+	// the replica of the next query
+	replicaTurn uint32
+
+	// the protocol agreed with the server, nil without the negotiation
+	peer atomic.Value
+
+	// the first connection of the lazily connected client
+	setupMutex sync.Mutex
+	prepared   bool
+
+	session net.Conn
+	mux     *muxConn
+}
+
+type operation struct {
+	action mutexAction
+	key    string
 }
 
-func NewLockingCenter(address string) (LockingCenter, error) {
-	return NewLockingCenterWithSourceAddr(address, nil)
+func NewLockingCenter(address string, opts ...Option) (LockingCenter, error) {
+	return NewLockingCenterWithSourceAddr(address, nil, opts...)
 }
 
-func NewLockingCenterWithSourceAddr(address string, sourceAddr *string) (LockingCenter, error) {
-	addr, err := net.ResolveTCPAddr("tcp", address)
+func NewLockingCenterWithSourceAddr(address string, sourceAddr *string, opts ...Option) (LockingCenter, error) {
+	network := "tcp"
+	if isURI(address) {
+		e, err := parseURI(address)
+		if err != nil {
+			return nil, err
+		}
+		network, address = e.network, e.address
+		if sourceAddr == nil {
+			sourceAddr = e.sourceAddr
+		}
+		opts = append(e.opts, opts...)
+	}
+
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	addr, host, err := o.resolveAddr(network, address)
 	if err != nil {
 		return nil, err
 	}
+	if err := o.validateHoldBounds(); err != nil {
+		return nil, err
+	}
+	if err := o.validateLatencyPatterns(); err != nil {
+		return nil, err
+	}
+	if o.sourceIdentity, err = o.sourceIdentityOf(); err != nil {
+		return nil, err
+	}
+	if err := wire.ValidateLabels(o.clientLabels); err != nil {
+		return nil, err
+	}
+	if err := o.validateTenant(); err != nil {
+		return nil, err
+	}
 
 	lc := &lockingCenter{
-		address:    addr,
-		sourceAddr: sourceAddr,
+		network:     network,
+		address:     addr,
+		host:        host,
+		sourceAddr:  sourceAddr,
+		options:     o,
+		abort:       make(chan struct{}),
+		pending:     make(map[*operation]struct{}),
+		conns:       make(map[net.Conn]struct{}),
+		held:        make(map[string]*heldLock),
+		waiting:     make(map[int64]string),
+		gates:       make(map[string]*keyGate),
+		pool:        o.connPool(),
+		limiter:     newRateLimiter(o.rateLimit, o.rateBurst, o.clock),
+		retryBudget: newRetryBudget(o),
+		slots:       newInFlightSlots(o.maxInFlight),
+		backoffs:    make(map[string]time.Duration),
+		jitter:      newJitterSource(o.randSource),
+		events:      newEventRing(o.debugEvents),
+		latencies:   newLatencyHistograms(o),
+		credentials: newCredentialsCache(o),
 	}
-	if err := lc.ping(); err != nil {
+	if len(o.endpoints) > 0 && network == "tcp" {
+		if lc.endpoints, err = newEndpointSet(address, o); err != nil {
+			return nil, err
+		}
+	}
+	if len(o.session) > 0 {
+		id := o.session
+		lc.sourceAddr = &id
+	}
+	if o.lazyConnect || o.dryRun != nil {
+		if err := lc.lazySourceAddr(); err != nil {
+			return nil, err
+		}
+	} else if err := lc.ping(); err != nil {
+		return nil, err
+	}
+	if err := lc.publish(); err != nil {
 		return nil, err
 	}
+	if len(o.session) > 0 && !o.lazyConnect {
+		if err := lc.startSession(); err != nil {
+			return nil, err
+		}
+	}
+	lc.joinQuota()
+	if o.watchesHolds() {
+		go lc.watchHolds()
+	}
 	return lc, nil
 }
 
 func (l *lockingCenter) ping() error {
-	conn, err := net.DialTCP("tcp", nil, l.address)
+	conn, err := l.connect()
 	if err != nil {
 		return err
 	}
+	l.detectSourceAddr(conn)
+
+	if l.options.negotiate {
+		l.negotiate(conn)
+	}
+
 	return conn.Close()
 }
 
-func (l *lockingCenter) preparePackage(action mutexAction, key string, sourceAddr *string) ([]byte, error) {
-	if action != maResetBySource && len(key) == 0 || len(key) > 128 {
-		return nil, fmt.Errorf("key can not be empty or more than 128 characters")
+func (l *lockingCenter) connect() (net.Conn, error) {
+	conn, err := l.open()
+	if err != nil {
+		err = &ConnError{Addr: l.address, Err: err}
+		l.debug(DebugEvent{Kind: DebugConnect, Address: l.address, Err: err})
+		return nil, err
 	}
+	l.debug(DebugEvent{Kind: DebugConnect, Address: conn.RemoteAddr().String()})
+	return conn, nil
+}
 
-	data := make([]byte, 0)
-	buffer := bytes.NewBuffer(data)
+// open connects to the address of the client, or to the fallback addresses in
+// order when it fails
+func (l *lockingCenter) open() (net.Conn, error) {
+	if l.endpoints != nil {
+		return l.openEndpoint()
+	}
 
-	if err := binary.Write(buffer, binary.LittleEndian, action); err != nil {
+	conn, err := l.openAddr(l.network, l.address, l.host)
+	if err == nil || len(l.options.fallbacks) == 0 {
+		return conn, err
+	}
+
+	for _, address := range l.options.fallbacks {
+		host, _, splitErr := net.SplitHostPort(address)
+		if splitErr != nil {
+			return nil, splitErr
+		}
+		if conn, err = l.openAddr("tcp", address, host); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+func (l *lockingCenter) openAddr(network string, address string, host string) (net.Conn, error) {
+	conn, err := l.authAddr(network, address, host)
+	if err != nil {
 		return nil, err
 	}
+	return l.detail(conn)
+}
 
-	switch action {
-	case maLock, maUnlock, maResetByKey:
-		keySize := int8(len(key))
-		if err := binary.Write(buffer, binary.LittleEndian, keySize); err != nil {
+func (l *lockingCenter) authAddr(network string, address string, host string) (net.Conn, error) {
+	conn, err := l.dialAddr(network, address, host)
+	if err != nil || l.credentials == nil {
+		return conn, err
+	}
+
+	authenticated, err := l.authenticate(conn, false)
+	if err != ErrUnauthenticated {
+		return authenticated, err
+	}
+
+	// the token may be revoked before its expiry, and the server may hang up
+	// after the rejection
+	if conn, err = l.dialAddr(network, address, host); err != nil {
+		return nil, err
+	}
+	return l.authenticate(conn, true)
+}
+
+func (l *lockingCenter) dialAddr(network string, address string, host string) (net.Conn, error) {
+	conn, err := l.dialConn(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if tcpConn, ok := conn.(*net.TCPConn); ok && l.options.noDelay != nil {
+		if err := tcpConn.SetNoDelay(*l.options.noDelay); err != nil {
+			_ = conn.Close()
 			return nil, err
 		}
+	}
 
-		if err := binary.Write(buffer, binary.LittleEndian, []byte(key)); err != nil {
+	if l.options.tls != nil {
+		tlsConn, err := l.secure(conn, host, l.options.resolve().dialTimeout)
+		if err != nil {
+			_ = conn.Close()
 			return nil, err
 		}
+		conn = tlsConn
 	}
 
-	switch action {
-	case maLock, maResetBySource:
-		sourceAddrSize := int8(0)
-		if sourceAddr != nil {
-			sourceAddrSize = int8(len(*sourceAddr))
-		}
+	if l.options.faults != nil {
+		conn = l.options.faults.wrap(conn)
+	}
 
-		if err := binary.Write(buffer, binary.LittleEndian, sourceAddrSize); err != nil {
-			return nil, err
+	if l.options.wireDump {
+		conn = &dumpConn{Conn: conn, logger: l.options.logger}
+	}
+
+	return conn, nil
+}
+
+func (l *lockingCenter) dialConn(network string, address string) (net.Conn, error) {
+	timeout := l.options.boundedDialTimeout(l.options.resolve().dialTimeout)
+	if l.options.dialer != nil {
+		return l.options.dialer(address, timeout)
+	}
+
+	dialer := net.Dialer{Timeout: timeout, KeepAlive: l.options.keepAlive}
+	if l.options.dualStack != nil {
+		dialer.FallbackDelay = *l.options.dualStack
+	}
+	return dialer.Dial(network, address)
+}
+
+// framePool keeps the buffers of the request frames, a frame is at most the
+// action, the key and the source address with their sizes
+var framePool = sync.Pool{
+	New: func() interface{} {
+		return bytes.NewBuffer(make([]byte, 0, 3+maxKeySize+wire.MaxSourceAddrSize))
+	},
+}
+
+func (l *lockingCenter) preparePackage(buffer *bytes.Buffer, action mutexAction, key string, sourceAddr *string, id uint64, priority uint8, fairness Fairness, maxWait time.Duration, reason string) error {
+	if action.hasKey() {
+		if len(key) > 0 {
+			key = l.options.encodeKey(key)
 		}
 
-		if sourceAddr != nil {
-			if err := binary.Write(buffer, binary.LittleEndian, []byte(*sourceAddr)); err != nil {
-				return nil, err
-			}
+		if err := l.validateKey(key); err != nil {
+			return err
 		}
 	}
+	if err := l.options.confine(action, key); err != nil {
+		return err
+	}
 
-	return buffer.Bytes(), nil
+	req := wire.Request{Action: wire.Action(action), Key: key, SourceAddr: sourceAddr}
+	if l.framesV2() {
+		req.Version = 2
+	}
+	if l.sendsRequestID() || l.multiplexed() {
+		req.ID = id
+	}
+	if l.sendsPriority() {
+		req.Priority = priority
+	}
+	if l.sendsBarging() {
+		req.Barge = action == maLock && fairness == FairnessBarging
+	}
+	if action == maLock {
+		req.MaxWait = maxWait
+	}
+	if l.sendsLabels() {
+		req.Labels = l.options.lockLabels(action, reason)
+		req.ListLabels = action == maList
+	}
+
+	return wire.EncodeTo(buffer, req)
 }
 
-func (l *lockingCenter) query(conn *net.TCPConn, action mutexAction, key string, sourceAddr *string) error {
-	payload, err := l.preparePackage(action, key, sourceAddr)
-	if err != nil {
-		return err
+func (l *lockingCenter) query(conn net.Conn, action mutexAction, key string, sourceAddr *string, id uint64) error {
+	_, err := l.exchange(conn, action, key, sourceAddr, id, 0, FairnessFIFO, 0, "")
+	return err
+}
+
+func (l *lockingCenter) exchange(conn net.Conn, action mutexAction, key string, sourceAddr *string, id uint64, priority uint8, fairness Fairness, maxWait time.Duration, reason string) ([]byte, error) {
+	buffer := framePool.Get().(*bytes.Buffer)
+	defer func() {
+		buffer.Reset()
+		framePool.Put(buffer)
+	}()
+
+	if err := l.preparePackage(buffer, action, key, sourceAddr, id, priority, fairness, maxWait, reason); err != nil {
+		return nil, err
 	}
 
-	if _, err := conn.Write(payload); err != nil {
-		return err
+	if _, err := conn.Write(buffer.Bytes()); err != nil {
+		return nil, err
 	}
 
-	if !l.result(conn) {
-		return fmt.Errorf("remote server execution error")
+	resp, err := l.decode(conn, wire.Action(action))
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Accepted {
+		return nil, rejection(action, resp)
 	}
 
-	return nil
+	return resp.Payload, nil
 }
 
-func (l *lockingCenter) result(conn *net.TCPConn) bool {
-	r := make([]byte, 1)
+func (l *lockingCenter) begin(action mutexAction, key string) (*operation, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
 
-	if _, err := io.ReadAtLeast(conn, r, len(r)); err != nil {
-		return false
+	if l.closed {
+		return nil, ErrClosed
 	}
 
-	return string(r) == "+"
+	op := &operation{action: action, key: key}
+	l.pending[op] = struct{}{}
+	l.inFlight.Add(1)
+
+	return op, nil
 }
 
-func (l *lockingCenter) Lock(key string) {
-	query := func() bool {
-		conn, err := net.DialTCP("tcp", nil, l.address)
-		if err != nil {
-			fmt.Printf("WARN: connection failure (keep trying): %s\n", err)
-			return false
-		}
-		defer func() { _ = conn.Close() }()
+func (l *lockingCenter) end(op *operation) {
+	l.mutex.Lock()
+	delete(l.pending, op)
+	l.mutex.Unlock()
 
-		if err := l.query(conn, maLock, key, l.sourceAddr); err != nil {
-			fmt.Printf("WARN: locking error (keep trying): %s\n", err)
-			return false
-		}
+	l.inFlight.Done()
+}
 
+func (l *lockingCenter) dial(ctx context.Context, action mutexAction) (net.Conn, error) {
+	if err := l.prepare(); err != nil {
+		return nil, err
+	}
+
+	conn, err := l.take(ctx, action)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.aborted {
+		l.pool.release()
+		_ = conn.Close()
+		return nil, ErrClosed
+	}
+	l.conns[conn] = struct{}{}
+
+	return conn, nil
+}
+
+func (l *lockingCenter) isAborted() bool {
+	select {
+	case <-l.abort:
 		return true
+	default:
+		return false
 	}
+}
 
-	for !query() {
-		time.Sleep(queueRetryDuration)
+func (l *lockingCenter) hangUp(conn net.Conn) {
+	l.mutex.Lock()
+	delete(l.conns, conn)
+	l.mutex.Unlock()
+
+	l.pool.release()
+
+	_ = conn.Close()
+}
+
+// finish stops watching the connection and gives it back to the pool when the
+// exchange on it has completed, otherwise the connection is closed
+func (l *lockingCenter) finish(conn net.Conn, stop func(), reusable bool) {
+	stop()
+
+	if !reusable || !l.recycle(conn) {
+		l.hangUp(conn)
 	}
 }
 
-func (l *lockingCenter) Unlock(key string) {
-	query := func() bool {
-		conn, err := net.DialTCP("tcp", nil, l.address)
-		if err != nil {
-			fmt.Printf("WARN: connection failure (keep trying): %s\n", err)
-			return false
+func (l *lockingCenter) run(ctx context.Context, action mutexAction, key string, sourceAddr *string, id uint64) error {
+	key = l.options.normalize(key)
+
+	op, err := l.begin(action, key)
+	if err != nil {
+		return err
+	}
+	defer l.end(op)
+
+	if l.options.resolve().bypass {
+		return l.dryRun(action, key)
+	}
+
+	leave, err := l.admit(action)
+	if err != nil {
+		return err
+	}
+	defer leave()
+
+	release, err := l.takeSlot(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if action == maLock && l.options.tracksGoroutines() {
+		goroutine := goroutineID()
+
+		if err := l.checkOrder(goroutine, key); err != nil {
+			return err
 		}
-		defer func() { _ = conn.Close() }()
 
-		if err := l.query(conn, maUnlock, key, nil); err != nil {
-			fmt.Printf("WARN: unlocking error (keep trying): %s\n", err)
-			return false
+		if l.options.detectDeadlocks {
+			if err := l.enqueue(goroutine, key); err != nil {
+				l.logf("WARN: %s\n", err)
+				return err
+			}
+			defer l.dequeue(goroutine)
 		}
+	}
 
-		return true
+	granted := false
+	if action == maLock && l.options.serializeKeys {
+		if err := l.enterGate(ctx, key); err != nil {
+			return err
+		}
+		defer func() {
+			if !granted {
+				l.exitGate(key)
+			}
+		}()
+
+		if l.takeHandOff(key, sourceAddr, ownerOf(ctx)) {
+			granted = true
+			l.audit(action, key, sourceAddr)
+			return nil
+		}
 	}
 
-	for !query() {
-		time.Sleep(queueRetryDuration)
+	if action == maUnlock && l.handOff(key) {
+		l.audit(action, key, sourceAddr)
+		return nil
 	}
-}
 
-func (l *lockingCenter) Wait(key string) {
-	l.Lock(key)
-	defer l.Unlock(key)
-}
+	withdrawn := false
+	query := func() error {
+		if err := l.throttle(ctx); err != nil {
+			return err
+		}
+
+		if l.multiplexed() {
+			err := l.multiplex(ctx, action, key, sourceAddr, id)
+			if err != nil && !l.isAborted() && ctx.Err() == nil && IsRetryable(err) {
+				l.logf("WARN: %s error%s (keep trying): %s\n", action, tag(id), err)
+			}
+			return err
+		}
 
-func (l *lockingCenter) ResetByKey(key string) {
-	query := func() bool {
-		conn, err := net.DialTCP("tcp", nil, l.address)
+		started := time.Now()
+
+		conn, err := l.dial(ctx, action)
 		if err != nil {
-			fmt.Printf("WARN: connection failure (keep trying): %s\n", err)
-			return false
+			if IsRetryable(err) {
+				l.logf("WARN: connection failure%s (keep trying): %s\n", tag(id), err)
+			}
+			return err
 		}
-		defer func() { _ = conn.Close() }()
 
-		if err := l.query(conn, maResetByKey, key, nil); err != nil {
-			fmt.Printf("WARN: reseting error (keep trying): %s\n", err)
-			return false
+		if err := l.bound(conn, action, started); err != nil {
+			l.hangUp(conn)
+			return err
 		}
 
-		return true
+		stop := l.watch(ctx, conn)
+
+		reusable := false
+		defer func() { l.finish(conn, stop, reusable) }()
+
+		if action == maLock {
+			// the releases it may wait for are not held behind its connection
+			defer l.pool.lock()()
+		}
+
+		if _, err := l.exchange(conn, action, key, sourceAddr, id, PriorityOf(ctx), l.fairness(ctx), l.maxWait(ctx), ReasonOf(ctx)); err != nil {
+			if action == maLock && ctx.Err() != nil && l.supports(wire.CapAbandon) {
+				// the answer of the lock is read after the abandon
+				stop()
+				stop = func() {}
+				withdrawn = true
+				l.withdraw(conn, key, sourceAddr, id)
+			}
+			if !l.isAborted() && ctx.Err() == nil && IsRetryable(err) {
+				l.logf("WARN: %s error%s (keep trying): %s\n", action, tag(id), err)
+			}
+			return err
+		}
+
+		reusable = true
+		return nil
 	}
 
-	for !query() {
-		time.Sleep(queueRetryDuration)
+	defer l.resetDelay(action, key)
+
+	for attempt := 1; ; attempt++ {
+		err := query()
+		if err == nil {
+			break
+		}
+
+		if action == maLock && l.expiredInQueue(ctx, err) {
+			// the deadline of the context is due by then
+			select {
+			case <-ctx.Done():
+			case <-l.abort:
+			}
+		}
+
+		if ctx.Err() != nil || l.isAborted() {
+			if action == maLock && !withdrawn {
+				l.abandon(key, sourceAddr, id)
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return ErrClosed
+		}
+
+		if !IsRetryable(err) {
+			return err
+		}
+
+		delay := l.jittered(l.retryDelay(action, key)) + l.spendRetry()
+		if !l.observeRetry(action, key, attempt, err, delay) {
+			l.refundRetry()
+			return err
+		}
+		l.counters.retries.Add(1)
+		l.debug(DebugEvent{Kind: DebugRetry, Action: wire.Action(action), Key: key, Attempt: attempt, Duration: delay, Err: err})
+
+		select {
+		case <-l.abort:
+			l.refundRetry()
+			return ErrClosed
+		case <-ctx.Done():
+			l.refundRetry()
+			return ctx.Err()
+		case <-after(l.options.clock, delay):
+		}
 	}
+
+	granted = true
+	l.trackOwned(action, key, sourceAddr, ownerOf(ctx))
+
+	return nil
 }
 
-func (l *lockingCenter) ResetBySource(sourceAddr *string) {
-	query := func() bool {
-		conn, err := net.DialTCP("tcp", nil, l.address)
-		if err != nil {
-			fmt.Printf("WARN: connection failure (keep trying): %s\n", err)
-			return false
+// watch interrupts the connection when the context is done, the returned
+// function stops watching and returns after the watcher has quit
+func (l *lockingCenter) watch(ctx context.Context, conn net.Conn) func() {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Now())
+		case <-stop:
 		}
-		defer func() { _ = conn.Close() }()
+	}()
 
-		if err := l.query(conn, maResetBySource, "", sourceAddr); err != nil {
-			fmt.Printf("WARN: reseting error (keep trying): %s\n", err)
-			return false
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// abandon asks the server to drop the queued lock request of the client, so
+// that it is not granted to a waiter who is no longer there
+func (l *lockingCenter) abandon(key string, sourceAddr *string, id uint64) {
+	if !l.supports(wire.CapAbandon) {
+		return
+	}
+
+	started := time.Now()
+
+	conn, err := l.connect()
+	if err != nil {
+		l.logf("WARN: abandoning error%s: %s\n", tag(id), err)
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	if err := l.bound(conn, maAbandon, started); err != nil {
+		l.logf("WARN: abandoning error%s: %s\n", tag(id), err)
+		return
+	}
+
+	if err := l.query(conn, maAbandon, key, sourceAddr, id); err != nil {
+		l.logf("WARN: abandoning error%s: %s\n", tag(id), err)
+	}
+}
+
+// withdraw abandons the queued lock request and reads its answer from the
+// connection, so the lock granted before the abandon has reached the server is
+// released instead of being left to a waiter who is no longer there
+func (l *lockingCenter) withdraw(conn net.Conn, key string, sourceAddr *string, id uint64) {
+	l.abandon(key, sourceAddr, id)
+
+	if err := conn.SetReadDeadline(time.Now().Add(withdrawTimeout)); err != nil {
+		return
+	}
+	resp, err := l.decode(conn, wire.Lock)
+	if err != nil || !resp.Accepted {
+		return
+	}
+
+	l.logf("WARN: abandoned lock of %s is granted, releasing it\n", key)
+	l.giveUp(key)
+}
+
+func (l *lockingCenter) track(action mutexAction, key string, sourceAddr *string) {
+	l.trackOwned(action, key, sourceAddr, "")
+}
+
+// trackOwned tracks the action, the lock is held with the ownership token of
+// LockOwned if it is given
+func (l *lockingCenter) trackOwned(action mutexAction, key string, sourceAddr *string, token string) {
+	var released *heldLock
+
+	l.mutex.Lock()
+	switch action {
+	case maLock:
+		l.held[key] = l.hold()
+		l.held[key].token = token
+		if g, has := l.gates[key]; has {
+			g.source = sourceAddr
+		}
+	case maUnlock, maResetByKey:
+		released = l.held[key]
+		if released != nil {
+			released.stopTimers()
+		}
+		delete(l.held, key)
+		l.leaveGate(key)
+		if g, has := l.gates[key]; has && action == maResetByKey {
+			g.remote = false
 		}
+	case maResetBySource:
+		if sourceAddr != nil && l.sourceAddr != nil && *sourceAddr == *l.sourceAddr {
+			l.releaseHeld()
+		}
+	case maResetAll:
+		l.releaseHeld()
+	}
+	l.mutex.Unlock()
 
-		return true
+	if released != nil && action == maUnlock {
+		held := since(l.options.clock, released.acquiredAt)
+		l.measureHold(key, held)
+		l.observeHold(key, held)
+	}
+
+	l.audit(action, key, sourceAddr)
+}
+
+func (l *lockingCenter) Lock(key string) error {
+	return l.LockContext(context.Background(), key)
+}
+
+func (l *lockingCenter) LockContext(ctx context.Context, key string) error {
+	return l.execute(ctx, maLock, key, l.sourceOf(ctx))
+}
+
+func (l *lockingCenter) Unlock(key string) error {
+	if l.owned(key) {
+		return ErrNotOwner
+	}
+	return l.unlock(key)
+}
+
+func (l *lockingCenter) Wait(key string) error {
+	if err := l.Lock(key); err != nil {
+		return err
+	}
+	return l.Unlock(key)
+}
+
+// PassiveWait returns once the key is free without joining the acquisition
+// queue. Servers without the observe support reject the request, then it falls
+// back to Wait.
+func (l *lockingCenter) PassiveWait(key string) error {
+	if !l.supports(wire.CapObserve) {
+		return l.Wait(key)
+	}
+
+	err := l.execute(context.Background(), maObserve, key, nil)
+	if !errors.Is(err, ErrServerRejected) {
+		return err
+	}
+
+	l.logf("WARN: passive wait is not supported by the server, waiting in the queue\n")
+	return l.Wait(key)
+}
+
+func (l *lockingCenter) ResetByKey(key string) error {
+	return l.execute(context.Background(), maResetByKey, key, nil)
+}
+
+func (l *lockingCenter) ResetBySource(sourceAddr *string) error {
+	return l.execute(context.Background(), maResetBySource, "", sourceAddr)
+}
+
+// ResetAll clears every lock on the server, including the ones of the other
+// namespaces. It is not retried when the server rejects it.
+func (l *lockingCenter) ResetAll() error {
+	if !l.supports(wire.CapResetAll) {
+		return ErrNotSupported
 	}
 
-	for !query() {
-		time.Sleep(queueRetryDuration)
+	err := l.execute(context.Background(), maResetAll, "", nil)
+	if errors.Is(err, ErrServerRejected) {
+		return ErrNotSupported
 	}
+	return err
 }
@@ -0,0 +1,305 @@
+package mutex
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"math/rand"
+	"net"
+	"sync"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+// WithMultiplexing sends the locks, the unlocks and the resets of the client
+// over a single connection when the server agrees on it by WithNegotiation.
+// A reader goroutine matches the answers to their requests by the request ids,
+// so a contended lock does not hold the operations sent after it, and the
+// teardown of the connection wakes all of them up to be retried on a new one.
+// The operations are bounded by their contexts instead of the read timeout.
+func WithMultiplexing() Option {
+	return func(o *options) {
+		o.multiplex = true
+	}
+}
+
+type muxCall struct {
+	action mutexAction
+	result chan wire.Response
+	// late handles the answer arriving after the caller has left
+	late func(resp wire.Response)
+}
+
+// muxConn is a multiplexed connection, its calls are answered in the order
+// they complete on the server
+type muxConn struct {
+	lc   *lockingCenter
+	conn net.Conn
+
+	writeMutex sync.Mutex
+
+	mutex sync.Mutex
+	calls map[uint64]*muxCall
+	err   error
+	done  chan struct{}
+}
+
+func newMuxConn(l *lockingCenter, conn net.Conn) *muxConn {
+	m := &muxConn{
+		lc:    l,
+		conn:  conn,
+		calls: make(map[uint64]*muxCall),
+		done:  make(chan struct{}),
+	}
+	go m.read()
+
+	return m
+}
+
+// read dispatches the answers to their calls until the connection fails
+func (m *muxConn) read() {
+	var err error
+	defer m.lc.rescue("multiplexed reader")
+	defer func() {
+		if err == nil {
+			err = ErrConnUnavailable
+		}
+		m.teardown(err)
+	}()
+
+	r := bufio.NewReader(m.conn)
+	for {
+		var id uint64
+		if id, err = wire.DecodeID(r); err != nil {
+			return
+		}
+
+		m.mutex.Lock()
+		call, has := m.calls[id]
+		m.mutex.Unlock()
+		if !has {
+			err = wire.ErrMalformed
+			return
+		}
+
+		decode := wire.Decode
+		if _, detailed := m.conn.(*detailedConn); detailed {
+			decode = wire.DecodeDetailed
+		}
+		if m.lc.framesV2() {
+			decode = wire.DecodeV2
+		}
+
+		var resp wire.Response
+		if resp, err = decode(r, wire.Action(call.action)); err != nil {
+			return
+		}
+		if !m.lc.options.errorDetails {
+			resp.Code, resp.Reason = wire.CodeUnspecified, ""
+		}
+
+		// the answer is given while holding the mutex, so a caller leaving in
+		// the meantime either hands it to late or finds it in the result
+		m.mutex.Lock()
+		delete(m.calls, id)
+		if call.late != nil {
+			go call.late(resp)
+		} else {
+			call.result <- resp
+		}
+		m.mutex.Unlock()
+	}
+}
+
+// teardown fails the connection and wakes up the calls waiting on it
+func (m *muxConn) teardown(err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.calls == nil {
+		return
+	}
+	m.err = err
+	m.calls = nil
+	close(m.done)
+
+	_ = m.conn.Close()
+}
+
+func (m *muxConn) failed() bool {
+	select {
+	case <-m.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// register adds the call of the id, or of a new one when the id is not given
+// or taken
+func (m *muxConn) register(id uint64, call *muxCall) (uint64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.calls == nil {
+		return 0, m.err
+	}
+	for {
+		if _, taken := m.calls[id]; id != 0 && !taken {
+			break
+		}
+		id = rand.Uint64()
+	}
+	m.calls[id] = call
+
+	return id, nil
+}
+
+// roundTrip sends the frame of the call and waits for its answer. The answer
+// of the call left by its context is given to late.
+func (m *muxConn) roundTrip(ctx context.Context, id uint64, call *muxCall, frame func(id uint64) ([]byte, error), late func(resp wire.Response)) (wire.Response, error) {
+	id, err := m.register(id, call)
+	if err != nil {
+		return wire.Response{}, err
+	}
+
+	b, err := frame(id)
+	if err != nil {
+		m.forget(id)
+		return wire.Response{}, err
+	}
+
+	m.writeMutex.Lock()
+	_, err = m.conn.Write(b)
+	m.writeMutex.Unlock()
+	if err != nil {
+		m.teardown(err)
+		return wire.Response{}, err
+	}
+
+	select {
+	case resp := <-call.result:
+		return resp, nil
+	case <-m.done:
+	case <-ctx.Done():
+	case <-m.lc.abort:
+	}
+
+	m.mutex.Lock()
+	_, pending := m.calls[id]
+	if pending {
+		call.late = late
+	}
+	m.mutex.Unlock()
+
+	if !pending {
+		// the answered call is forgotten after its result is sent, the result
+		// is only missing when the connection is torn down
+		select {
+		case resp := <-call.result:
+			if ctx.Err() == nil && !m.lc.isAborted() {
+				return resp, nil
+			}
+			go late(resp)
+		default:
+		}
+	}
+
+	if ctx.Err() != nil {
+		return wire.Response{}, ctx.Err()
+	}
+	if m.lc.isAborted() {
+		return wire.Response{}, ErrClosed
+	}
+	return wire.Response{}, m.err
+}
+
+func (m *muxConn) forget(id uint64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.calls != nil {
+		delete(m.calls, id)
+	}
+}
+
+// multiplexed reports if the server has agreed on the multiplexed connections
+func (l *lockingCenter) multiplexed() bool {
+	return l.options.multiplex && l.agrees(wire.CapMultiplex)
+}
+
+// muxConn returns the multiplexed connection, switching a new one when the
+// previous has failed
+func (l *lockingCenter) muxConn() (*muxConn, error) {
+	l.mutex.Lock()
+	m := l.mux
+	l.mutex.Unlock()
+
+	if m != nil && !m.failed() {
+		return m, nil
+	}
+
+	conn, err := l.connect()
+	if err != nil {
+		return nil, err
+	}
+	if err := l.query(conn, maMultiplex, "", nil, 0); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.aborted {
+		_ = conn.Close()
+		return nil, ErrClosed
+	}
+	if l.mux != nil && !l.mux.failed() {
+		_ = conn.Close()
+		return l.mux, nil
+	}
+	l.mux = newMuxConn(l, conn)
+
+	return l.mux, nil
+}
+
+// multiplex runs the operation on the multiplexed connection, the lock granted
+// after its context is done is released
+func (l *lockingCenter) multiplex(ctx context.Context, action mutexAction, key string, sourceAddr *string, id uint64) error {
+	m, err := l.muxConn()
+	if err != nil {
+		return err
+	}
+
+	frame := func(id uint64) ([]byte, error) {
+		buffer := bytes.NewBuffer(nil)
+		if err := l.preparePackage(buffer, action, key, sourceAddr, id, PriorityOf(ctx), l.fairness(ctx), l.maxWait(ctx), ReasonOf(ctx)); err != nil {
+			return nil, err
+		}
+		return buffer.Bytes(), nil
+	}
+	late := func(resp wire.Response) {
+		if action == maLock && resp.Accepted {
+			l.logf("WARN: abandoned lock of %s is granted, releasing it\n", key)
+			l.giveUp(key)
+		}
+	}
+
+	resp, err := m.roundTrip(ctx, id, &muxCall{action: action, result: make(chan wire.Response, 1)}, frame, late)
+	if err != nil {
+		return err
+	}
+	if !resp.Accepted {
+		return rejection(action, resp)
+	}
+	return nil
+}
+
+// closeMux tears the multiplexed connection down, it should be called holding
+// the mutex
+func (l *lockingCenter) closeMux() {
+	if l.mux != nil {
+		_ = l.mux.conn.Close()
+	}
+}
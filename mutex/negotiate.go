@@ -0,0 +1,109 @@
+package mutex
+
+import (
+	"net"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+const helloTimeout = time.Second * 5
+
+// WithNegotiation sends the hello frame when the client is created to agree on
+// the capabilities of the protocol with the server. The operations the server
+// does not support fail with ErrNotSupported or fall back to their
+// alternatives without reaching the server. The servers rejecting the hello
+// frame are used as before.
+func WithNegotiation() Option {
+	return func(o *options) {
+		o.negotiate = true
+	}
+}
+
+func (l *lockingCenter) negotiate(conn net.Conn) {
+	hello, err := l.hello(conn)
+	if err != nil {
+		l.logf("WARN: negotiation error: %s\n", err)
+		return
+	}
+	if hello == nil {
+		l.logf("WARN: protocol negotiation is not supported by the server, using the version 0\n")
+		return
+	}
+	l.peer.Store(hello)
+}
+
+// hello sends the hello frame and returns the protocol agreed by the server,
+// nil when the server does not support the negotiation
+func (l *lockingCenter) hello(conn net.Conn) (*wire.HelloPayload, error) {
+	timeout := l.options.resolve().dialTimeout
+	if timeout <= 0 {
+		timeout = helloTimeout
+	}
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	frame, err := wire.Encode(wire.Request{
+		Action:  wire.Hello,
+		Payload: wire.EncodeHello(wire.HelloPayload{Version: wire.ProtocolVersion, Capabilities: wire.Capabilities}),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(frame); err != nil {
+		return nil, err
+	}
+
+	// the older servers reject the unknown frame or hang up
+	resp, err := wire.Decode(conn, wire.Hello)
+	if err != nil || !resp.Accepted {
+		return nil, nil
+	}
+
+	hello, err := wire.DecodeHello(resp.Payload)
+	if err != nil {
+		return nil, err
+	}
+	return &hello, nil
+}
+
+// supports reports if the server has agreed on the capability, the servers
+// without the negotiation are assumed to support everything
+func (l *lockingCenter) supports(c wire.Capability) bool {
+	peer := l.agreed()
+	return peer == nil || peer.Has(c)
+}
+
+// agrees reports if the server has agreed on the capability by the negotiation
+func (l *lockingCenter) agrees(c wire.Capability) bool {
+	peer := l.agreed()
+	return peer != nil && peer.Has(c)
+}
+
+func (l *lockingCenter) agreed() *wire.HelloPayload {
+	peer, _ := l.peer.Load().(*wire.HelloPayload)
+	return peer
+}
+
+func capabilityOf(action mutexAction) wire.Capability {
+	switch action {
+	case maObserve:
+		return wire.CapObserve
+	case maWatch:
+		return wire.CapWatch
+	case maQueuePosition:
+		return wire.CapQueuePosition
+	case maStatus:
+		return wire.CapStatus
+	case maList:
+		return wire.CapList
+	case maStats:
+		return wire.CapStats
+	case maResetAll:
+		return wire.CapResetAll
+	case maAbandon:
+		return wire.CapAbandon
+	}
+	return 0
+}
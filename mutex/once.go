@@ -0,0 +1,69 @@
+package mutex
+
+import (
+	"sync"
+)
+
+type OnceStore interface {
+	IsDone(key string) (bool, error)
+	MarkDone(key string) error
+}
+
+type Once struct {
+	lc    Locker
+	store OnceStore
+
+	mutex sync.Mutex
+	done  map[string]bool
+}
+
+func NewOnce(lc Locker, store OnceStore) *Once {
+	return &Once{
+		lc:    lc,
+		store: store,
+		done:  make(map[string]bool),
+	}
+}
+
+func (o *Once) Do(key string, fn func() error) (err error) {
+	if o.isDone(key) {
+		return nil
+	}
+
+	if err := o.lc.Lock(key); err != nil {
+		return err
+	}
+	defer func() {
+		if unlockErr := o.lc.Unlock(key); err == nil {
+			err = unlockErr
+		}
+	}()
+
+	done, err := o.store.IsDone(key)
+	if err != nil {
+		return err
+	}
+
+	if !done {
+		if err := fn(); err != nil {
+			return err
+		}
+
+		if err := o.store.MarkDone(key); err != nil {
+			return err
+		}
+	}
+
+	o.mutex.Lock()
+	o.done[key] = true
+	o.mutex.Unlock()
+
+	return nil
+}
+
+func (o *Once) isDone(key string) bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	return o.done[key]
+}
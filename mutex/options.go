@@ -0,0 +1,227 @@
+package mutex
+
+import (
+	"crypto/tls"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+const defaultRetryInterval = time.Millisecond * 500
+
+type Option func(*options)
+
+type options struct {
+	retryInterval time.Duration
+	adaptiveRetry *retryBounds
+	waitStrategy  WaitStrategy
+	dialTimeout   time.Duration
+	dialer        DialFunc
+	fallbacks     []string
+	endpoints     []Endpoint
+	localZone     string
+	replicas      []string
+	keepAlive     time.Duration
+	dualStack     *time.Duration
+	noDelay       *bool
+	tls           *tls.Config
+	credentials   CredentialsProvider
+	faults        *Faults
+	clock         Clock
+	pool          PoolConfig
+	transport     *Transport
+	rateLimit     float64
+	rateBurst     int
+	maxInFlight   int
+	waitInFlight  bool
+	bypass        bool
+	dryRun        *DryRun
+	negotiate     bool
+	lazyConnect   bool
+	requestIDs    bool
+	idempotent    bool
+	session       string
+	multiplex     bool
+	errorDetails  bool
+	fairness      Fairness
+
+	operationTimeout time.Duration
+	actionTimeouts   map[wire.Action]time.Duration
+	retryObserver    RetryObserver
+	jitter           float64
+	randSource       rand.Source
+	expvarName       string
+	debugEvents      int
+	wireDump         bool
+	profilerLabels   bool
+
+	retryBudget         int
+	retryBudgetInterval time.Duration
+	closeTimeout        time.Duration
+
+	configProvider ConfigProvider
+
+	sourceIdentity *string
+	sourceTemplate string
+	autoSourceAddr bool
+	clientLabels   map[string]string
+
+	namespace    string
+	tenant       bool
+	quotas       map[string]Quota
+	hashLongKeys bool
+	normalizer   *KeyNormalizer
+
+	holdBounds     []holdBound
+	overdueHandler OverdueHandler
+	leakThreshold  time.Duration
+	leakHandler    LeakHandler
+
+	slowHoldThreshold time.Duration
+	slowHoldHandler   SlowHoldHandler
+
+	forcedReleaseMargin  time.Duration
+	forcedReleaseHandler ForcedReleaseHandler
+
+	latencyHistograms bool
+	latencyBuckets    []time.Duration
+	latencyPatterns   []string
+
+	serializeKeys bool
+	handOffLimit  int
+	strictUnlock  bool
+
+	detectDeadlocks bool
+	lockLevels      []lockLevel
+
+	logger       Logger
+	middlewares  []Middleware
+	auditHandler AuditHandler
+
+	lockerErrorHandler LockerErrorHandler
+}
+
+func defaultOptions() options {
+	return options{
+		retryInterval:      defaultRetryInterval,
+		lockerErrorHandler: panicOnLockerError,
+		logger:             stdoutLogger{},
+		clock:              SystemClock,
+	}
+}
+
+func WithRetryInterval(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.retryInterval = d
+		}
+	}
+}
+
+func WithDialTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.dialTimeout = d
+	}
+}
+
+// DialFunc opens the connections to the server in place of the tcp dialer.
+type DialFunc func(address string, timeout time.Duration) (net.Conn, error)
+
+// WithFallbackAddresses connects to the addresses in order when the address of
+// the client can not be connected
+func WithFallbackAddresses(addresses ...string) Option {
+	return func(o *options) {
+		o.fallbacks = append(o.fallbacks, addresses...)
+	}
+}
+
+func WithDialer(dial DialFunc) Option {
+	return func(o *options) {
+		o.dialer = dial
+	}
+}
+
+// WithKeepAlive sets the period of the tcp keepalive probes of the connections,
+// a negative period disables them
+func WithKeepAlive(period time.Duration) Option {
+	return func(o *options) {
+		o.keepAlive = period
+	}
+}
+
+// WithDualStack dials the server name of the client by all of its addresses
+// instead of the one resolved at the construction. The name is resolved again
+// for every connection and, when it has both the IPv6 and the IPv4 addresses,
+// the families are raced as in RFC 6555: the IPv4 ones are dialed once the
+// IPv6 ones have not connected within the fallback delay, 300ms when it is
+// zero.
+func WithDualStack(fallbackDelay time.Duration) Option {
+	return func(o *options) {
+		o.dualStack = &fallbackDelay
+	}
+}
+
+// WithNoDelay toggles the Nagle's algorithm of the connections, the small
+// frames are sent without delay by default
+func WithNoDelay(noDelay bool) Option {
+	return func(o *options) {
+		o.noDelay = &noDelay
+	}
+}
+
+// Profile bundles the retry, the timeout and the pool settings, the zero Pool
+// keeps the pool of the client.
+type Profile struct {
+	RetryInterval time.Duration
+	DialTimeout   time.Duration
+	Pool          PoolConfig
+}
+
+var (
+	// ProfileLowLatency keeps many connections warm, so the operations
+	// rarely wait for a dial
+	ProfileLowLatency = Profile{
+		RetryInterval: time.Millisecond * 50,
+		DialTimeout:   time.Millisecond * 250,
+		Pool: PoolConfig{
+			MaxIdle:     32,
+			IdleTimeout: time.Minute * 5,
+		},
+	}
+	// ProfileBatch bounds the connections of the jobs and queues the
+	// operations over them for a free one
+	ProfileBatch = Profile{
+		RetryInterval: time.Second * 2,
+		DialTimeout:   time.Second * 5,
+		Pool: PoolConfig{
+			MaxActive:   16,
+			MaxIdle:     4,
+			IdleTimeout: time.Minute,
+			Wait:        true,
+		},
+	}
+	// ProfileDegradedNetwork reuses the connections for a short while only,
+	// before they are dropped by the network in between
+	ProfileDegradedNetwork = Profile{
+		RetryInterval: time.Second,
+		DialTimeout:   time.Second * 10,
+		Pool: PoolConfig{
+			MaxActive:   32,
+			MaxIdle:     8,
+			IdleTimeout: time.Second * 15,
+			Wait:        true,
+		},
+	}
+)
+
+func WithProfile(p Profile) Option {
+	return func(o *options) {
+		WithRetryInterval(p.RetryInterval)(o)
+		WithDialTimeout(p.DialTimeout)(o)
+		if p.Pool != (PoolConfig{}) {
+			WithPool(p.Pool)(o)
+		}
+	}
+}
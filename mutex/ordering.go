@@ -0,0 +1,72 @@
+package mutex
+
+import (
+	"fmt"
+	"strings"
+)
+
+type lockLevel struct {
+	prefix string
+	level  int
+}
+
+type LockOrderError struct {
+	Key       string
+	Level     int
+	HeldKey   string
+	HeldLevel int
+}
+
+func (e *LockOrderError) Error() string {
+	return fmt.Sprintf("lock order violation: %s (level %d) is requested while %s (level %d) is held", e.Key, e.Level, e.HeldKey, e.HeldLevel)
+}
+
+// WithLockLevel assigns the level to the keys starting with the prefix, the
+// longest matching prefix wins. A goroutine holding a leveled key can only
+// acquire the keys of the higher levels.
+func WithLockLevel(prefix string, level int) Option {
+	return func(o *options) {
+		o.lockLevels = append(o.lockLevels, lockLevel{prefix: prefix, level: level})
+	}
+}
+
+func (o options) tracksGoroutines() bool {
+	return o.detectDeadlocks || len(o.lockLevels) > 0
+}
+
+func (o options) lockLevel(key string) (int, bool) {
+	matched := -1
+	level := 0
+
+	for _, l := range o.lockLevels {
+		if strings.HasPrefix(key, l.prefix) && len(l.prefix) > matched {
+			matched = len(l.prefix)
+			level = l.level
+		}
+	}
+
+	return level, matched > -1
+}
+
+func (l *lockingCenter) checkOrder(goroutine int64, key string) error {
+	level, leveled := l.options.lockLevel(key)
+	if !leveled {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for heldKey, h := range l.held {
+		if h.goroutine != goroutine {
+			continue
+		}
+
+		heldLevel, leveled := l.options.lockLevel(heldKey)
+		if leveled && heldLevel >= level {
+			return &LockOrderError{Key: key, Level: level, HeldKey: heldKey, HeldLevel: heldLevel}
+		}
+	}
+
+	return nil
+}
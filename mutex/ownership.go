@@ -0,0 +1,94 @@
+package mutex
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+)
+
+var ErrNotOwner = errors.New("lock is not owned by the caller")
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// LockOwned acquires the key and returns the ownership token that is required
+// to release it. The owned keys can not be released by Unlock.
+func (l *lockingCenter) LockOwned(ctx context.Context, key string) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	// the token is kept along with the hold, so an Unlock can not slip in
+	// before the key is owned
+	if err := l.LockContext(context.WithValue(ctx, ownerKey{}, token), key); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// UnlockOwned releases the key of the token. The release is claimed by the
+// check of the owner, so the concurrent calls with the same token unlock the
+// key once and the others return ErrNotHeld.
+func (l *lockingCenter) UnlockOwned(key string, token string) error {
+	h, err := l.checkOwner(key, token)
+	if err != nil {
+		return err
+	}
+
+	if err := l.execute(context.Background(), maUnlock, key, nil); err != nil {
+		l.mutex.Lock()
+		h.releasing = false
+		l.mutex.Unlock()
+
+		return err
+	}
+	return nil
+}
+
+func (l *lockingCenter) checkOwner(key string, token string) (*heldLock, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	h, has := l.held[l.options.normalize(key)]
+	if !has || h.token != token {
+		return nil, ErrNotOwner
+	}
+	if h.releasing {
+		return nil, ErrNotHeld
+	}
+	h.releasing = true
+
+	return h, nil
+}
+
+type ownerKey struct{}
+
+// ownerOf returns the token of the lock acquired by LockOwned
+func ownerOf(ctx context.Context) string {
+	token, _ := ctx.Value(ownerKey{}).(string)
+	return token
+}
+
+// unowned refuses the batched unlock of an owned key, it is only released by
+// UnlockOwned like it is refused by Unlock
+func (l *lockingCenter) unowned(operation BatchOperation) error {
+	if operation.action == maUnlock && l.owned(operation.key) {
+		return ErrNotOwner
+	}
+	return nil
+}
+
+func (l *lockingCenter) owned(key string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	h, has := l.held[l.options.normalize(key)]
+	return has && len(h.token) > 0
+}
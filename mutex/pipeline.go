@@ -0,0 +1,335 @@
+package mutex
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"sync"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+const defaultPipelineBatch = 64
+
+// Pipeline queues the operations of its concurrent callers and writes them in
+// batches of up to the batch size over a single connection. The answers are
+// read in order and dispatched back to the callers, so a contended lock delays
+// the answers of the operations queued after it.
+type Pipeline interface {
+	// Do returns once the answer of the operation is received. The lock
+	// granted after the context is done is released.
+	Do(ctx context.Context, operation BatchOperation) error
+	// Close waits for the operations in progress and closes the connection.
+	Close() error
+}
+
+type pipeline struct {
+	lc    *lockingCenter
+	op    *operation
+	batch int
+	conn  net.Conn
+	stop  func()
+	queue chan *pipelined
+	quit  chan struct{}
+	done  chan struct{}
+	calls sync.WaitGroup
+
+	mutex  sync.Mutex
+	sent   []*pipelined
+	err    error
+	closed bool
+}
+
+type pipelined struct {
+	operation BatchOperation
+	result    chan error
+	left      bool
+}
+
+func (l *lockingCenter) Pipeline(ctx context.Context, batch int) (Pipeline, error) {
+	if batch <= 0 {
+		batch = defaultPipelineBatch
+	}
+
+	op, err := l.begin(maLock, "")
+	if err != nil {
+		return nil, err
+	}
+
+	p := &pipeline{
+		lc:    l,
+		op:    op,
+		batch: batch,
+		queue: make(chan *pipelined, batch),
+		quit:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	if l.options.resolve().bypass {
+		close(p.done)
+		return p, nil
+	}
+
+	if !l.supports(wire.CapPipelining) {
+		l.end(op)
+		return nil, ErrNotSupported
+	}
+
+	conn, err := l.dial(ctx, maLock)
+	if err != nil {
+		l.end(op)
+		return nil, err
+	}
+
+	p.conn = conn
+	p.stop = l.watch(ctx, conn)
+
+	go p.flush()
+	go p.dispatch()
+
+	return p, nil
+}
+
+func (p *pipeline) Do(ctx context.Context, operation BatchOperation) error {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return ErrClosed
+	}
+	if p.err != nil {
+		p.mutex.Unlock()
+		return p.err
+	}
+	p.calls.Add(1)
+	p.mutex.Unlock()
+
+	defer p.calls.Done()
+
+	if p.conn == nil {
+		return nil
+	}
+
+	if err := p.lc.throttle(ctx); err != nil {
+		return err
+	}
+	if err := p.lc.unowned(operation); err != nil {
+		return err
+	}
+	if err := p.lc.claimBatched(&operation); err != nil {
+		return err
+	}
+
+	operation.key = p.lc.options.normalize(operation.key)
+	if operation.action == maLock && operation.sourceAddr == nil {
+		operation.sourceAddr = p.lc.sourceAddr
+	}
+
+	call := &pipelined{operation: operation, result: make(chan error, 1)}
+
+	select {
+	case p.queue <- call:
+	case <-ctx.Done():
+		p.lc.unclaim(operation.claimed)
+		return ctx.Err()
+	case <-p.done:
+		p.lc.unclaim(operation.claimed)
+		return p.failure()
+	}
+
+	select {
+	case err := <-call.result:
+		return err
+	case <-ctx.Done():
+	case <-p.done:
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	select {
+	case err := <-call.result:
+		return err
+	default:
+	}
+
+	if ctx.Err() != nil {
+		call.left = true
+		return ctx.Err()
+	}
+
+	// the call is never answered, it is not sent or failed with the pipeline
+	p.lc.unclaim(operation.claimed)
+	if p.err != nil {
+		return p.err
+	}
+	return ErrClosed
+}
+
+// flush writes the queued operations until the pipeline is closed, the
+// operations waiting in the queue are written together.
+func (p *pipeline) flush() {
+	var panicked error
+	defer func() {
+		if panicked != nil {
+			p.fail(panicked)
+		}
+	}()
+	defer p.lc.recovered(&panicked)
+
+	writer := bufio.NewWriter(p.conn)
+	buffer := bytes.NewBuffer(nil)
+
+	for {
+		var call *pipelined
+		select {
+		case call = <-p.queue:
+		case <-p.quit:
+			return
+		case <-p.done:
+			return
+		}
+
+		for written := 0; call != nil; written++ {
+			p.write(writer, buffer, call)
+
+			call = nil
+			if written+1 < p.batch {
+				select {
+				case call = <-p.queue:
+				default:
+				}
+			}
+		}
+
+		if err := writer.Flush(); err != nil {
+			p.fail(err)
+			return
+		}
+	}
+}
+
+func (p *pipeline) write(writer *bufio.Writer, buffer *bytes.Buffer, call *pipelined) {
+	buffer.Reset()
+
+	operation := call.operation
+	if err := p.lc.preparePackage(buffer, operation.action, operation.key, operation.sourceAddr, 0, 0, p.lc.options.fairness, 0, ""); err != nil {
+		p.lc.unclaim(operation.claimed)
+		call.result <- err
+		return
+	}
+
+	// the call is expected before its answer can arrive
+	p.mutex.Lock()
+	p.sent = append(p.sent, call)
+	p.mutex.Unlock()
+
+	// the write error is returned by the flush
+	_, _ = writer.Write(buffer.Bytes())
+}
+
+// dispatch reads the answers of the sent operations in order and gives them to
+// their callers.
+func (p *pipeline) dispatch() {
+	defer close(p.done)
+
+	var panicked error
+	defer func() {
+		if panicked != nil {
+			p.fail(panicked)
+		}
+	}()
+	defer p.lc.recovered(&panicked)
+
+	for {
+		// the answers of the batched operations carry no payloads
+		reply, err := p.lc.decode(p.conn, wire.Lock)
+		if err != nil {
+			p.fail(err)
+			return
+		}
+
+		p.mutex.Lock()
+		if len(p.sent) == 0 {
+			p.mutex.Unlock()
+			p.fail(wire.ErrMalformed)
+			return
+		}
+		call := p.sent[0]
+		p.sent = p.sent[1:]
+		left := call.left
+		p.mutex.Unlock()
+
+		operation := call.operation
+		if !reply.Accepted {
+			p.lc.unclaim(operation.claimed)
+			call.result <- rejection(operation.action, reply)
+			continue
+		}
+
+		if left && operation.action == maLock {
+			go p.lc.giveUp(operation.key)
+			continue
+		}
+
+		p.lc.track(operation.action, operation.key, operation.sourceAddr)
+		call.result <- nil
+	}
+}
+
+// fail answers the sent operations with the error
+func (p *pipeline) fail(err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.err == nil {
+		p.err = err
+	}
+	for _, call := range p.sent {
+		p.lc.unclaim(call.operation.claimed)
+		call.result <- p.err
+	}
+	p.sent = nil
+}
+
+func (p *pipeline) failure() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+	return ErrClosed
+}
+
+func (p *pipeline) Close() error {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return ErrClosed
+	}
+	p.closed = true
+	p.mutex.Unlock()
+
+	defer p.lc.end(p.op)
+
+	p.calls.Wait()
+
+	if p.conn == nil {
+		return nil
+	}
+
+	close(p.quit)
+	p.stop()
+	p.lc.hangUp(p.conn)
+	<-p.done
+
+	return nil
+}
+
+// giveUp releases the lock granted to a caller who is no longer waiting for it
+func (l *lockingCenter) giveUp(key string) {
+	if err := l.release(context.Background(), key); err != nil {
+		l.logf("WARN: unlocking error: %s\n", err)
+	}
+}
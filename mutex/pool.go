@@ -0,0 +1,295 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+var ErrPoolExhausted = errors.New("connection pool is exhausted")
+
+// PoolConfig controls the connections of the client. MaxActive limits the open
+// connections, including the idle ones, and zero means no limit. MaxIdle is the
+// number of the connections kept open for the next operations after their
+// exchange has completed, zero disables pooling. The idle connections are
+// evicted after IdleTimeout when it is set. When the pool is exhausted, the
+// operation waits for a free connection until its context is done if Wait is
+// set, otherwise ErrPoolExhausted is returned. The connections blocked in the
+// locks do not count against MaxActive for the unlocks and the resets, so the
+// releases the locks wait for are not starved of the connections. The connections idle for HeartbeatInterval are
+// probed by a status query when it is set, so the half-open ones are closed
+// before an operation takes them.
+type PoolConfig struct {
+	MaxActive         int
+	MaxIdle           int
+	IdleTimeout       time.Duration
+	Wait              bool
+	HeartbeatInterval time.Duration
+}
+
+func WithPool(config PoolConfig) Option {
+	return func(o *options) {
+		o.pool = config
+	}
+}
+
+type idleConn struct {
+	conn  net.Conn
+	since time.Time
+}
+
+// connPool keeps the idle connections of one or more clients
+type connPool struct {
+	config PoolConfig
+	clock  Clock
+
+	mutex    sync.Mutex
+	idle     []idleConn
+	active   int
+	locking  int
+	released chan struct{}
+	closed   bool
+	beating  bool
+}
+
+func newConnPool(config PoolConfig, clock Clock) *connPool {
+	return &connPool{
+		config:   config,
+		clock:    clock,
+		released: make(chan struct{}),
+	}
+}
+
+// signal wakes up the operations waiting for a free connection, it should be
+// called holding the mutex
+func (p *connPool) signal() {
+	close(p.released)
+	p.released = make(chan struct{})
+}
+
+// evict closes the idle connections longer than the timeout, it should be
+// called holding the mutex
+func (p *connPool) evict() {
+	if p.config.IdleTimeout <= 0 {
+		return
+	}
+
+	fresh := p.idle[:0]
+	for _, c := range p.idle {
+		if since(p.clock, c.since) > p.config.IdleTimeout {
+			_ = c.conn.Close()
+			p.active--
+			continue
+		}
+		fresh = append(fresh, c)
+	}
+	if len(fresh) < len(p.idle) {
+		p.signal()
+	}
+	p.idle = fresh
+}
+
+// put keeps the connection idle, it returns false when the pool is full
+func (p *connPool) put(conn net.Conn) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.evict()
+	if p.closed || len(p.idle) >= p.config.MaxIdle {
+		return false
+	}
+
+	p.idle = append(p.idle, idleConn{conn: conn, since: p.clock.Now()})
+	p.signal()
+
+	if p.config.HeartbeatInterval > 0 && !p.beating {
+		p.beating = true
+		go p.heartbeat()
+	}
+
+	return true
+}
+
+// release frees the place of a closed connection
+func (p *connPool) release() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.active--
+	p.signal()
+}
+
+// lock counts the active connection blocked in a lock until the returned
+// function is called
+func (p *connPool) lock() func() {
+	p.mutex.Lock()
+	p.locking++
+	p.mutex.Unlock()
+
+	return func() {
+		p.mutex.Lock()
+		p.locking--
+		p.mutex.Unlock()
+	}
+}
+
+// close closes the idle connections and returns their count, the connections
+// given back afterwards are not kept
+func (p *connPool) close() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.closed = true
+	closed := len(p.idle)
+	for _, c := range p.idle {
+		_ = c.conn.Close()
+	}
+	p.active -= closed
+	p.idle = nil
+
+	return closed
+}
+
+func (l *lockingCenter) take(ctx context.Context, action mutexAction) (net.Conn, error) {
+	p := l.pool
+
+	for {
+		if l.isAborted() {
+			return nil, ErrClosed
+		}
+
+		p.mutex.Lock()
+		p.evict()
+		if last := len(p.idle) - 1; last >= 0 {
+			conn := p.idle[last].conn
+			p.idle = p.idle[:last]
+			p.mutex.Unlock()
+
+			if l.expired(conn) {
+				_ = conn.Close()
+				p.release()
+				continue
+			}
+			return conn, nil
+		}
+
+		active := p.active
+		if action.releases() {
+			active -= p.locking
+		}
+		if p.config.MaxActive <= 0 || active < p.config.MaxActive {
+			p.active++
+			p.mutex.Unlock()
+
+			conn, err := l.connect()
+			if err != nil {
+				p.release()
+				return nil, err
+			}
+			return conn, nil
+		}
+
+		released := p.released
+		p.mutex.Unlock()
+
+		if !p.config.Wait {
+			return nil, ErrPoolExhausted
+		}
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-l.abort:
+			return nil, ErrClosed
+		}
+	}
+}
+
+// recycle keeps the connection idle for the next operations, it returns false
+// when the pool is full.
+func (l *lockingCenter) recycle(conn net.Conn) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.aborted || l.expired(conn) {
+		return false
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return false
+	}
+	if !l.pool.put(conn) {
+		return false
+	}
+	delete(l.conns, conn)
+
+	return true
+}
+
+// Warmup opens up to n connections at once and keeps them idle in the pool, so
+// the first operations do not wait for their dials. The connections over the
+// idle or the active limits of the pool are not opened, and the first dial
+// failure is returned after the others have completed.
+func (l *lockingCenter) Warmup(n int) error {
+	if l.options.resolve().bypass {
+		return nil
+	}
+	if l.isAborted() {
+		return ErrClosed
+	}
+	if err := l.prepare(); err != nil {
+		return err
+	}
+
+	p := l.pool
+	if p.config.MaxIdle <= 0 {
+		return errors.New("connection pool keeps no idle connections")
+	}
+
+	p.mutex.Lock()
+	if room := p.config.MaxIdle - len(p.idle); n > room {
+		n = room
+	}
+	if max := p.config.MaxActive; max > 0 && n > max-p.active {
+		n = max - p.active
+	}
+	// the releases may take the connections over MaxActive
+	if n < 0 {
+		n = 0
+	}
+	p.active += n
+	p.mutex.Unlock()
+
+	if n == 0 {
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			conn, err := l.connect()
+			if err != nil {
+				p.release()
+				errs[i] = err
+				return
+			}
+			if !l.recycle(conn) {
+				l.hangUp(conn)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package mutex
+
+import (
+	"context"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+type priorityKey struct{}
+
+// PriorityContext attaches the priority to the locks acquired with the
+// context, the waiters of the higher priorities are queued ahead of the others
+// on the servers agreeing on the priorities by the negotiation. The locks have
+// the zero priority by default.
+func PriorityContext(ctx context.Context, priority uint8) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// PriorityOf returns the lock priority attached to the context
+func PriorityOf(ctx context.Context) uint8 {
+	priority, _ := ctx.Value(priorityKey{}).(uint8)
+	return priority
+}
+
+// sendsPriority reports if the server has agreed on receiving the priorities
+func (l *lockingCenter) sendsPriority() bool {
+	return l.agrees(wire.CapPriority)
+}
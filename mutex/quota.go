@@ -0,0 +1,158 @@
+package mutex
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrQuotaExceeded = errors.New("namespace quota is exceeded")
+
+// Quota limits the locking capacity of a namespace in the process, the zero
+// limits are unlimited
+type Quota struct {
+	// MaxHeld is the limit of the locks held and being acquired at once
+	MaxHeld int
+	// Rate is the limit of the operations per second with bursts up to Burst
+	Rate  float64
+	Burst int
+}
+
+// QuotaError is the operation rejected by the quota of its namespace, it
+// matches ErrQuotaExceeded
+type QuotaError struct {
+	Namespace string
+	Limit     string
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("quota of %s of namespace %q is exceeded", e.Limit, e.Namespace)
+}
+
+func (e *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// WithQuota limits the clients of the namespace, the ones without a namespace
+// for the empty one. The operations over the quota fail with a *QuotaError
+// instead of waiting, so a misbehaving module can not starve the others. Given
+// to a Transport, the quota is shared by the clients of the namespace created
+// from it.
+func WithQuota(namespace string, quota Quota) Option {
+	return func(o *options) {
+		quotas := make(map[string]Quota, len(o.quotas)+1)
+		for ns, q := range o.quotas {
+			quotas[ns] = q
+		}
+		quotas[namespace] = quota
+		o.quotas = quotas
+	}
+}
+
+// quotaState is the usage of the quota of a namespace
+type quotaState struct {
+	namespace string
+	quota     Quota
+	limiter   *rateLimiter
+
+	mutex     sync.Mutex
+	clients   map[*lockingCenter]struct{}
+	acquiring int
+}
+
+func newQuotaState(namespace string, quota Quota, clock Clock) *quotaState {
+	return &quotaState{
+		namespace: namespace,
+		quota:     quota,
+		limiter:   newRateLimiter(quota.Rate, quota.Burst, clock),
+		clients:   make(map[*lockingCenter]struct{}),
+	}
+}
+
+// joinQuota registers the client in the quota of its namespace, shared with
+// the other clients of the transport
+func (l *lockingCenter) joinQuota() {
+	quota, has := l.options.quotas[l.options.namespace]
+	if !has {
+		return
+	}
+
+	if t := l.options.transport; t != nil {
+		l.quota = t.quota(l.options.namespace, quota, l.options.clock)
+	} else {
+		l.quota = newQuotaState(l.options.namespace, quota, l.options.clock)
+	}
+
+	l.quota.mutex.Lock()
+	l.quota.clients[l] = struct{}{}
+	l.quota.mutex.Unlock()
+}
+
+func (l *lockingCenter) leaveQuota() {
+	if l.quota == nil {
+		return
+	}
+
+	l.quota.mutex.Lock()
+	delete(l.quota.clients, l)
+	l.quota.mutex.Unlock()
+}
+
+// admit takes the operation from the quota and returns its release, the locks
+// count against the held limit until they are acquired or failed. The releases
+// are not limited, so the held locks are not stranded under the load.
+func (l *lockingCenter) admit(action mutexAction) (func(), error) {
+	q := l.quota
+	if q == nil || action.releases() {
+		return func() {}, nil
+	}
+
+	if q.limiter != nil && q.limiter.reserve() > 0 {
+		q.limiter.cancel()
+		return nil, &QuotaError{Namespace: q.namespace, Limit: "operations per second"}
+	}
+
+	if action != maLock || q.quota.MaxHeld <= 0 {
+		return func() {}, nil
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.held() >= q.quota.MaxHeld {
+		return nil, &QuotaError{Namespace: q.namespace, Limit: "held locks"}
+	}
+	q.acquiring++
+
+	return func() {
+		q.mutex.Lock()
+		q.acquiring--
+		q.mutex.Unlock()
+	}, nil
+}
+
+// held counts the locks of the clients, it should be called holding the mutex
+func (q *quotaState) held() int {
+	held := q.acquiring
+	for c := range q.clients {
+		c.mutex.Lock()
+		held += len(c.held)
+		c.mutex.Unlock()
+	}
+	return held
+}
+
+func (t *Transport) quota(namespace string, quota Quota, clock Clock) *quotaState {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.quotas == nil {
+		t.quotas = make(map[string]*quotaState)
+	}
+	q, has := t.quotas[namespace]
+	if !has {
+		q = newQuotaState(namespace, quota, clock)
+		t.quotas[namespace] = q
+	}
+	return q
+}
@@ -0,0 +1,99 @@
+package mutex
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WithRateLimit limits the requests sent to the server, including the retries,
+// to rate per second with bursts up to burst requests. The operations wait for
+// their turn in the client.
+func WithRateLimit(rate float64, burst int) Option {
+	return func(o *options) {
+		o.rateLimit = rate
+		o.rateBurst = burst
+	}
+}
+
+type rateLimiter struct {
+	rate  float64
+	burst float64
+	clock Clock
+
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int, clock Clock) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		clock:  clock,
+		last:   clock.Now(),
+	}
+}
+
+// reserve takes a token and returns how long the caller should wait for it
+func (r *rateLimiter) reserve() time.Duration {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := r.clock.Now()
+	r.tokens += now.Sub(r.last).Seconds() * r.rate
+	if r.tokens > r.burst {
+		r.tokens = r.burst
+	}
+	r.last = now
+
+	r.tokens--
+	if r.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-r.tokens / r.rate * float64(time.Second))
+}
+
+// cancel gives back the token of a request that is not sent
+func (r *rateLimiter) cancel() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.tokens++
+	if r.tokens > r.burst {
+		r.tokens = r.burst
+	}
+}
+
+func (l *lockingCenter) throttle(ctx context.Context) error {
+	if l.limiter == nil {
+		return nil
+	}
+
+	delay := l.limiter.reserve()
+	if delay == 0 {
+		return nil
+	}
+
+	timer := l.options.clock.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		l.limiter.cancel()
+		return ctx.Err()
+	case <-l.abort:
+		l.limiter.cancel()
+		return ErrClosed
+	}
+}
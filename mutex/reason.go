@@ -0,0 +1,42 @@
+package mutex
+
+import (
+	"context"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+type reasonKey struct{}
+
+// ReasonContext attaches the short human-readable reason, like "nightly
+// reindex", to the locks acquired with the context, so the operators can tell
+// why a key is held from ListLocks. The reason is sent as the label of the
+// lock to the servers agreeing on the labels by the negotiation.
+func ReasonContext(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, reasonKey{}, reason)
+}
+
+// ReasonOf returns the lock reason attached to the context
+func ReasonOf(ctx context.Context) string {
+	reason, _ := ctx.Value(reasonKey{}).(string)
+	return reason
+}
+
+// splitReason separates the reason label from the other labels of a lock
+func splitReason(labels map[string]string) (map[string]string, string) {
+	reason, has := labels[wire.ReasonLabel]
+	if !has {
+		return labels, ""
+	}
+
+	others := make(map[string]string, len(labels)-1)
+	for name, value := range labels {
+		if name != wire.ReasonLabel {
+			others[name] = value
+		}
+	}
+	if len(others) == 0 {
+		others = nil
+	}
+	return others, reason
+}
@@ -0,0 +1,41 @@
+package mutex
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is an internal panic of the client, recovered and returned by the
+// operation instead of crashing the process. The panics of the functions
+// given to WithLock and the others are not recovered.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("internal panic: %v", e.Value)
+}
+
+// recovered converts the panic of the operation into its error, it must be
+// deferred directly
+func (l *lockingCenter) recovered(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	p := &PanicError{Value: r, Stack: debug.Stack()}
+	l.logf("ERROR: recovered %s\n%s", p, p.Stack)
+	*err = p
+}
+
+// rescue logs the panic of the background routine and stops it, it must be
+// deferred directly
+func (l *lockingCenter) rescue(routine string) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	l.logf("ERROR: recovered internal panic in %s: %v\n%s", routine, r, debug.Stack())
+}
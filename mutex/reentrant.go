@@ -0,0 +1,106 @@
+package mutex
+
+import (
+	"sync"
+)
+
+type reentrantHold struct {
+	token string
+	count int
+	busy  bool
+}
+
+type ReentrantLocker struct {
+	lc Locker
+
+	mutex sync.Mutex
+	cond  *sync.Cond
+	holds map[string]*reentrantHold
+}
+
+func NewReentrantLocker(lc Locker) *ReentrantLocker {
+	r := &ReentrantLocker{
+		lc:    lc,
+		holds: make(map[string]*reentrantHold),
+	}
+	r.cond = sync.NewCond(&r.mutex)
+	return r
+}
+
+func (r *ReentrantLocker) Lock(key string, token string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for {
+		h, has := r.holds[key]
+		if !has {
+			break
+		}
+		if !h.busy && h.token == token {
+			h.count++
+			return nil
+		}
+		r.cond.Wait()
+	}
+
+	h := &reentrantHold{token: token, busy: true}
+	r.holds[key] = h
+
+	r.mutex.Unlock()
+	err := r.lc.Lock(key)
+	r.mutex.Lock()
+
+	defer r.cond.Broadcast()
+
+	if err != nil {
+		delete(r.holds, key)
+		return err
+	}
+
+	h.count = 1
+	h.busy = false
+
+	return nil
+}
+
+func (r *ReentrantLocker) Unlock(key string, token string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	h, has := r.holds[key]
+	if !has || h.busy || h.token != token {
+		return ErrNotHeld
+	}
+
+	if h.count > 1 {
+		h.count--
+		return nil
+	}
+
+	h.busy = true
+
+	r.mutex.Unlock()
+	err := r.lc.Unlock(key)
+	r.mutex.Lock()
+
+	defer r.cond.Broadcast()
+
+	if err != nil {
+		h.busy = false
+		return err
+	}
+	delete(r.holds, key)
+
+	return nil
+}
+
+func (r *ReentrantLocker) Count(key string, token string) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	h, has := r.holds[key]
+	if !has || h.busy || h.token != token {
+		return 0
+	}
+	return h.count
+}
@@ -0,0 +1,81 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrNotHeld = errors.New("lock is not held by the client")
+
+// WithStrictUnlock releases every acquisition of the client at most once.
+// Unlocking a key the client has not acquired, has already released or is
+// releasing at the moment returns ErrNotHeld without reaching the server, so a
+// repeated unlock can not release the lock another node has acquired in
+// between. The keys locked by the other clients can only be released by the
+// resets then. The unlocks of Batch, Bulk and Pipeline are released once the
+// same way.
+func WithStrictUnlock() Option {
+	return func(o *options) {
+		o.strictUnlock = true
+	}
+}
+
+// unlock releases the key once for the strict unlock, the claim of the
+// release is dropped when it fails so the unlock can be tried again
+func (l *lockingCenter) unlock(key string) error {
+	if !l.options.strictUnlock || l.options.resolve().bypass {
+		return l.execute(context.Background(), maUnlock, key, nil)
+	}
+
+	h, err := l.claim(key)
+	if err != nil {
+		return err
+	}
+
+	if err := l.execute(context.Background(), maUnlock, key, nil); err != nil {
+		l.unclaim(h)
+		return err
+	}
+	return nil
+}
+
+// claimBatched claims the release of the batched, bulk or pipelined unlock for
+// the strict unlock, the claim is kept by the operation until its answer
+func (l *lockingCenter) claimBatched(operation *BatchOperation) error {
+	if operation.action != maUnlock || !l.options.strictUnlock || l.options.resolve().bypass {
+		return nil
+	}
+
+	h, err := l.claim(operation.key)
+	if err != nil {
+		return err
+	}
+	operation.claimed = h
+
+	return nil
+}
+
+// unclaim drops the claim of the release that has not reached the server or
+// is rejected by it
+func (l *lockingCenter) unclaim(h *heldLock) {
+	if h == nil {
+		return
+	}
+
+	l.mutex.Lock()
+	h.releasing = false
+	l.mutex.Unlock()
+}
+
+func (l *lockingCenter) claim(key string) (*heldLock, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	h, has := l.held[l.options.normalize(key)]
+	if !has || h.releasing {
+		return nil, ErrNotHeld
+	}
+	h.releasing = true
+
+	return h, nil
+}
@@ -0,0 +1,74 @@
+package mutex
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// WithReplicas sends the status, the list and the stats queries to the
+// read-only replicas in turn, while the locks and the other operations go to
+// the server of the client. The queries fall back to the server when no
+// replica can be connected. The answers of the replicas may lag behind the
+// server.
+func WithReplicas(addresses ...string) Option {
+	return func(o *options) {
+		o.replicas = append(o.replicas, addresses...)
+	}
+}
+
+func (o options) readsReplica(action mutexAction) bool {
+	if len(o.replicas) == 0 {
+		return false
+	}
+	return action == maStatus || action == maList || action == maStats
+}
+
+// dialReplica connects to the next replica which can be connected, the
+// connections of the replicas are not pooled
+func (l *lockingCenter) dialReplica() (net.Conn, error) {
+	if err := l.prepare(); err != nil {
+		return nil, err
+	}
+
+	replicas := l.options.replicas
+	turn := int(atomic.AddUint32(&l.replicaTurn, 1))
+
+	var lastErr error
+	for i := range replicas {
+		address := replicas[(turn+i)%len(replicas)]
+
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+
+		conn, err := l.openAddr("tcp", address, host)
+		if err != nil {
+			lastErr = &ConnError{Addr: address, Err: err}
+			continue
+		}
+
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+
+		if l.aborted {
+			_ = conn.Close()
+			return nil, ErrClosed
+		}
+		l.conns[conn] = struct{}{}
+
+		return conn, nil
+	}
+	return nil, lastErr
+}
+
+// finishReplica stops watching the connection of the replica and closes it
+func (l *lockingCenter) finishReplica(conn net.Conn, stop func()) {
+	stop()
+
+	l.mutex.Lock()
+	delete(l.conns, conn)
+	l.mutex.Unlock()
+
+	_ = conn.Close()
+}
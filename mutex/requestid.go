@@ -0,0 +1,82 @@
+package mutex
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+// WithRequestIDs gives every operation a random request id, which is sent to
+// the servers agreeing on it by WithNegotiation, shown in the logs and carried
+// by the *RequestError of the failures. The retries of an operation share its
+// id, and the middlewares see it in the wire.Request.
+func WithRequestIDs() Option {
+	return func(o *options) {
+		o.requestIDs = true
+	}
+}
+
+// WithIdempotentLocks gives every lock a request id, even without
+// WithRequestIDs, so the servers agreeing on the deduplication by
+// WithNegotiation recognize its retries. A lock retried after its answer is
+// lost, like a granted one whose connection has dropped, is then not queued
+// behind itself. The servers without the deduplication queue the retries as
+// new requests.
+func WithIdempotentLocks() Option {
+	return func(o *options) {
+		o.idempotent = true
+	}
+}
+
+// RequestError is the failure of an operation with its request id, it unwraps
+// to the failure.
+type RequestError struct {
+	ID  uint64
+	Err error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("request %016x: %s", e.ID, e.Err)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+func (l *lockingCenter) requestID(action mutexAction) uint64 {
+	if !l.options.requestIDs && !(l.options.idempotent && action == maLock) {
+		return 0
+	}
+
+	b := make([]byte, 8)
+	for {
+		if _, err := rand.Read(b); err != nil {
+			return 0
+		}
+		if id := binary.LittleEndian.Uint64(b); id != 0 {
+			return id
+		}
+	}
+}
+
+// sendsRequestID reports if the server has agreed on receiving the request ids
+func (l *lockingCenter) sendsRequestID() bool {
+	return l.agrees(wire.CapRequestID)
+}
+
+func (l *lockingCenter) failure(id uint64, err error) error {
+	if id == 0 || err == nil {
+		return err
+	}
+	return &RequestError{ID: id, Err: err}
+}
+
+// tag is the request id in the log lines
+func tag(id uint64) string {
+	if id == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" [request %016x]", id)
+}
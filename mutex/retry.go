@@ -0,0 +1,25 @@
+package mutex
+
+import (
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+// RetryObserver is called before every retry of an operation with the number
+// of the failed attempts, the error of the last one and the delay before the
+// next one. Returning false gives up the operation with the error.
+type RetryObserver func(action wire.Action, key string, attempt int, err error, delay time.Duration) bool
+
+func WithRetryObserver(observer RetryObserver) Option {
+	return func(o *options) {
+		o.retryObserver = observer
+	}
+}
+
+func (l *lockingCenter) observeRetry(action mutexAction, key string, attempt int, err error, delay time.Duration) bool {
+	if l.options.retryObserver == nil {
+		return true
+	}
+	return l.options.retryObserver(wire.Action(action), key, attempt, err, delay)
+}
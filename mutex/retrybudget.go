@@ -0,0 +1,38 @@
+package mutex
+
+import "time"
+
+// WithRetryBudget shares the retries of all the operations of the client, up
+// to n per interval with bursts up to n. A retry over the budget waits for its
+// turn on top of its delay, so during an outage the retries of the blocked
+// goroutines reach the server at the pace of the budget instead of multiplying
+// by their count. The first attempts of the operations are not counted.
+func WithRetryBudget(n int, interval time.Duration) Option {
+	return func(o *options) {
+		o.retryBudget = n
+		o.retryBudgetInterval = interval
+	}
+}
+
+func newRetryBudget(o options) *rateLimiter {
+	if o.retryBudget <= 0 || o.retryBudgetInterval <= 0 {
+		return nil
+	}
+	return newRateLimiter(float64(o.retryBudget)/o.retryBudgetInterval.Seconds(), o.retryBudget, o.clock)
+}
+
+// spendRetry takes the retry from the budget and returns how long it should
+// wait for it
+func (l *lockingCenter) spendRetry() time.Duration {
+	if l.retryBudget == nil {
+		return 0
+	}
+	return l.retryBudget.reserve()
+}
+
+// refundRetry gives back the retry that is not sent
+func (l *lockingCenter) refundRetry() {
+	if l.retryBudget != nil {
+		l.retryBudget.cancel()
+	}
+}
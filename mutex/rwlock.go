@@ -0,0 +1,92 @@
+package mutex
+
+const defaultReaderSlots = 8
+
+type RWLock struct {
+	lc  Locker
+	key string
+
+	readers *Semaphore
+}
+
+func NewRWLock(lc Locker, key string, readers int) *RWLock {
+	if readers < 1 {
+		readers = defaultReaderSlots
+	}
+
+	return &RWLock{
+		lc:      lc,
+		key:     key,
+		readers: NewSemaphore(lc, key+":r", readers),
+	}
+}
+
+func (rw *RWLock) Lock() error {
+	if err := rw.lc.Lock(rw.key); err != nil {
+		return err
+	}
+
+	if err := rw.readers.lockAll(); err != nil {
+		_ = rw.lc.Unlock(rw.key)
+		return err
+	}
+
+	return nil
+}
+
+func (rw *RWLock) Unlock() error {
+	if err := rw.readers.unlockAll(rw.readers.size); err != nil {
+		return err
+	}
+	return rw.lc.Unlock(rw.key)
+}
+
+func (rw *RWLock) RLock() error {
+	// writers hold the main key while they collect the reader slots
+	if err := rw.lc.Wait(rw.key); err != nil {
+		return err
+	}
+	return rw.readers.Acquire()
+}
+
+func (rw *RWLock) RUnlock() error {
+	return rw.readers.Release()
+}
+
+// Upgrade turns the read lock into the write lock without releasing it, so no
+// other writer can take the key in between. The read lock is kept when it
+// fails. Two readers upgrading at the same time wait for each other forever,
+// so the upgrades of a key should not run concurrently.
+func (rw *RWLock) Upgrade() error {
+	slot, err := rw.readers.take()
+	if err != nil {
+		return err
+	}
+
+	if err := rw.lc.Lock(rw.key); err != nil {
+		rw.readers.hold(slot)
+		return err
+	}
+
+	if err := rw.readers.lockExcept(slot); err != nil {
+		_ = rw.lc.Unlock(rw.key)
+		rw.readers.hold(slot)
+		return err
+	}
+	rw.readers.free(slot)
+
+	return nil
+}
+
+// Downgrade turns the write lock into a read lock without releasing it, so no
+// writer can take the key in between.
+func (rw *RWLock) Downgrade() error {
+	slot := rw.readers.claim()
+	rw.readers.hold(slot)
+
+	err := rw.readers.unlockExcept(slot, rw.readers.size)
+	if unlockErr := rw.lc.Unlock(rw.key); err == nil {
+		err = unlockErr
+	}
+	return err
+}
@@ -0,0 +1,104 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const scheduleProbeTimeout = time.Millisecond * 250
+
+// RunScheduled runs the job of a scheduler tick on a single node of the fleet
+// and reports if it has run on this node. The nodes skip the tick when the key
+// is held, and the key is kept until maxDrift after the job has started, so
+// the nodes firing late for the same tick skip it too. maxDrift should be less
+// than the interval of the ticks.
+func RunScheduled(ctx context.Context, lc Locker, key string, maxDrift time.Duration, job func() error) (bool, error) {
+	acquired, err := tryLock(ctx, lc, key)
+	if !acquired {
+		return false, err
+	}
+
+	clock := lc.Clock()
+	hold := clock.Now().Add(maxDrift + scheduleProbeTimeout)
+	defer func() {
+		release := func() { _ = lc.Unlock(key) }
+		if remaining := hold.Sub(clock.Now()); remaining > 0 {
+			clock.AfterFunc(remaining, release)
+			return
+		}
+		release()
+	}()
+
+	return true, job()
+}
+
+// tryLock gives up the key when it stays held for the probe timeout
+func tryLock(ctx context.Context, lc Locker, key string) (bool, error) {
+	lockCtx, cancel := context.WithTimeout(ctx, scheduleProbeTimeout)
+	err := lc.LockContext(lockCtx, key)
+	cancel()
+
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+type RunResult int
+
+const (
+	// Ran is the result of the function run under the key
+	Ran RunResult = iota + 1
+	// Skipped is the result when another holder has the key
+	Skipped
+	// Failed is the result when the key could not be acquired or the function
+	// has failed
+	Failed
+)
+
+func (r RunResult) String() string {
+	switch r {
+	case Ran:
+		return "ran"
+	case Skipped:
+		return "skipped"
+	case Failed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// RunExclusive runs the function under the key unless another holder has it,
+// so the callers can tell the work done by someone else from a failure. The
+// error of the release is returned with the Ran result.
+func RunExclusive(ctx context.Context, lc Locker, key string, fn func() error) (result RunResult, err error) {
+	acquired, err := tryLock(ctx, lc, key)
+	if err != nil {
+		return Failed, err
+	}
+	if !acquired {
+		return Skipped, nil
+	}
+
+	defer func() {
+		// the release should happen even fn panics
+		unlockErr := lc.Unlock(key)
+
+		if r := recover(); r != nil {
+			panic(r)
+		}
+
+		if err == nil {
+			err = unlockErr
+		}
+	}()
+
+	if err := fn(); err != nil {
+		return Failed, err
+	}
+	return Ran, nil
+}
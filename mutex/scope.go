@@ -0,0 +1,183 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrNotInScope = errors.New("key is not locked in the scope")
+
+// Scope records the keys locked through it and releases them in the reverse
+// order on Close, so a workflow failing in an intermediate step does not leak
+// its locks. The nested scopes are closed with their parent unless they are
+// closed before.
+type Scope struct {
+	lc     Locker
+	parent *Scope
+
+	mutex   sync.Mutex
+	entries []scopeEntry
+	closed  bool
+}
+
+// scopeEntry is either a locked key or a nested scope
+type scopeEntry struct {
+	key   string
+	scope *Scope
+}
+
+func NewScope(lc Locker) *Scope {
+	return &Scope{lc: lc}
+}
+
+func (s *Scope) Lock(ctx context.Context, key string) error {
+	return s.LockAll(ctx, key)
+}
+
+// LockAll locks the keys in the given order. When one of them fails, the keys
+// locked by the call are released and the scope keeps the others.
+func (s *Scope) LockAll(ctx context.Context, keys ...string) error {
+	for i, key := range keys {
+		if s.isClosed() {
+			s.rollback(keys[:i])
+			return ErrClosed
+		}
+
+		if err := s.lc.LockContext(ctx, key); err != nil {
+			s.rollback(keys[:i])
+			return err
+		}
+		s.add(scopeEntry{key: key})
+	}
+	return nil
+}
+
+func (s *Scope) rollback(keys []string) {
+	for i := len(keys) - 1; i >= 0; i-- {
+		if s.remove(keys[i]) {
+			_ = s.lc.Unlock(keys[i])
+		}
+	}
+}
+
+// Unlock releases the key before the scope is closed
+func (s *Scope) Unlock(key string) error {
+	if !s.remove(key) {
+		return ErrNotInScope
+	}
+
+	if err := s.lc.Unlock(key); err != nil {
+		s.add(scopeEntry{key: key})
+		return err
+	}
+	return nil
+}
+
+// Nested returns a scope closed with this one, its keys are released before
+// the keys locked ahead of it.
+func (s *Scope) Nested() *Scope {
+	nested := &Scope{lc: s.lc, parent: s}
+	if !s.add(scopeEntry{scope: nested}) {
+		nested.closed = true
+	}
+	return nested
+}
+
+// Keys returns the keys held by the scope and its nested scopes in the order
+// they are locked.
+func (s *Scope) Keys() []string {
+	s.mutex.Lock()
+	entries := append([]scopeEntry(nil), s.entries...)
+	s.mutex.Unlock()
+
+	var keys []string
+	for _, e := range entries {
+		if e.scope != nil {
+			keys = append(keys, e.scope.Keys()...)
+			continue
+		}
+		keys = append(keys, e.key)
+	}
+	return keys
+}
+
+// Close releases the keys of the scope and of its nested scopes in the reverse
+// order they are locked and returns the failures of the releases.
+func (s *Scope) Close() error {
+	failed := s.close()
+	if s.parent != nil {
+		s.parent.detach(s)
+	}
+	return unlockError(failed, "")
+}
+
+func (s *Scope) close() []UnlockFailure {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closed = true
+	entries := s.entries
+	s.entries = nil
+	s.mutex.Unlock()
+
+	var failed []UnlockFailure
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.scope != nil {
+			failed = append(failed, e.scope.close()...)
+			continue
+		}
+		if err := s.lc.Unlock(e.key); err != nil {
+			failed = append(failed, UnlockFailure{Key: e.key, Err: err})
+		}
+	}
+	return failed
+}
+
+func (s *Scope) isClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.closed
+}
+
+func (s *Scope) add(e scopeEntry) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.entries = append(s.entries, e)
+	return true
+}
+
+// remove forgets the last record of the key, it returns false when the scope
+// does not hold the key
+func (s *Scope) remove(key string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		if s.entries[i].scope == nil && s.entries[i].key == key {
+			s.entries = append(s.entries[:i], s.entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Scope) detach(nested *Scope) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, e := range s.entries {
+		if e.scope == nested {
+			s.entries = append(s.entries[:i], s.entries[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+// semaphoreTryWait is how long a slot is tried by a lock before the next one
+// when the server has not agreed on the status queries, so a free slot is
+// taken instead of queueing behind the holder of a busy one
+const semaphoreTryWait = 20 * time.Millisecond
+
+var errSlotBusy = errors.New("semaphore slot is busy")
+
+type Semaphore struct {
+	lc   Locker
+	key  string
+	size int
+
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	reserved map[int]int
+	held     []int
+}
+
+func NewSemaphore(lc Locker, key string, n int) *Semaphore {
+	if n < 1 {
+		n = 1
+	}
+
+	s := &Semaphore{
+		lc:       lc,
+		key:      key,
+		size:     n,
+		reserved: make(map[int]int),
+	}
+	s.cond = sync.NewCond(&s.mutex)
+	return s
+}
+
+func (s *Semaphore) slotKey(slot int) string {
+	return fmt.Sprintf("%s:%d", s.key, slot)
+}
+
+// Acquire tries every free slot before waiting in the queue of one of them.
+func (s *Semaphore) Acquire() error {
+	slot, err := s.tryAcquire()
+	if err != nil {
+		return err
+	}
+	if slot >= 0 {
+		s.hold(slot)
+		return nil
+	}
+
+	slot = s.reserve()
+	if err := s.lc.Lock(s.slotKey(slot)); err != nil {
+		s.free(slot)
+		return err
+	}
+
+	s.hold(slot)
+
+	return nil
+}
+
+func (s *Semaphore) Release() error {
+	slot, err := s.take()
+	if err != nil {
+		return err
+	}
+
+	if err := s.lc.Unlock(s.slotKey(slot)); err != nil {
+		s.hold(slot)
+		return err
+	}
+	s.free(slot)
+
+	return nil
+}
+
+// tryAcquire tries the slots one by one without waiting in their queues, it
+// returns -1 when none of them is granted. The free slots are found by the
+// status queries, or by the locks given up after semaphoreTryWait when the
+// server has agreed on abandoning them in the queue. Without either of them
+// the slots are not tried, a lock given up in the queue of a busy slot would
+// be granted later and hold the slot.
+func (s *Semaphore) tryAcquire() (int, error) {
+	l, ok := s.lc.(*lockingCenter)
+	if !ok {
+		return -1, nil
+	}
+	status := l.agrees(wire.CapStatus)
+	if !status && !l.agrees(wire.CapAbandon) {
+		return -1, nil
+	}
+
+	offset := rand.Intn(s.size)
+	for i := 0; i < s.size; i++ {
+		slot := (offset + i) % s.size
+		if !s.reserveFree(slot) {
+			continue
+		}
+
+		var err error
+		if status {
+			err = s.tryStatus(l, slot)
+		} else {
+			err = s.tryLock(slot)
+		}
+
+		if err == nil {
+			return slot, nil
+		}
+		s.free(slot)
+
+		if err != errSlotBusy {
+			return -1, err
+		}
+	}
+	return -1, nil
+}
+
+// tryStatus locks the slot when the server reports it free
+func (s *Semaphore) tryStatus(l *lockingCenter, slot int) error {
+	locked, err := l.IsLocked(s.slotKey(slot))
+	if err != nil {
+		return err
+	}
+	if locked {
+		return errSlotBusy
+	}
+	return s.lc.Lock(s.slotKey(slot))
+}
+
+// tryLock locks the slot if it is granted in semaphoreTryWait, the lock is
+// abandoned in the queue afterwards
+func (s *Semaphore) tryLock(slot int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), semaphoreTryWait)
+	defer cancel()
+
+	err := s.lc.LockContext(ctx, s.slotKey(slot))
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errSlotBusy
+	}
+	return err
+}
+
+func (s *Semaphore) hold(slot int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.held = append(s.held, slot)
+}
+
+// take removes the last acquired slot from the held ones, it stays reserved
+func (s *Semaphore) take() (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.held) == 0 {
+		return 0, ErrNotHeld
+	}
+	slot := s.held[len(s.held)-1]
+	s.held = s.held[:len(s.held)-1]
+
+	return slot, nil
+}
+
+func (s *Semaphore) reserve() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for {
+		offset := rand.Intn(s.size)
+		for i := 0; i < s.size; i++ {
+			slot := (offset + i) % s.size
+			if s.reserved[slot] == 0 {
+				s.reserved[slot]++
+				return slot
+			}
+		}
+		s.cond.Wait()
+	}
+}
+
+// reserveFree reserves the slot when it is not reserved already
+func (s *Semaphore) reserveFree(slot int) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.reserved[slot] > 0 {
+		return false
+	}
+	s.reserved[slot]++
+
+	return true
+}
+
+func (s *Semaphore) free(slot int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.reserved[slot]--; s.reserved[slot] <= 0 {
+		delete(s.reserved, slot)
+	}
+	s.cond.Signal()
+}
+
+// claim reserves a slot without waiting, it is one of the reserved ones when
+// there is no free slot
+func (s *Semaphore) claim() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	slot := 0
+	for i := 0; i < s.size; i++ {
+		if s.reserved[i] == 0 {
+			slot = i
+			break
+		}
+	}
+	s.reserved[slot]++
+
+	return slot
+}
+
+func (s *Semaphore) lockAll() error {
+	for slot := 0; slot < s.size; slot++ {
+		if err := s.lc.Lock(s.slotKey(slot)); err != nil {
+			_ = s.unlockAll(slot)
+			return err
+		}
+	}
+	return nil
+}
+
+// lockExcept locks every slot but the given one
+func (s *Semaphore) lockExcept(kept int) error {
+	for slot := 0; slot < s.size; slot++ {
+		if slot == kept {
+			continue
+		}
+		if err := s.lc.Lock(s.slotKey(slot)); err != nil {
+			_ = s.unlockExcept(kept, slot)
+			return err
+		}
+	}
+	return nil
+}
+
+// unlockExcept unlocks the slots below the count but the given one
+func (s *Semaphore) unlockExcept(kept int, count int) error {
+	var lastErr error
+	for slot := count - 1; slot >= 0; slot-- {
+		if slot == kept {
+			continue
+		}
+		if err := s.lc.Unlock(s.slotKey(slot)); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (s *Semaphore) unlockAll(count int) error {
+	var lastErr error
+	for slot := count - 1; slot >= 0; slot-- {
+		if err := s.lc.Unlock(s.slotKey(slot)); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
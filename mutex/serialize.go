@@ -0,0 +1,142 @@
+package mutex
+
+import (
+	"context"
+)
+
+// keyGate is guarded by the mutex of the client
+type keyGate struct {
+	busy  bool
+	queue []chan struct{}
+	refs  int
+
+	// the remote lock of the key held for the next goroutine
+	source   *string
+	remote   bool
+	handOffs int
+}
+
+// WithKeySerialization makes the goroutines locking the same key wait for each
+// other in the client, so only one lock request of the key is outstanding on
+// the server at a time. The key is passed to the next goroutine in the arrival
+// order when it is unlocked or reset.
+func WithKeySerialization() Option {
+	return func(o *options) {
+		o.serializeKeys = true
+	}
+}
+
+// pass lets the next goroutine waiting for the key in
+func (g *keyGate) pass() {
+	if len(g.queue) == 0 {
+		g.busy = false
+		return
+	}
+
+	next := g.queue[0]
+	g.queue = g.queue[1:]
+	close(next)
+}
+
+// dequeue removes the turn of a goroutine giving up, it returns false when the
+// turn has already come
+func (g *keyGate) dequeue(turn chan struct{}) bool {
+	for i, queued := range g.queue {
+		if queued == turn {
+			g.queue = append(g.queue[:i], g.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (l *lockingCenter) enterGate(ctx context.Context, key string) error {
+	l.mutex.Lock()
+	g, has := l.gates[key]
+	if !has {
+		g = &keyGate{}
+		l.gates[key] = g
+	}
+	g.refs++
+
+	if !g.busy {
+		g.busy = true
+		l.mutex.Unlock()
+		return nil
+	}
+
+	turn := make(chan struct{})
+	g.queue = append(g.queue, turn)
+	l.mutex.Unlock()
+
+	var err error
+	select {
+	case <-turn:
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-l.abort:
+		err = ErrClosed
+	}
+
+	l.mutex.Lock()
+	if !g.dequeue(turn) {
+		g.pass()
+	}
+	l.mutex.Unlock()
+
+	l.dropGate(key, g)
+	return err
+}
+
+func (l *lockingCenter) exitGate(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.leaveGate(key)
+}
+
+// leaveGate lets the next goroutine waiting for the key in, it should be called
+// holding the mutex
+func (l *lockingCenter) leaveGate(key string) {
+	g, has := l.gates[key]
+	if !has || !g.busy {
+		return
+	}
+
+	g.pass()
+	g.refs--
+	if g.refs == 0 {
+		delete(l.gates, key)
+	}
+}
+
+func (l *lockingCenter) dropGate(key string, g *keyGate) {
+	l.mutex.Lock()
+	g.refs--
+	passed := false
+	if g.refs == 0 {
+		delete(l.gates, key)
+		passed = g.remote
+		g.remote = false
+	}
+	l.mutex.Unlock()
+
+	// nobody is left to take the passed remote lock
+	if passed {
+		if err := l.release(context.Background(), key); err != nil {
+			l.logf("WARN: unlocking error: %s\n", err)
+		}
+	}
+}
+
+// releaseHeld forgets all the held locks, it should be called holding the
+// mutex
+func (l *lockingCenter) releaseHeld() {
+	for key, h := range l.held {
+		h.stopTimers()
+		l.leaveGate(key)
+	}
+	l.passed()
+	l.held = make(map[string]*heldLock)
+}
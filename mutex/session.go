@@ -0,0 +1,135 @@
+package mutex
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+// WithSession tags the locks of the client with the session id by using it as
+// their source address. When the server agrees on the sessions by
+// WithNegotiation, the client keeps the session registered on a connection of
+// its own and the server releases the locks of the session once that
+// connection dies. Otherwise the client resets the locks left by the session
+// when it is created, so the id should be unique to the process and stable
+// across its restarts, like the name of the pod.
+func WithSession(id string) Option {
+	return func(o *options) {
+		o.session = id
+	}
+}
+
+func (l *lockingCenter) startSession() error {
+	id := l.options.session
+
+	if !l.sendsSession() {
+		// the locks of a crashed previous run are released by the client
+		if l.options.lazyConnect {
+			return l.resetSource(&id)
+		}
+		return l.ResetBySource(&id)
+	}
+
+	conn, err := l.register()
+	if err != nil {
+		return err
+	}
+	go l.keepSession(conn)
+
+	return nil
+}
+
+func (l *lockingCenter) sendsSession() bool {
+	return l.agrees(wire.CapSessions)
+}
+
+func (l *lockingCenter) register() (net.Conn, error) {
+	conn, err := l.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.query(conn, maSession, "", &l.options.session, 0); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.aborted {
+		_ = conn.Close()
+		return nil, ErrClosed
+	}
+	l.session = conn
+
+	return conn, nil
+}
+
+// keepSession registers the session again when its connection dies. The server
+// has released the locks of the session by then, so the held locks are
+// forgotten.
+func (l *lockingCenter) keepSession(conn net.Conn) {
+	defer l.rescue("session keeper")
+
+	for {
+		_, _ = io.Copy(ioutil.Discard, conn)
+		_ = conn.Close()
+
+		if l.isAborted() {
+			return
+		}
+
+		l.mutex.Lock()
+		lost := len(l.held)
+		l.releaseHeld()
+		l.session = nil
+		l.mutex.Unlock()
+
+		l.logf("WARN: session %s is lost, %d held lock(s) are released by the server\n", l.options.session, lost)
+
+		for {
+			var err error
+			if conn, err = l.register(); err == nil {
+				break
+			}
+			if err == ErrClosed {
+				return
+			}
+			l.logf("WARN: session registration error (keep trying): %s\n", err)
+
+			select {
+			case <-l.abort:
+				return
+			case <-after(l.options.clock, l.options.resolve().retryInterval):
+			}
+		}
+	}
+}
+
+// endSession closes the connection of the session, it should be called once
+// the held locks are released on shutdown
+func (l *lockingCenter) endSession() {
+	l.mutex.Lock()
+	conn := l.session
+	l.session = nil
+	l.mutex.Unlock()
+
+	if conn != nil {
+		_ = conn.Close()
+	}
+}
+
+// resetSource releases the locks of the source on a connection of its own
+// without the retries
+func (l *lockingCenter) resetSource(sourceAddr *string) error {
+	conn, err := l.connect()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	return l.query(conn, maResetBySource, "", sourceAddr, 0)
+}
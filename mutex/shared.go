@@ -0,0 +1,81 @@
+package mutex
+
+import (
+	"context"
+	"sync"
+)
+
+var shared = struct {
+	mutex   sync.Mutex
+	clients map[string]*sharedClient
+}{clients: make(map[string]*sharedClient)}
+
+type sharedClient struct {
+	LockingCenter
+	address string
+	refs    int
+}
+
+// sharedHandle is a reference to the shared client, closing it releases only
+// the reference until it is the last one
+type sharedHandle struct {
+	*sharedClient
+	once sync.Once
+}
+
+// GetOrCreate returns the client of the address shared in the process, so the
+// libraries embedded in the same binary do not open their own pools to the
+// same server. The client is created by the options of the first call, the
+// options of the later calls are ignored. Every returned client must be
+// closed, the shared one is closed by the last Close or Drain.
+func GetOrCreate(address string, opts ...Option) (LockingCenter, error) {
+	shared.mutex.Lock()
+	defer shared.mutex.Unlock()
+
+	c, has := shared.clients[address]
+	if !has {
+		lc, err := NewLockingCenter(address, opts...)
+		if err != nil {
+			return nil, err
+		}
+		c = &sharedClient{LockingCenter: lc, address: address}
+		shared.clients[address] = c
+	}
+	c.refs++
+
+	return &sharedHandle{sharedClient: c}, nil
+}
+
+func (h *sharedHandle) Close() *ShutdownReport {
+	return h.release(func(lc LockingCenter) *ShutdownReport {
+		return lc.Close()
+	})
+}
+
+func (h *sharedHandle) Drain(ctx context.Context) *ShutdownReport {
+	return h.release(func(lc LockingCenter) *ShutdownReport {
+		return lc.Drain(ctx)
+	})
+}
+
+// release drops the reference of the handle once, shutting the shared client
+// down when it is the last one
+func (h *sharedHandle) release(shutdown func(lc LockingCenter) *ShutdownReport) *ShutdownReport {
+	last := false
+	h.once.Do(func() {
+		shared.mutex.Lock()
+		defer shared.mutex.Unlock()
+
+		h.refs--
+		if h.refs > 0 {
+			return
+		}
+		delete(shared.clients, h.address)
+		last = true
+	})
+
+	if !last {
+		return &ShutdownReport{}
+	}
+	return shutdown(h.LockingCenter)
+}
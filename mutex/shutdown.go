@@ -0,0 +1,209 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+type UnlockFailure struct {
+	Key string
+	Err error
+}
+
+type ShutdownReport struct {
+	Released          []string
+	FailedUnlocks     []UnlockFailure
+	AbortedWaiters    []string
+	ClosedConnections int
+}
+
+// WithCloseTimeout makes Close wait for the in-flight operations to complete
+// up to the timeout, like Drain, before it aborts the rest and closes the
+// connections.
+func WithCloseTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.closeTimeout = timeout
+	}
+}
+
+// Err reports the locks that could not be released and the operations that
+// had to be aborted by the shutdown
+func (r *ShutdownReport) Err() error {
+	var failures []string
+	if err := unlockError(r.FailedUnlocks, " on shutdown"); err != nil {
+		failures = append(failures, err.Error())
+	}
+	if len(r.AbortedWaiters) > 0 {
+		failures = append(failures, fmt.Sprintf("aborted %d operation(s) on shutdown: %s", len(r.AbortedWaiters), strings.Join(r.AbortedWaiters, ", ")))
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(failures, "; "))
+}
+
+func unlockError(failed []UnlockFailure, when string) error {
+	if len(failed) == 0 {
+		return nil
+	}
+
+	failures := make([]string, 0, len(failed))
+	for _, f := range failed {
+		failures = append(failures, fmt.Sprintf("%s: %s", f.Key, f.Err))
+	}
+	return fmt.Errorf("unable to release %d lock(s)%s: %s", len(failures), when, strings.Join(failures, ", "))
+}
+
+// ReleaseAll unlocks every key held by the client, including the owned ones,
+// until the context is done. The client remains usable.
+func (l *lockingCenter) ReleaseAll(ctx context.Context) error {
+	l.mutex.Lock()
+	keys := l.heldKeys()
+	l.mutex.Unlock()
+
+	_, failed := l.releaseKeys(ctx, keys)
+	return unlockError(failed, "")
+}
+
+// heldKeys should be called holding the mutex
+func (l *lockingCenter) heldKeys() []string {
+	keys := make([]string, 0, len(l.held))
+	for key := range l.held {
+		keys = append(keys, key)
+	}
+	return append(keys, l.passed()...)
+}
+
+func (l *lockingCenter) releaseKeys(ctx context.Context, keys []string) ([]string, []UnlockFailure) {
+	var released []string
+	var failed []UnlockFailure
+
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			failed = append(failed, UnlockFailure{Key: key, Err: err})
+			continue
+		}
+		if err := l.release(ctx, key); err != nil {
+			failed = append(failed, UnlockFailure{Key: key, Err: err})
+			continue
+		}
+		l.track(maUnlock, key, nil)
+		released = append(released, key)
+	}
+
+	return released, failed
+}
+
+func (l *lockingCenter) Drain(ctx context.Context) *ShutdownReport {
+	if !l.stop() {
+		return &ShutdownReport{}
+	}
+	return l.drain(ctx)
+}
+
+func (l *lockingCenter) Close() *ShutdownReport {
+	if !l.stop() {
+		return &ShutdownReport{}
+	}
+	if timeout := l.options.closeTimeout; timeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		return l.drain(ctx)
+	}
+	return l.shutdown()
+}
+
+// drain waits for the in-flight operations until the context is done before
+// the shutdown
+func (l *lockingCenter) drain(ctx context.Context) *ShutdownReport {
+	drained := make(chan struct{})
+	go func() {
+		l.inFlight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+	}
+
+	return l.shutdown()
+}
+
+func (l *lockingCenter) stop() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		return false
+	}
+	l.closed = true
+
+	return true
+}
+
+func (l *lockingCenter) shutdown() *ShutdownReport {
+	report := &ShutdownReport{}
+
+	l.mutex.Lock()
+	l.aborted = true
+	close(l.abort)
+
+	for op := range l.pending {
+		report.AbortedWaiters = append(report.AbortedWaiters, op.key)
+	}
+
+	for conn := range l.conns {
+		_ = conn.Close()
+		report.ClosedConnections++
+	}
+	l.conns = make(map[net.Conn]struct{})
+	l.closeMux()
+	if l.options.transport == nil {
+		report.ClosedConnections += l.pool.close()
+	}
+	l.mutex.Unlock()
+
+	l.inFlight.Wait()
+
+	l.mutex.Lock()
+	held := l.heldKeys()
+	l.held = make(map[string]*heldLock)
+	l.mutex.Unlock()
+	l.leaveQuota()
+
+	report.Released, report.FailedUnlocks = l.releaseKeys(context.Background(), held)
+	l.endSession()
+
+	return report
+}
+
+func (l *lockingCenter) release(ctx context.Context, key string) error {
+	started := time.Now()
+
+	conn, err := l.connect()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if err := l.bound(conn, maUnlock, started); err != nil {
+		return err
+	}
+
+	stop := l.watch(ctx, conn)
+	defer stop()
+
+	if err := l.query(conn, maUnlock, key, nil, 0); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package mutex
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ReleaseOnSignal installs the handlers of SIGINT and SIGTERM releasing the
+// locks of the client, and the ones of the source address when it is given,
+// within the timeout before the process exits by the signal. The returned
+// function removes the handlers.
+func ReleaseOnSignal(lc LockingCenter, timeout time.Duration, sourceAddr *string) func() {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			signal.Stop(signals)
+			cleanUp(lc, timeout, sourceAddr)
+			exit(sig)
+		case <-done:
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(done)
+		})
+	}
+}
+
+func cleanUp(lc LockingCenter, timeout time.Duration, sourceAddr *string) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cleaned := make(chan struct{})
+	go func() {
+		defer close(cleaned)
+
+		_ = lc.ReleaseAll(ctx)
+		if sourceAddr != nil && ctx.Err() == nil {
+			_ = lc.ResetBySource(sourceAddr)
+		}
+		lc.Drain(ctx)
+	}()
+
+	select {
+	case <-cleaned:
+	case <-ctx.Done():
+	}
+}
+
+// exit raises the signal again to terminate the process the way it would be
+// without the handler
+func exit(sig os.Signal) {
+	if p, err := os.FindProcess(os.Getpid()); err == nil && p.Signal(sig) == nil {
+		time.Sleep(time.Second)
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,121 @@
+package mutex
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+type sourceKey struct{}
+
+// SourceContext attaches the source address to the locks acquired with the
+// context, so the middleware establishing who is locking once per request does
+// not thread it to every call. The source address given to a call explicitly
+// has the precedence over it.
+func SourceContext(ctx context.Context, sourceAddr string) context.Context {
+	return context.WithValue(ctx, sourceKey{}, sourceAddr)
+}
+
+// SourceOf returns the source address attached to the context
+func SourceOf(ctx context.Context) (string, bool) {
+	sourceAddr, has := ctx.Value(sourceKey{}).(string)
+	return sourceAddr, has
+}
+
+// sourceOf is the source address attached to the context, or the one of the
+// client
+func (l *lockingCenter) sourceOf(ctx context.Context) *string {
+	if sourceAddr, has := SourceOf(ctx); has {
+		return &sourceAddr
+	}
+	return l.sourceAddr
+}
+
+func WithSourceIdentity(identity string) Option {
+	return func(o *options) {
+		o.sourceIdentity = &identity
+	}
+}
+
+// WithSourceTemplate uses the identity generated from the template as the
+// source address when the client is not given one, so ResetBySource can clean
+// up the locks of the process without the call sites building the identity.
+// The template can have the {hostname}, {pid}, {program} (the name of the
+// executable), {namespace} and {label} (the LOCKING_CENTER_SOURCE_LABEL
+// environment variable) placeholders.
+func WithSourceTemplate(template string) Option {
+	return func(o *options) {
+		o.sourceTemplate = template
+	}
+}
+
+var sourcePlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// sourceIdentityOf is the identity of the client, generated from the source
+// template when it is not given by WithSourceIdentity
+func (o options) sourceIdentityOf() (*string, error) {
+	if o.sourceIdentity != nil || len(o.sourceTemplate) == 0 {
+		return o.sourceIdentity, nil
+	}
+
+	var err error
+	identity := sourcePlaceholder.ReplaceAllStringFunc(o.sourceTemplate, func(placeholder string) string {
+		switch placeholder {
+		case "{hostname}":
+			hostname, hErr := os.Hostname()
+			if hErr != nil && err == nil {
+				err = fmt.Errorf("source template hostname can not be resolved: %s", hErr)
+			}
+			return hostname
+		case "{pid}":
+			return strconv.Itoa(os.Getpid())
+		case "{program}":
+			return filepath.Base(os.Args[0])
+		case "{namespace}":
+			return o.namespace
+		case "{label}":
+			return os.Getenv(EnvSourceLabel)
+		}
+		if err == nil {
+			err = fmt.Errorf("source template placeholder %s is not known", placeholder)
+		}
+		return placeholder
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// WithAutoSourceAddr uses the local ip address of the connection to the server
+// as the source address when the client is not given one
+func WithAutoSourceAddr() Option {
+	return func(o *options) {
+		o.autoSourceAddr = true
+	}
+}
+
+func (l *lockingCenter) detectSourceAddr(conn net.Conn) {
+	if l.sourceAddr != nil {
+		return
+	}
+
+	if l.options.sourceIdentity != nil {
+		l.sourceAddr = l.options.sourceIdentity
+		return
+	}
+
+	if !l.options.autoSourceAddr {
+		return
+	}
+
+	host, _, err := net.SplitHostPort(conn.LocalAddr().String())
+	if err != nil {
+		return
+	}
+	l.sourceAddr = &host
+}
@@ -0,0 +1,89 @@
+package mutex
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// KeyStats is the number of the waiters queued for a key
+type KeyStats struct {
+	Key     string
+	Waiters int
+}
+
+// KeyspaceStats aggregates the keys of the namespace of the client.
+// Contended are the keys with the most waiters in the descending order.
+type KeyspaceStats struct {
+	LockedKeys int
+	Waiters    int
+	Contended  []KeyStats
+}
+
+// Stats returns the numbers of the locked keys and of their waiters with the
+// top contended keys. The stats query needs the support of the server.
+func (l *lockingCenter) Stats(top int) (KeyspaceStats, error) {
+	payload, err := l.inquire(context.Background(), maStats, "", nil)
+	if err != nil {
+		return KeyspaceStats{}, err
+	}
+	return l.decodeStats(payload, top)
+}
+
+// decodeStats reads the uint32 count of the entries, each of them is the key
+// prefixed by its uint8 size or by its uvarint size for the v2 frames, the
+// uint8 lock state and the uint32 number of
+// the waiters
+func (l *lockingCenter) decodeStats(payload []byte, top int) (KeyspaceStats, error) {
+	var stats KeyspaceStats
+	if len(payload) == 0 {
+		return stats, nil
+	}
+
+	r := &payloadReader{payload: payload, varint: l.framesV2()}
+
+	count := r.uint32()
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		key := r.string()
+		locked := r.next(1)
+		waiters := int(r.uint32())
+
+		if len(l.options.namespace) > 0 {
+			prefix := l.options.qualify("")
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			key = strings.TrimPrefix(key, prefix)
+		}
+
+		if locked != nil && locked[0] == 1 {
+			stats.LockedKeys++
+		}
+		stats.Waiters += waiters
+		if waiters > 0 {
+			stats.Contended = append(stats.Contended, KeyStats{Key: key, Waiters: waiters})
+		}
+	}
+	if r.err != nil {
+		return KeyspaceStats{}, r.err
+	}
+
+	stats.Contended = TopContended(stats.Contended, top)
+
+	return stats, nil
+}
+
+// TopContended sorts the keys by their waiters and keeps the top of them, the
+// keys of the same waiters are sorted by their names.
+func TopContended(keys []KeyStats, top int) []KeyStats {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Waiters != keys[j].Waiters {
+			return keys[i].Waiters > keys[j].Waiters
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	if top >= 0 && len(keys) > top {
+		keys = keys[:top]
+	}
+	return keys
+}
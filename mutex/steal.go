@@ -0,0 +1,75 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+var ErrNotStale = errors.New("lock is not held long enough to be stolen")
+
+// StealError is the steal of a key held for less than the threshold, it
+// matches ErrNotStale
+type StealError struct {
+	Key        string
+	SourceAddr string
+	HeldFor    time.Duration
+}
+
+func (e *StealError) Error() string {
+	return fmt.Sprintf("key %s is held by %s for %s only", e.Key, e.SourceAddr, e.HeldFor.Round(time.Millisecond))
+}
+
+func (e *StealError) Unwrap() error {
+	return ErrNotStale
+}
+
+// StealPriority is the priority of the locks taking the stolen keys over
+const StealPriority = math.MaxUint8
+
+// Steal takes the key over from its holder when it has been held longer than
+// olderThan, for the workers healing the locks of their crashed peers. The
+// holder is reset by the key and the lock is queued by StealPriority, ahead of
+// the waiters on the servers agreeing on the priorities. The free keys are
+// locked as usual and the ones held by the client are kept, the recent holders
+// fail it with a *StealError.
+//
+// The hold durations are asked by the list query, so a holder replacing the
+// stale one between the query and the reset is reset as well.
+func (l *lockingCenter) Steal(key string, olderThan time.Duration) (err error) {
+	defer l.recovered(&err)
+
+	normalized := l.options.normalize(key)
+
+	l.mutex.Lock()
+	_, held := l.held[normalized]
+	l.mutex.Unlock()
+	if held {
+		return nil
+	}
+
+	locks, err := l.ListLocks()
+	if err != nil {
+		return err
+	}
+
+	ctx := PriorityContext(context.Background(), StealPriority)
+	for _, lock := range locks {
+		if lock.Key != normalized {
+			continue
+		}
+		if lock.HeldFor < olderThan {
+			return &StealError{Key: key, SourceAddr: lock.SourceAddr, HeldFor: lock.HeldFor}
+		}
+
+		l.logf("WARN: stealing the lock of %s held by %s for %s\n", key, lock.SourceAddr, lock.HeldFor)
+		if err := l.ResetByKey(key); err != nil {
+			return err
+		}
+		break
+	}
+
+	return l.LockContext(ctx, key)
+}
@@ -0,0 +1,75 @@
+package mutex
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// Striped hashes the keys onto a fixed number of stripe keys, so the keyspace
+// and the queues of the server stay bounded for the millions of distinct keys.
+// The keys sharing a stripe exclude each other, which is tolerable for the
+// coarse-grained exclusion.
+type Striped struct {
+	lc   LockingCenter
+	name string
+	n    int
+}
+
+// NewStriped stripes the keys onto n keys of the name, "name:0" to "name:n-1",
+// at least one
+func NewStriped(lc LockingCenter, name string, n int) Striped {
+	if n < 1 {
+		n = 1
+	}
+	return Striped{lc: lc, name: name, n: n}
+}
+
+// Stripe returns the stripe key of the key
+func (s Striped) Stripe(key string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return fmt.Sprintf("%s:%d", s.name, h.Sum32()%uint32(s.n))
+}
+
+func (s Striped) Lock(key string) error {
+	return s.lc.Lock(s.Stripe(key))
+}
+
+func (s Striped) LockContext(ctx context.Context, key string) error {
+	return s.lc.LockContext(ctx, s.Stripe(key))
+}
+
+func (s Striped) Unlock(key string) error {
+	return s.lc.Unlock(s.Stripe(key))
+}
+
+// LockAll locks the stripes of the keys once each, in the canonical order
+func (s Striped) LockAll(keys ...string) error {
+	return s.lc.LockAll(s.stripes(keys), nil)
+}
+
+func (s Striped) UnlockAll(keys ...string) error {
+	return s.lc.UnlockAll(s.stripes(keys))
+}
+
+func (s Striped) IsLocked(key string) (bool, error) {
+	return s.lc.IsLocked(s.Stripe(key))
+}
+
+func (s Striped) WithLock(ctx context.Context, key string, fn func() error) error {
+	return s.lc.WithLock(ctx, s.Stripe(key), fn)
+}
+
+func (s Striped) Locker(key string) sync.Locker {
+	return s.lc.Locker(s.Stripe(key))
+}
+
+func (s Striped) stripes(keys []string) []string {
+	stripes := make([]string, 0, len(keys))
+	for _, key := range keys {
+		stripes = append(stripes, s.Stripe(key))
+	}
+	return stripes
+}
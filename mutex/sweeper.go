@@ -0,0 +1,110 @@
+package mutex
+
+import (
+	"context"
+	"time"
+)
+
+const defaultSweepInterval = time.Minute
+
+// SweeperConfig decides the locks reset by the Sweeper. The locks held longer
+// than MaxAge by the sources IsDead reports are stale, every source is dead
+// when IsDead is nil. OnStale is called for each stale lock and returning false
+// keeps it. Nothing is reset on a DryRun, the stale locks are only reported.
+type SweeperConfig struct {
+	Interval time.Duration
+	MaxAge   time.Duration
+	IsDead   func(sourceAddr string) bool
+	OnStale  func(lock LockInfo) bool
+	OnError  func(err error)
+	DryRun   bool
+}
+
+// Sweeper lists the locks periodically and resets the stale ones left behind
+// by the crashed holders.
+type Sweeper struct {
+	lc     LockingCenter
+	config SweeperConfig
+}
+
+func NewSweeper(lc LockingCenter, config SweeperConfig) *Sweeper {
+	if config.Interval <= 0 {
+		config.Interval = defaultSweepInterval
+	}
+	return &Sweeper{lc: lc, config: config}
+}
+
+// Run sweeps on every interval until the context is done, the failures are
+// given to OnError.
+func (s *Sweeper) Run(ctx context.Context) error {
+	ticker := s.lc.Clock().NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Sweep(); err != nil && s.config.OnError != nil {
+			s.config.OnError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C():
+		}
+	}
+}
+
+// Sweep resets the stale locks once and returns them. The locks are listed
+// again before the reset and only the ones still held by the same source
+// since the first listing are reset, so a key taken over in between is kept.
+func (s *Sweeper) Sweep() ([]LockInfo, error) {
+	locks, err := s.lc.ListLocks()
+	if err != nil {
+		return nil, err
+	}
+
+	stale := make([]LockInfo, 0)
+	for _, lock := range locks {
+		if !s.isStale(lock) {
+			continue
+		}
+		if s.config.OnStale != nil && !s.config.OnStale(lock) {
+			continue
+		}
+		stale = append(stale, lock)
+	}
+	if s.config.DryRun || len(stale) == 0 {
+		return stale, nil
+	}
+
+	current, err := s.lc.ListLocks()
+	if err != nil {
+		return nil, err
+	}
+	holds := make(map[string]LockInfo, len(current))
+	for _, lock := range current {
+		holds[lock.Key] = lock
+	}
+
+	swept := stale[:0]
+	keys := make([]string, 0, len(stale))
+	for _, lock := range stale {
+		hold, has := holds[lock.Key]
+		if !has || hold.SourceAddr != lock.SourceAddr || hold.HeldFor < lock.HeldFor {
+			continue
+		}
+		swept = append(swept, lock)
+		keys = append(keys, lock.Key)
+	}
+	if len(keys) == 0 {
+		return swept, nil
+	}
+
+	return swept, s.lc.ResetKeys(keys)
+}
+
+func (s *Sweeper) isStale(lock LockInfo) bool {
+	if lock.HeldFor < s.config.MaxAge {
+		return false
+	}
+	return s.config.IsDead == nil || s.config.IsDead(lock.SourceAddr)
+}
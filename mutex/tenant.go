@@ -0,0 +1,50 @@
+package mutex
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrCrossNamespace = errors.New("operation crosses the namespace of the tenant")
+
+// WithTenant confines the client to the namespace of the tenant, for the
+// platforms exposing the locks to the untrusted internal tenants. Every key
+// sent is verified to be in the namespace, and the resets by the source
+// address and of all the keys, which reach the other namespaces, are rejected
+// with ErrCrossNamespace without contacting the server. The namespace can not
+// contain the "/" separator, so no tenant can be nested in another one.
+func WithTenant(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+		o.tenant = true
+	}
+}
+
+func (o options) validateTenant() error {
+	if !o.tenant {
+		return nil
+	}
+	if len(o.namespace) == 0 || strings.Contains(o.namespace, namespaceSeparator) {
+		return fmt.Errorf("tenant namespace %q can not be empty or contain %s", o.namespace, namespaceSeparator)
+	}
+	return nil
+}
+
+// crossesTenant reports if the action reaches beyond the namespace of the
+// tenant regardless of its key
+func (o options) crossesTenant(action mutexAction) bool {
+	return o.tenant && (action == maResetBySource || action == maResetAll)
+}
+
+// confine verifies the frame of the action stays in the namespace of the
+// tenant, the key is the encoded one
+func (o options) confine(action mutexAction, key string) error {
+	if !o.tenant {
+		return nil
+	}
+	if o.crossesTenant(action) || (action.hasKey() && !strings.HasPrefix(key, o.namespace+namespaceSeparator)) {
+		return ErrCrossNamespace
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package mutex
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+// WithOperationTimeout bounds every exchange with the server, from the dial to
+// the answer, so a wedged connection fails the exchange and it is retried like
+// the other connection failures. The answer of a lock waits for the grant, so
+// only its dial and write are bounded.
+func WithOperationTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.operationTimeout = d
+	}
+}
+
+// bound sets the deadline of the exchange started at the given time on the
+// connection, it should be called before watching the connection.
+func (l *lockingCenter) bound(conn net.Conn, action mutexAction, started time.Time) error {
+	if l.options.operationTimeout <= 0 {
+		return nil
+	}
+
+	deadline := started.Add(l.options.operationTimeout)
+	if action == maLock {
+		return conn.SetWriteDeadline(deadline)
+	}
+	return conn.SetDeadline(deadline)
+}
+
+// boundedDialTimeout limits the dial timeout by the operation timeout
+func (o options) boundedDialTimeout(timeout time.Duration) time.Duration {
+	if o.operationTimeout > 0 && (timeout <= 0 || o.operationTimeout < timeout) {
+		return o.operationTimeout
+	}
+	return timeout
+}
+
+// WithActionTimeout bounds the operations of the action as a whole, including
+// their retries, so the cleanup ones like unlock fail fast while the locks can
+// wait longer. The operation fails with context.DeadlineExceeded once the
+// timeout has passed, an earlier deadline of its context is kept.
+func WithActionTimeout(action wire.Action, d time.Duration) Option {
+	return func(o *options) {
+		if o.actionTimeouts == nil {
+			o.actionTimeouts = make(map[wire.Action]time.Duration)
+		}
+		o.actionTimeouts[action] = d
+	}
+}
+
+// actionContext returns the context bounded by the timeout of the action
+func (l *lockingCenter) actionContext(ctx context.Context, action mutexAction) (context.Context, context.CancelFunc) {
+	d, has := l.options.actionTimeouts[wire.Action(action)]
+	if !has || d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
@@ -0,0 +1,84 @@
+package mutex
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+)
+
+// WithTLS encrypts the connections to the server, the server name is the host
+// of the address when the config does not set it
+func WithTLS(config *tls.Config) Option {
+	return func(o *options) {
+		o.tls = config
+	}
+}
+
+// TLSFiles are the pem files of the root certificates and the client
+// certificate, the root certificates of the host are used when CA is empty.
+type TLSFiles struct {
+	CA         string `json:"ca,omitempty" yaml:"ca,omitempty"`
+	Cert       string `json:"cert,omitempty" yaml:"cert,omitempty"`
+	Key        string `json:"key,omitempty" yaml:"key,omitempty"`
+	ServerName string `json:"serverName,omitempty" yaml:"serverName,omitempty"`
+	Insecure   bool   `json:"insecure,omitempty" yaml:"insecure,omitempty"`
+}
+
+func (f TLSFiles) Load() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         f.ServerName,
+		InsecureSkipVerify: f.Insecure,
+	}
+
+	if len(f.CA) > 0 {
+		pem, err := ioutil.ReadFile(f.CA)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ca file: %s", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("invalid ca file: no certificate is found")
+		}
+	}
+
+	if len(f.Cert) > 0 || len(f.Key) > 0 {
+		if len(f.Cert) == 0 || len(f.Key) == 0 {
+			return nil, errors.New("cert and key files should be given together")
+		}
+		pair, err := tls.LoadX509KeyPair(f.Cert, f.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cert file: %s", err)
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+
+	return config, nil
+}
+
+func (l *lockingCenter) secure(conn net.Conn, host string, timeout time.Duration) (net.Conn, error) {
+	config := l.options.tls
+	if len(config.ServerName) == 0 {
+		config = config.Clone()
+		config.ServerName = host
+	}
+
+	if timeout > 0 {
+		if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+			return nil, err
+		}
+	}
+
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
@@ -0,0 +1,65 @@
+package mutex
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrStaleToken = errors.New("fencing token is older than the last one seen")
+
+// TokenGate guards a resource against the holders whose lock has passed to
+// another one while they were paused. Every holder brings the fencing token
+// of its lock, issued in increasing order by the caller from a monotonic
+// source, and the operations of a token older than the last one seen are
+// rejected.
+type TokenGate struct {
+	mutex sync.Mutex
+	last  uint64
+	seen  bool
+}
+
+func NewTokenGate() *TokenGate {
+	return &TokenGate{}
+}
+
+// Do runs fn when the token is not older than the last one seen and records
+// the token, otherwise ErrStaleToken is returned. The operations are run one
+// at a time, so an older token can not pass the check before a newer one and
+// complete after it.
+func (g *TokenGate) Do(token uint64, fn func() error) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if err := g.admit(token); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// Check records the token, or returns ErrStaleToken when it is older than the
+// last one seen.
+func (g *TokenGate) Check(token uint64) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return g.admit(token)
+}
+
+// Last returns the newest token seen and false when there is none yet.
+func (g *TokenGate) Last() (uint64, bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return g.last, g.seen
+}
+
+// admit should be called holding the mutex
+func (g *TokenGate) admit(token uint64) error {
+	if g.seen && token < g.last {
+		return ErrStaleToken
+	}
+	g.last = token
+	g.seen = true
+
+	return nil
+}
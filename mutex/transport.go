@@ -0,0 +1,85 @@
+package mutex
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrTransportCredentials = errors.New("credentials of the shared transport can not be given to its clients")
+
+// Transport is the connection pool to a server shared by the clients created
+// from it, so the modules of an application can have their own namespaced
+// clients without opening a pool each. The connection options, like the pool,
+// the dialer and TLS, are given to the transport.
+type Transport struct {
+	address string
+	opts    []Option
+	pool    *connPool
+
+	mutex  sync.Mutex
+	closed bool
+	quotas map[string]*quotaState
+}
+
+func NewTransport(address string, opts ...Option) *Transport {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &Transport{
+		address: address,
+		opts:    opts,
+		pool:    newConnPool(o.pool, o.clock),
+	}
+}
+
+// Client creates a client on the transport, the options given are applied
+// after the ones of the transport. Closing the client does not close the
+// pooled connections of the transport. The pooled connections are
+// authenticated by the credentials of the transport, so the clients can not
+// have their own and WithCredentials given to the client returns
+// ErrTransportCredentials.
+func (t *Transport) Client(sourceAddr *string, opts ...Option) (LockingCenter, error) {
+	t.mutex.Lock()
+	closed := t.closed
+	t.mutex.Unlock()
+
+	if closed {
+		return nil, ErrClosed
+	}
+
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.credentials != nil {
+		return nil, ErrTransportCredentials
+	}
+
+	clientOpts := make([]Option, 0, len(t.opts)+len(opts)+1)
+	clientOpts = append(clientOpts, t.opts...)
+	clientOpts = append(clientOpts, opts...)
+	clientOpts = append(clientOpts, func(o *options) {
+		o.transport = t
+	})
+
+	return NewLockingCenterWithSourceAddr(t.address, sourceAddr, clientOpts...)
+}
+
+// Close closes the idle connections of the transport and returns their count,
+// the connections given back afterwards are closed by the clients.
+func (t *Transport) Close() int {
+	t.mutex.Lock()
+	t.closed = true
+	t.mutex.Unlock()
+
+	return t.pool.close()
+}
+
+func (o options) connPool() *connPool {
+	if o.transport != nil {
+		return o.transport.pool
+	}
+	return newConnPool(o.pool, o.clock)
+}
@@ -0,0 +1,142 @@
+package mutex
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	uriScheme     = "lc"
+	unixURIScheme = "lc+unix"
+)
+
+// endpoint is the address, the source address and the options of a
+// connection string
+type endpoint struct {
+	network    string
+	address    string
+	sourceAddr *string
+	opts       []Option
+}
+
+func isURI(address string) bool {
+	return strings.HasPrefix(address, uriScheme+"://") || strings.HasPrefix(address, unixURIScheme+"://")
+}
+
+// parseURI reads the lc://host:port and the lc+unix:///path connection
+// strings. The query parameters are namespace, source, timeout,
+// dial_timeout, retry_interval, negotiate, lazy, tls, tls_server_name and
+// tls_insecure, the durations are in the time.ParseDuration format.
+func parseURI(uri string) (endpoint, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return endpoint{}, err
+	}
+
+	e := endpoint{network: "tcp", address: u.Host}
+	if u.Scheme == unixURIScheme {
+		e.network = "unix"
+		e.address = u.Path
+	}
+	if len(e.address) == 0 {
+		return endpoint{}, fmt.Errorf("%s uri requires the address", u.Scheme)
+	}
+
+	var config *tls.Config
+	for name, values := range u.Query() {
+		value := values[len(values)-1]
+
+		switch name {
+		case "namespace":
+			e.opts = append(e.opts, WithNamespace(value))
+		case "source":
+			e.sourceAddr = &value
+		case "timeout", "dial_timeout", "retry_interval":
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return endpoint{}, fmt.Errorf("invalid %s: %s", name, err)
+			}
+			e.opts = append(e.opts, durationOption(name, d))
+		case "negotiate", "lazy", "tls", "tls_insecure":
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return endpoint{}, fmt.Errorf("invalid %s: %s", name, err)
+			}
+			if !b {
+				continue
+			}
+
+			switch name {
+			case "negotiate":
+				e.opts = append(e.opts, WithNegotiation())
+			case "lazy":
+				e.opts = append(e.opts, WithLazyConnect())
+			default:
+				if config == nil {
+					config = &tls.Config{}
+				}
+				config.InsecureSkipVerify = config.InsecureSkipVerify || name == "tls_insecure"
+			}
+		case "tls_server_name":
+			if config == nil {
+				config = &tls.Config{}
+			}
+			config.ServerName = value
+		default:
+			return endpoint{}, fmt.Errorf("unknown %s uri parameter %s", u.Scheme, name)
+		}
+	}
+	if config != nil {
+		e.opts = append(e.opts, WithTLS(config))
+	}
+
+	return e, nil
+}
+
+func durationOption(name string, d time.Duration) Option {
+	switch name {
+	case "timeout":
+		return WithOperationTimeout(d)
+	case "dial_timeout":
+		return WithDialTimeout(d)
+	}
+	return WithRetryInterval(d)
+}
+
+// resolveAddr returns the address dialed for the network and the host of its
+// tls server name
+// resolveAddr resolves the tcp address of the server, the address given to the
+// dialer is its own business, so it is kept as it is
+func (o options) resolveAddr(network string, address string) (string, string, error) {
+	if network == "unix" {
+		return address, "", nil
+	}
+	if o.dialer != nil {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		return address, host, nil
+	}
+
+	addr, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil {
+		return "", "", err
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", "", err
+	}
+
+	if o.dualStack != nil {
+		// the name is only checked, it is resolved by the dialer
+		return address, host, nil
+	}
+	return addr.String(), host, nil
+}
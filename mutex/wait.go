@@ -0,0 +1,195 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+type TimeoutError struct {
+	Key    string
+	Waited time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("key %s is still locked after waiting %s", e.Key, e.Waited.Round(time.Millisecond))
+}
+
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+func (l *lockingCenter) WaitTimeout(key string, d time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	return l.WaitContext(ctx, key)
+}
+
+func (l *lockingCenter) WaitContext(ctx context.Context, key string) error {
+	begin := l.options.clock.Now()
+
+	if err := l.LockContext(ctx, key); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return &TimeoutError{Key: key, Waited: since(l.options.clock, begin)}
+		}
+		return err
+	}
+	return l.Unlock(key)
+}
+
+// waitAllBatchSize is the number of the keys checked by a batch of WaitAll
+const waitAllBatchSize = 256
+
+// WaitAll returns once all the keys are free at the same time without joining
+// their queues. The keys are checked by the status queries batched on a single
+// connection, and the first locked one is watched until it is released before
+// they are checked again. The servers without the status queries or the
+// pipelining are waited key by key in the queues.
+func (l *lockingCenter) WaitAll(ctx context.Context, keys ...string) (err error) {
+	defer l.recovered(&err)
+
+	if len(keys) == 0 || l.options.resolve().bypass {
+		return nil
+	}
+
+	op, err := l.begin(maStatus, keys[0])
+	if err != nil {
+		return err
+	}
+	defer l.end(op)
+
+	begin := l.options.clock.Now()
+	for {
+		key, err := l.firstOf(ctx, keys, true)
+		if errors.Is(err, ErrNotSupported) {
+			return l.waitEach(ctx, keys)
+		}
+		if err != nil || len(key) == 0 {
+			return err
+		}
+
+		if err := (pushWait{}).Await(ctx, keyState{lc: l, key: key}); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return &TimeoutError{Key: key, Waited: since(l.options.clock, begin)}
+			}
+			return err
+		}
+	}
+}
+
+// firstOf returns the first of the keys in the lock state by the batched
+// status queries, empty when there is none
+func (l *lockingCenter) firstOf(ctx context.Context, keys []string, locked bool) (string, error) {
+	if !l.supports(wire.CapStatus) {
+		return "", ErrNotSupported
+	}
+
+	for begin := 0; begin < len(keys); begin += waitAllBatchSize {
+		end := begin + waitAllBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		operations := make([]BatchOperation, 0, end-begin)
+		for _, key := range keys[begin:end] {
+			operations = append(operations, BatchOperation{action: maStatus, key: key})
+		}
+
+		replies, err := l.pipelined(ctx, operations)
+		if err != nil {
+			return "", err
+		}
+
+		for i, reply := range replies {
+			if !reply.Accepted {
+				return "", rejection(maStatus, reply)
+			}
+			if (len(reply.Payload) > 0 && reply.Payload[0] == 1) == locked {
+				return keys[begin+i], nil
+			}
+		}
+	}
+	return "", nil
+}
+
+func (l *lockingCenter) waitEach(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		if err := l.WaitContext(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WaitAny returns the first of the keys free without joining their queues, for
+// the consumers proceeding on whichever resource is released first. The keys
+// are checked by the batched status queries, and all of them are watched when
+// they are locked until one is released.
+func (l *lockingCenter) WaitAny(ctx context.Context, keys ...string) (_ string, err error) {
+	defer l.recovered(&err)
+
+	if len(keys) == 0 {
+		return "", &KeyError{}
+	}
+	if l.options.resolve().bypass {
+		return keys[0], nil
+	}
+
+	op, err := l.begin(maStatus, keys[0])
+	if err != nil {
+		return "", err
+	}
+	defer l.end(op)
+
+	key, err := l.firstOf(ctx, keys, false)
+	if err != nil && !errors.Is(err, ErrNotSupported) {
+		return "", err
+	}
+	if len(key) > 0 {
+		return key, nil
+	}
+
+	begin := l.options.clock.Now()
+
+	var watches sync.WaitGroup
+	defer watches.Wait()
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	free := make(chan string, len(keys))
+	for _, key := range keys {
+		watches.Add(1)
+		go func(key string) {
+			defer watches.Done()
+			defer l.rescue("wait any")
+
+			// the watches are closed by the shutdown as well
+			if (pushWait{}).Await(watchCtx, keyState{lc: l, key: key}) == nil && !l.isAborted() {
+				free <- key
+			}
+		}(key)
+	}
+
+	select {
+	case key := <-free:
+		return key, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", &TimeoutError{Key: strings.Join(keys, ", "), Waited: since(l.options.clock, begin)}
+		}
+		return "", ctx.Err()
+	case <-l.abort:
+		return "", ErrClosed
+	}
+}
@@ -0,0 +1,140 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// WaitStrategy decides how a lock waits for its key held by another before it
+// is queued on the server, trading the latency of the acquisition for the load
+// of the server. Await returns once the key looks free or the context is done,
+// the lock is queued then.
+type WaitStrategy interface {
+	Await(ctx context.Context, key KeyState) error
+}
+
+// KeyState is the key of the waiting lock.
+type KeyState interface {
+	Key() string
+	// Locked queries if the key is locked
+	Locked(ctx context.Context) (bool, error)
+	// Changes notifies the transitions of the key, pushed by the server when it
+	// supports it, until the returned function is called
+	Changes() (<-chan LockEvent, func())
+	// Clock is the clock of the client for the delays of the strategy
+	Clock() Clock
+}
+
+// WithWaitStrategy makes the locks wait for their keys by the strategy. The
+// locks are queued on the server at once by default, or when the server can
+// not answer the strategy.
+func WithWaitStrategy(strategy WaitStrategy) Option {
+	return func(o *options) {
+		o.waitStrategy = strategy
+	}
+}
+
+// FixedPoll queries the key at every interval until it is free
+func FixedPoll(interval time.Duration) WaitStrategy {
+	return AdaptivePoll(interval, interval)
+}
+
+// AdaptivePoll queries the key starting with the min interval and doubles it
+// on every locked answer up to the max interval
+func AdaptivePoll(min, max time.Duration) WaitStrategy {
+	if max < min {
+		max = min
+	}
+	return &pollWait{min: min, max: max}
+}
+
+// ServerPush waits for the key to be released by its transitions, pushed by the
+// servers supporting the watch frame and polled by the client otherwise
+func ServerPush() WaitStrategy {
+	return pushWait{}
+}
+
+type pollWait struct {
+	min time.Duration
+	max time.Duration
+}
+
+func (p *pollWait) Await(ctx context.Context, key KeyState) error {
+	delay := p.min
+	for {
+		locked, err := key.Locked(ctx)
+		if err != nil || !locked {
+			return err
+		}
+
+		timer := key.Clock().NewTimer(delay)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+
+		if delay *= 2; delay > p.max {
+			delay = p.max
+		}
+	}
+}
+
+type pushWait struct{}
+
+func (pushWait) Await(ctx context.Context, key KeyState) error {
+	events, stop := key.Changes()
+	defer stop()
+
+	for {
+		select {
+		case event, open := <-events:
+			if !open || !event.Locked {
+				return nil
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+type keyState struct {
+	lc  *lockingCenter
+	key string
+}
+
+func (k keyState) Key() string {
+	return k.key
+}
+
+func (k keyState) Locked(ctx context.Context) (bool, error) {
+	payload, err := k.lc.inquire(ctx, maStatus, k.key, nil)
+	if err != nil {
+		return false, err
+	}
+	return len(payload) > 0 && payload[0] == 1, nil
+}
+
+func (k keyState) Changes() (<-chan LockEvent, func()) {
+	return k.lc.Watch(k.key)
+}
+
+func (k keyState) Clock() Clock {
+	return k.lc.options.clock
+}
+
+// await waits for the key of the lock by the wait strategy
+func (l *lockingCenter) await(ctx context.Context, key string) error {
+	strategy := l.options.waitStrategy
+	if strategy == nil || l.options.resolve().bypass {
+		return nil
+	}
+
+	err := strategy.Await(ctx, keyState{lc: l, key: key})
+	if errors.Is(err, ErrNotSupported) {
+		return nil
+	}
+	return err
+}
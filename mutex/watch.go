@@ -0,0 +1,147 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+const (
+	watchPollInterval = time.Second
+	watchProbeTimeout = time.Millisecond * 250
+)
+
+type LockEvent struct {
+	Key    string
+	Locked bool
+	At     time.Time
+}
+
+// Watch notifies the lock transitions of the key until the returned function
+// is called. The server pushes the transitions when it supports the watch
+// frame, otherwise the client polls the key state.
+func (l *lockingCenter) Watch(key string) (<-chan LockEvent, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan LockEvent, 16)
+
+	go func() {
+		defer close(events)
+		defer l.rescue("watch")
+
+		if !l.subscribe(ctx, key, events) {
+			l.poll(ctx, key, events)
+		}
+	}()
+
+	return events, cancel
+}
+
+func (l *lockingCenter) subscribe(ctx context.Context, key string, events chan LockEvent) bool {
+	if l.options.resolve().bypass || !l.supports(wire.CapWatch) {
+		return false
+	}
+
+	for {
+		err := l.stream(ctx, key, events)
+		if errors.Is(err, ErrServerRejected) && !errors.Is(err, ErrPermissionDenied) {
+			return false
+		}
+
+		select {
+		case <-ctx.Done():
+			return true
+		case <-l.abort:
+			return true
+		case <-after(l.options.clock, l.options.resolve().retryInterval):
+		}
+	}
+}
+
+func (l *lockingCenter) stream(ctx context.Context, key string, events chan LockEvent) error {
+	if err := l.throttle(ctx); err != nil {
+		return err
+	}
+
+	conn, err := l.dial(ctx, maWatch)
+	if err != nil {
+		return err
+	}
+	defer l.hangUp(conn)
+
+	stop := l.watch(ctx, conn)
+	defer stop()
+
+	if err := l.query(conn, maWatch, key, nil, 0); err != nil {
+		return err
+	}
+
+	state := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(conn, state); err != nil {
+			return err
+		}
+
+		if !l.notify(ctx, events, LockEvent{Key: key, Locked: state[0] == 1, At: l.options.clock.Now()}) {
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *lockingCenter) poll(ctx context.Context, key string, events chan LockEvent) {
+	known := false
+	last := false
+
+	for {
+		locked, err := probe(ctx, l, key, watchProbeTimeout)
+		if err == nil && (!known || locked != last) {
+			known = true
+			last = locked
+
+			if !l.notify(ctx, events, LockEvent{Key: key, Locked: locked, At: l.options.clock.Now()}) {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-l.abort:
+			return
+		case <-after(l.options.clock, watchPollInterval):
+		}
+	}
+}
+
+// probe asks the state of the key to the server. When the server does not
+// support it, it tries to lock the key for a short time and a key that could
+// not be acquired in that time is considered locked.
+func probe(ctx context.Context, lc LockingCenter, key string, timeout time.Duration) (bool, error) {
+	locked, err := lc.IsLocked(key)
+	if !errors.Is(err, ErrNotSupported) {
+		return locked, err
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err = lc.LockContext(probeCtx, key)
+	if err == nil {
+		return false, lc.Unlock(key)
+	}
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return true, nil
+	}
+	return false, err
+}
+
+func (l *lockingCenter) notify(ctx context.Context, events chan LockEvent, event LockEvent) bool {
+	select {
+	case events <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,104 @@
+package mutex
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/freakmaxi/locking-center-client-go/wire"
+)
+
+// WithWireDump writes every frame sent and every answer received to the
+// logger as a hex dump, the sent frames annotated by their decoded actions, to
+// diagnose the protocol mismatches with the server. The dumps carry the keys
+// and the source addresses, so it is not meant for production.
+func WithWireDump() Option {
+	return func(o *options) {
+		o.wireDump = true
+	}
+}
+
+type dumpConn struct {
+	net.Conn
+	logger Logger
+}
+
+func (c *dumpConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.dump("->", annotate(b[:n]), b[:n], err)
+	return n, err
+}
+
+func (c *dumpConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 || err != nil {
+		c.dump("<-", fmt.Sprintf("%d bytes", n), b[:n], err)
+	}
+	return n, err
+}
+
+func (c *dumpConn) dump(direction string, annotation string, b []byte, err error) {
+	if err != nil {
+		annotation = fmt.Sprintf("%s, %s", annotation, err)
+	}
+	c.logger.Printf("DEBUG: %s %s (%s)\n%s", direction, c.RemoteAddr(), annotation, hex.Dump(b))
+}
+
+// annotate decodes the request frames written at once
+func annotate(b []byte) string {
+	var frames []string
+
+	r := bufio.NewReader(bytes.NewReader(b))
+	for {
+		if _, err := r.Peek(1); err != nil {
+			break
+		}
+
+		req, err := wire.DecodeRequest(r)
+		if err != nil {
+			frames = append(frames, fmt.Sprintf("undecoded: %s", err))
+			break
+		}
+		frames = append(frames, describe(req))
+	}
+	return strings.Join(frames, "; ")
+}
+
+func describe(req wire.Request) string {
+	var b strings.Builder
+	b.WriteString(req.Action.String())
+	if req.Version >= 2 {
+		b.WriteString(" v2")
+	}
+	if req.ID != 0 {
+		fmt.Fprintf(&b, " id=%016x", req.ID)
+	}
+	if req.Priority != 0 {
+		fmt.Fprintf(&b, " priority=%d", req.Priority)
+	}
+	if req.Barge {
+		b.WriteString(" barge")
+	}
+	if req.MaxWait > 0 {
+		fmt.Fprintf(&b, " max-wait=%s", req.MaxWait)
+	}
+	if len(req.Labels) > 0 {
+		fmt.Fprintf(&b, " labels=%v", req.Labels)
+	}
+	if req.ListLabels {
+		b.WriteString(" labels")
+	}
+	if len(req.Key) > 0 {
+		fmt.Fprintf(&b, " key=%q", req.Key)
+	}
+	if req.SourceAddr != nil {
+		fmt.Fprintf(&b, " source=%q", *req.SourceAddr)
+	}
+	if len(req.Payload) > 0 {
+		fmt.Fprintf(&b, " payload=%d bytes", len(req.Payload))
+	}
+	return b.String()
+}
@@ -0,0 +1,44 @@
+package mutex
+
+import (
+	"context"
+)
+
+func (l *lockingCenter) WithLock(ctx context.Context, key string, fn func() error) (err error) {
+	if err := l.LockContext(ctx, key); err != nil {
+		return err
+	}
+
+	defer func() {
+		// the release should happen even the context is cancelled or fn panics
+		unlockErr := l.Unlock(key)
+
+		if r := recover(); r != nil {
+			panic(r)
+		}
+
+		if err == nil {
+			err = unlockErr
+		}
+	}()
+
+	return fn()
+}
+
+// LockIf is the double-checked locking: fn runs under the key only when check
+// reports that it is needed both before the acquisition and after it. The key
+// is not acquired when the first check reports false.
+func LockIf(ctx context.Context, lc Locker, key string, check func() (bool, error), fn func() error) error {
+	needed, err := check()
+	if err != nil || !needed {
+		return err
+	}
+
+	return lc.WithLock(ctx, key, func() error {
+		needed, err := check()
+		if err != nil || !needed {
+			return err
+		}
+		return fn()
+	})
+}
@@ -0,0 +1,349 @@
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+const (
+	MaxKeySizeV2        = 8 * 1024
+	MaxSourceAddrSizeV2 = 1024
+	// MaxFrameSizeV2 bounds the fields of a v2 frame
+	MaxFrameSizeV2 = MaxPayloadSize + 64*1024
+)
+
+var ErrFrameSize = errors.New("frame can not be more than the payload and 64KB of fields")
+
+// frameV2 starts the v2 request frames of the servers agreeing on
+// ProtocolVersion 2, it is not a valid action code of the v1 frames so the
+// servers tell them apart by their first byte. The zero byte is followed by
+// the uvarint size of the rest of the frame, the uvarint action and the
+// optional fields of the request, each of them the uvarint tag, the uvarint
+// size and the value. A missing source address is sent without its field, a
+// label as the name prefixed by its uvarint size and the value. The fields of
+// the unknown tags are skipped, so the frame is extended without a new
+// version.
+//
+// The v2 responses are "+", "!" or "-" followed by the uvarint size of their
+// fields: the payload of the accepted ones and the code and the reason of the
+// rejections.
+const frameV2 = 0x00
+
+// the tags of the fields of the v2 frames
+const (
+	fieldID         = 1
+	fieldPriority   = 2
+	fieldKey        = 3
+	fieldSourceAddr = 4
+	fieldLabel      = 5
+	fieldListLabels = 6
+	fieldPayload    = 7
+	fieldCode       = 8
+	fieldReason     = 9
+	fieldBarge      = 10
+	fieldMaxWait    = 11
+)
+
+func encodeV2(buffer *bytes.Buffer, req Request) error {
+	if req.Action.HasKey() && (len(req.Key) == 0 || len(req.Key) > MaxKeySizeV2) {
+		return ErrKeySize
+	}
+	if req.SourceAddr != nil && len(*req.SourceAddr) > MaxSourceAddrSizeV2 {
+		return ErrSourceAddrSize
+	}
+	if len(req.Payload) > MaxPayloadSize {
+		return ErrPayloadSize
+	}
+	if err := ValidateLabels(req.Labels); err != nil {
+		return err
+	}
+
+	// the fields are written after the room of the frame byte and their size,
+	// and moved next to them once the size is known
+	start := buffer.Len()
+	var header [1 + binary.MaxVarintLen64]byte
+	buffer.Write(header[:])
+
+	putUvarint(buffer, uint64(req.Action))
+
+	if req.ID != 0 {
+		putUvarintField(buffer, fieldID, req.ID)
+	}
+	if req.Priority != 0 && req.Action == Lock {
+		putField(buffer, fieldPriority, []byte{req.Priority})
+	}
+	if req.Barge && req.Action == Lock {
+		putField(buffer, fieldBarge, nil)
+	}
+	if req.MaxWait > 0 && req.Action == Lock {
+		// the milliseconds are rounded up, so the server does not expire the
+		// lock before its caller gives up
+		putUvarintField(buffer, fieldMaxWait, uint64((req.MaxWait+time.Millisecond-1)/time.Millisecond))
+	}
+	if req.Action == Lock {
+		for _, name := range sortedNames(req.Labels) {
+			value := req.Labels[name]
+			putUvarint(buffer, fieldLabel)
+			putUvarint(buffer, uint64(uvarintSize(uint64(len(name)))+len(name)+len(value)))
+			putUvarint(buffer, uint64(len(name)))
+			buffer.WriteString(name)
+			buffer.WriteString(value)
+		}
+	}
+	if req.ListLabels && req.Action == List {
+		putField(buffer, fieldListLabels, nil)
+	}
+	if req.Action.HasKey() {
+		putStringField(buffer, fieldKey, req.Key)
+	}
+	if req.Action.HasSource() && req.SourceAddr != nil {
+		putStringField(buffer, fieldSourceAddr, *req.SourceAddr)
+	}
+	if req.Action.HasRequestPayload() {
+		putField(buffer, fieldPayload, req.Payload)
+	}
+
+	b := buffer.Bytes()
+	size := len(b) - start - len(header)
+
+	header[0] = frameV2
+	n := 1 + binary.PutUvarint(header[1:], uint64(size))
+	copy(b[start:], header[:n])
+	copy(b[start+n:], b[start+len(header):])
+	buffer.Truncate(start + n + size)
+
+	return nil
+}
+
+// decodeRequestV2 reads the v2 request frame after its first byte
+func decodeRequestV2(r *bufio.Reader) (Request, error) {
+	fields, err := readFields(r)
+	if err != nil {
+		return Request{}, err
+	}
+
+	action, n := binary.Uvarint(fields)
+	if n <= 0 || !Action(action).Valid() {
+		return Request{}, ErrMalformed
+	}
+
+	req := Request{Action: Action(action), Version: 2}
+	err = eachField(fields[n:], func(tag uint64, value []byte) error {
+		switch tag {
+		case fieldID:
+			if req.ID, n = binary.Uvarint(value); n <= 0 {
+				return ErrMalformed
+			}
+		case fieldPriority:
+			if len(value) != 1 {
+				return ErrMalformed
+			}
+			req.Priority = value[0]
+		case fieldKey:
+			req.Key = string(value)
+		case fieldSourceAddr:
+			sourceAddr := string(value)
+			req.SourceAddr = &sourceAddr
+		case fieldLabel:
+			size, n := binary.Uvarint(value)
+			if n <= 0 || size > uint64(len(value)-n) {
+				return ErrMalformed
+			}
+			if req.Labels == nil {
+				req.Labels = make(map[string]string)
+			}
+			req.Labels[string(value[n:n+int(size)])] = string(value[n+int(size):])
+		case fieldListLabels:
+			req.ListLabels = true
+		case fieldBarge:
+			req.Barge = true
+		case fieldMaxWait:
+			wait, n := binary.Uvarint(value)
+			if n <= 0 {
+				return ErrMalformed
+			}
+			req.MaxWait = time.Duration(wait) * time.Millisecond
+		case fieldPayload:
+			req.Payload = value
+		}
+		return nil
+	})
+	if err != nil {
+		return Request{}, err
+	}
+
+	// the v1 frames always carry the source address of the actions having it
+	if req.Action.HasSource() && req.SourceAddr == nil {
+		empty := ""
+		req.SourceAddr = &empty
+	}
+	return req, nil
+}
+
+// DecodeV2 reads the v2 response of the action.
+func DecodeV2(r io.Reader, action Action) (Response, error) {
+	result := make([]byte, 1)
+	if _, err := io.ReadFull(r, result); err != nil {
+		return Response{}, err
+	}
+
+	fields, err := readFields(r)
+	if err != nil {
+		return Response{}, err
+	}
+
+	resp := Response{Accepted: result[0] == '+', Denied: result[0] == '!'}
+	err = eachField(fields, func(tag uint64, value []byte) error {
+		switch {
+		case resp.Accepted && tag == fieldPayload:
+			resp.Payload = value
+		case !resp.Accepted && tag == fieldCode && len(value) == 1:
+			resp.Code = Code(value[0])
+		case !resp.Accepted && tag == fieldReason:
+			resp.Reason = string(value)
+		}
+		return nil
+	})
+	if err != nil {
+		return Response{}, err
+	}
+
+	if resp.Accepted && action.HasPayload() && resp.Payload == nil {
+		resp.Payload = []byte{}
+	}
+	return resp, nil
+}
+
+// EncodeResponseV2 prepares the v2 response of the action on the server side.
+func EncodeResponseV2(action Action, resp Response) []byte {
+	fields := bytes.NewBuffer(nil)
+
+	result := byte('+')
+	switch {
+	case resp.Denied:
+		result = '!'
+	case !resp.Accepted:
+		result = '-'
+	}
+
+	if result == '+' {
+		if action.HasPayload() {
+			putField(fields, fieldPayload, resp.Payload)
+		}
+	} else {
+		if resp.Code != CodeUnspecified {
+			putField(fields, fieldCode, []byte{byte(resp.Code)})
+		}
+		if len(resp.Reason) > 0 {
+			putField(fields, fieldReason, []byte(resp.Reason))
+		}
+	}
+
+	b := bytes.NewBuffer(make([]byte, 0, 1+binary.MaxVarintLen64+fields.Len()))
+	b.WriteByte(result)
+	putUvarint(b, uint64(fields.Len()))
+	b.Write(fields.Bytes())
+
+	return b.Bytes()
+}
+
+// EncodeString writes the string of a payload prefixed by its uint8 size, or by
+// its uvarint size for the v2 frames.
+func EncodeString(buffer *bytes.Buffer, s string, version uint8) {
+	if version >= 2 {
+		putUvarint(buffer, uint64(len(s)))
+	} else {
+		buffer.WriteByte(byte(len(s)))
+	}
+	buffer.WriteString(s)
+}
+
+func putUvarint(buffer *bytes.Buffer, v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	buffer.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func uvarintSize(v uint64) int {
+	var b [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(b[:], v)
+}
+
+func putField(buffer *bytes.Buffer, tag uint64, value []byte) {
+	putUvarint(buffer, tag)
+	putUvarint(buffer, uint64(len(value)))
+	buffer.Write(value)
+}
+
+func putStringField(buffer *bytes.Buffer, tag uint64, value string) {
+	putUvarint(buffer, tag)
+	putUvarint(buffer, uint64(len(value)))
+	buffer.WriteString(value)
+}
+
+func putUvarintField(buffer *bytes.Buffer, tag uint64, v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	putField(buffer, tag, b[:binary.PutUvarint(b[:], v)])
+}
+
+// readFields reads the fields of a frame prefixed by their uvarint size
+func readFields(r io.Reader) ([]byte, error) {
+	size, err := readUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if size > MaxFrameSizeV2 {
+		return nil, ErrFrameSize
+	}
+
+	fields := make([]byte, size)
+	if _, err := io.ReadFull(r, fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func eachField(fields []byte, fn func(tag uint64, value []byte) error) error {
+	for len(fields) > 0 {
+		tag, n := binary.Uvarint(fields)
+		if n <= 0 {
+			return ErrMalformed
+		}
+		fields = fields[n:]
+
+		size, n := binary.Uvarint(fields)
+		if n <= 0 || size > uint64(len(fields)-n) {
+			return ErrMalformed
+		}
+		fields = fields[n:]
+
+		if err := fn(tag, fields[:size]); err != nil {
+			return err
+		}
+		fields = fields[size:]
+	}
+	return nil
+}
+
+// readUvarint reads the uvarint byte by byte, so nothing is read beyond it
+func readUvarint(r io.Reader) (uint64, error) {
+	if br, ok := r.(io.ByteReader); ok {
+		return binary.ReadUvarint(br)
+	}
+
+	b := make([]byte, 1)
+	var v uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return 0, err
+		}
+		v |= uint64(b[0]&0x7f) << shift
+		if b[0] < 0x80 {
+			return v, nil
+		}
+	}
+	return 0, ErrMalformed
+}
@@ -0,0 +1,122 @@
+package wire
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// ProtocolVersion is the version of the protocol implemented by the package.
+// The servers without the hello frame speak the version zero, the ones agreeing
+// on the version 2 read the v2 frames with the varint sizes along with the v1
+// frames.
+const ProtocolVersion = 2
+
+// Capability is a feature of the protocol beyond the lock, unlock and reset
+// frames of the version zero.
+type Capability uint32
+
+const (
+	CapObserve Capability = 1 << iota
+	CapWatch
+	CapQueuePosition
+	CapStatus
+	CapList
+	CapResetAll
+	CapAbandon
+	// CapPipelining is the support of the frames sent before the answers of
+	// the previous ones on the same connection, as the batches do.
+	CapPipelining
+	CapRequestID
+	// CapSessions is the support of the session frame, the server releases the
+	// locks of its source address once the connection of the frame dies.
+	CapSessions
+	// CapPriority is the support of the lock priorities, the waiters of the
+	// higher priorities are queued ahead of the others.
+	CapPriority
+	// CapStats is the support of the stats query reporting the holders and the
+	// waiters of the keys.
+	CapStats
+	// CapIdempotency is the deduplication of the lock requests by their id,
+	// the repeated lock of a granted request is answered at once and the one
+	// of a queued request takes its place in the queue.
+	CapIdempotency
+	// CapLabels is the support of the labels of the lock requests, kept with
+	// the holders and answered in the lists asking for them.
+	CapLabels
+	// CapMultiplex is the support of the connections switched by the
+	// multiplex frame, whose requests carry their ids and are answered in the
+	// order they complete, each answer prefixed by the little endian uint64 id
+	// of its request.
+	CapMultiplex
+	// CapErrorDetails is the support of the detailed rejections, the
+	// connections whose hello frame has agreed on it get the code and the
+	// reason of the rejections after their "-" or "!".
+	CapErrorDetails
+	// CapBarging is the support of the barging locks of the v2 frames, which
+	// take the released key ahead of the waiters queued before them.
+	CapBarging
+	// CapMaxWait is the support of the max wait of the v2 lock frames, the
+	// server rejects the lock by CodeExpired once it has waited that long in
+	// the queue.
+	CapMaxWait
+)
+
+var capabilityNames = []string{
+	"observe", "watch", "queue-position", "status", "list", "reset-all", "abandon", "pipelining", "request-id",
+	"sessions", "priority", "stats", "idempotency", "labels", "multiplex",
+	"error-details", "barging", "max-wait",
+}
+
+// String lists the names of the capabilities, the unknown ones by their bits.
+func (c Capability) String() string {
+	if c == 0 {
+		return "none"
+	}
+
+	var names []string
+	for i, name := range capabilityNames {
+		if bit := Capability(1) << uint(i); c&bit != 0 {
+			names = append(names, name)
+			c &^= bit
+		}
+	}
+	if c != 0 {
+		names = append(names, fmt.Sprintf("0x%x", uint32(c)))
+	}
+	return strings.Join(names, ",")
+}
+
+// Capabilities are the ones of ProtocolVersion.
+const Capabilities = CapObserve | CapWatch | CapQueuePosition | CapStatus | CapList | CapResetAll | CapAbandon | CapPipelining | CapRequestID | CapSessions | CapPriority | CapStats | CapIdempotency | CapLabels | CapMultiplex | CapErrorDetails | CapBarging | CapMaxWait
+
+// HelloPayload is the payload of the hello request announcing the protocol of
+// the client and of its answer announcing the protocol agreed by the server:
+// the little endian uint16 version and uint32 capabilities.
+type HelloPayload struct {
+	Version      uint16
+	Capabilities Capability
+}
+
+func (h HelloPayload) Has(c Capability) bool {
+	return h.Capabilities&c == c
+}
+
+func EncodeHello(h HelloPayload) []byte {
+	b := make([]byte, 6)
+	binary.LittleEndian.PutUint16(b, h.Version)
+	binary.LittleEndian.PutUint32(b[2:], uint32(h.Capabilities))
+
+	return b
+}
+
+func DecodeHello(b []byte) (HelloPayload, error) {
+	if len(b) < 6 {
+		return HelloPayload{}, ErrMalformed
+	}
+
+	return HelloPayload{
+		Version:      binary.LittleEndian.Uint16(b),
+		Capabilities: Capability(binary.LittleEndian.Uint32(b[2:])),
+	}, nil
+}
@@ -0,0 +1,75 @@
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"sort"
+)
+
+// ReasonLabel is the label of the lock carrying the human-readable reason of
+// the acquisition.
+const ReasonLabel = "reason"
+
+// ValidateLabels checks the count and the sizes of the labels of a lock
+func ValidateLabels(labels map[string]string) error {
+	if len(labels) > MaxLabels {
+		return ErrLabelSize
+	}
+	for name, value := range labels {
+		if len(name) == 0 || len(name) > MaxLabelSize || len(value) > MaxLabelSize {
+			return ErrLabelSize
+		}
+	}
+	return nil
+}
+
+// EncodeLabels writes the uint8 count of the labels, each of them the name and
+// the value prefixed by their uint8 size in the order of the names. The labels
+// are expected to be valid.
+func EncodeLabels(buffer *bytes.Buffer, labels map[string]string) {
+	names := sortedNames(labels)
+
+	buffer.WriteByte(byte(len(names)))
+	for _, name := range names {
+		buffer.WriteByte(byte(len(name)))
+		buffer.WriteString(name)
+		buffer.WriteByte(byte(len(labels[name])))
+		buffer.WriteString(labels[name])
+	}
+}
+
+// DecodeLabels reads the labels written by EncodeLabels, nil when there are
+// none
+func DecodeLabels(r *bufio.Reader) (map[string]string, error) {
+	count, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, nil
+	}
+
+	labels := make(map[string]string, count)
+	for i := byte(0); i < count; i++ {
+		name, err := decodeString(r)
+		if err != nil {
+			return nil, err
+		}
+		value, err := decodeString(r)
+		if err != nil {
+			return nil, err
+		}
+		labels[name] = value
+	}
+	return labels, nil
+}
+
+func sortedNames(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
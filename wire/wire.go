@@ -0,0 +1,486 @@
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	MaxKeySize        = 128
+	MaxSourceAddrSize = 128
+	MaxPayloadSize    = 16 * 1024 * 1024
+	MaxLabels         = 16
+	MaxLabelSize      = 128
+)
+
+var (
+	ErrMalformed      = errors.New("malformed server response")
+	ErrKeySize        = errors.New("key can not be empty or more than 128 characters")
+	ErrSourceAddrSize = errors.New("source address can not be more than 128 characters")
+	ErrPayloadSize    = errors.New("payload can not be more than 16MB")
+	ErrLabelSize      = errors.New("labels can not be more than 16, or their names empty or more than 128 characters")
+)
+
+type Action byte
+
+const (
+	Lock          Action = 1
+	Unlock        Action = 2
+	ResetByKey    Action = 3
+	ResetBySource Action = 4
+	Abandon       Action = 5
+	Observe       Action = 6
+	Watch         Action = 7
+	QueuePosition Action = 8
+	Status        Action = 9
+	List          Action = 10
+	ResetAll      Action = 11
+	Hello         Action = 12
+	Session       Action = 13
+	Stats         Action = 14
+	Auth          Action = 15
+	Multiplex     Action = 16
+)
+
+func (a Action) String() string {
+	switch a {
+	case Lock:
+		return "lock"
+	case Unlock:
+		return "unlock"
+	case ResetByKey:
+		return "reset-by-key"
+	case ResetBySource:
+		return "reset-by-source"
+	case Abandon:
+		return "abandon"
+	case Observe:
+		return "observe"
+	case Watch:
+		return "watch"
+	case QueuePosition:
+		return "queue-position"
+	case Status:
+		return "status"
+	case List:
+		return "list"
+	case ResetAll:
+		return "reset-all"
+	case Hello:
+		return "hello"
+	case Session:
+		return "session"
+	case Stats:
+		return "stats"
+	case Auth:
+		return "auth"
+	case Multiplex:
+		return "multiplex"
+	}
+	return fmt.Sprintf("action(%d)", byte(a))
+}
+
+func (a Action) Valid() bool {
+	return a >= Lock && a <= Multiplex
+}
+
+func (a Action) HasKey() bool {
+	switch a {
+	case ResetBySource, List, ResetAll, Hello, Session, Stats, Auth, Multiplex:
+		return false
+	}
+	return true
+}
+
+func (a Action) HasSource() bool {
+	switch a {
+	case Lock, ResetBySource, Abandon, QueuePosition, Session:
+		return true
+	}
+	return false
+}
+
+// HasPayload reports if the accepted response carries the little endian uint32
+// size of the payload and the payload itself.
+func (a Action) HasPayload() bool {
+	switch a {
+	case QueuePosition, Status, List, Hello, Stats:
+		return true
+	}
+	return false
+}
+
+// HasRequestPayload reports if the request carries the little endian uint32
+// size of the payload and the payload itself after its other fields.
+func (a Action) HasRequestPayload() bool {
+	return a == Hello || a == Auth
+}
+
+const (
+	// requestIDFlag marks the action codes followed by the little endian
+	// uint64 request id
+	requestIDFlag = 0x80
+	// priorityFlag marks the lock codes followed by the uint8 priority, after
+	// the request id when there is one
+	priorityFlag = 0x40
+	// labelsFlag marks the lock codes followed by the labels, after the
+	// priority when there is one, and the list codes asking for the labels of
+	// the holders in the answer
+	labelsFlag = 0x20
+)
+
+// Request is a frame of the action code, the key and the source address, both
+// prefixed by their uint8 size. The key and the source address are only sent
+// when the action has them, a nil source address is sent as the zero size.
+// The non zero id is sent after the action code for the servers agreeing on
+// CapRequestID, and the non zero priority of the lock after it for the ones
+// agreeing on CapPriority. The labels of the lock follow for the ones agreeing
+// on CapLabels as the uint8 count of the labels, each of them the name and the
+// value prefixed by their uint8 size in the order of the names. A list request
+// of ListLabels asks for the labels of the holders. The requests of Version 2
+// are encoded in the v2 frames instead, only they carry Barge and MaxWait of
+// the locks for the servers agreeing on CapBarging and CapMaxWait.
+type Request struct {
+	Action     Action
+	Version    uint8
+	ID         uint64
+	Priority   uint8
+	Barge      bool
+	MaxWait    time.Duration
+	Labels     map[string]string
+	ListLabels bool
+	Key        string
+	SourceAddr *string
+	Payload    []byte
+}
+
+// Response is "+" for the accepted requests followed by the payload when the
+// action has one, "!" for the ones denied by the authorization of the server
+// and anything else for the other rejections. The rejections on the
+// connections agreeing on CapErrorDetails are followed by the uint8 code and
+// the reason prefixed by its uint8 size.
+type Response struct {
+	Accepted bool
+	Denied   bool
+	Code     Code
+	Reason   string
+	Payload  []byte
+}
+
+// Code is the status code of a detailed rejection.
+type Code uint8
+
+const (
+	CodeUnspecified Code = iota
+	CodeInvalid
+	CodeNotHeld
+	CodeOverloaded
+	CodeDenied
+	// CodeExpired is the lock whose max wait has passed in the queue
+	CodeExpired
+)
+
+func (c Code) String() string {
+	switch c {
+	case CodeUnspecified:
+		return "unspecified"
+	case CodeInvalid:
+		return "invalid"
+	case CodeNotHeld:
+		return "not-held"
+	case CodeOverloaded:
+		return "overloaded"
+	case CodeDenied:
+		return "denied"
+	case CodeExpired:
+		return "expired"
+	}
+	return fmt.Sprintf("code(%d)", byte(c))
+}
+
+func Encode(req Request) ([]byte, error) {
+	// the room of the sizes, the fixed fields and the v2 frame header
+	size := 64 + len(req.Key) + len(req.Payload)
+	if req.SourceAddr != nil {
+		size += len(*req.SourceAddr)
+	}
+	for name, value := range req.Labels {
+		size += 4 + len(name) + len(value)
+	}
+
+	buffer := bytes.NewBuffer(make([]byte, 0, size))
+	if err := EncodeTo(buffer, req); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func EncodeTo(buffer *bytes.Buffer, req Request) error {
+	if req.Version >= 2 {
+		return encodeV2(buffer, req)
+	}
+
+	if req.Action.HasKey() && (len(req.Key) == 0 || len(req.Key) > MaxKeySize) {
+		return ErrKeySize
+	}
+	if req.SourceAddr != nil && len(*req.SourceAddr) > MaxSourceAddrSize {
+		return ErrSourceAddrSize
+	}
+	if len(req.Payload) > MaxPayloadSize {
+		return ErrPayloadSize
+	}
+	if err := ValidateLabels(req.Labels); err != nil {
+		return err
+	}
+
+	code := byte(req.Action)
+	if req.ID != 0 {
+		code |= requestIDFlag
+	}
+	if req.Priority != 0 && req.Action == Lock {
+		code |= priorityFlag
+	}
+	if (len(req.Labels) > 0 && req.Action == Lock) || (req.ListLabels && req.Action == List) {
+		code |= labelsFlag
+	}
+	buffer.WriteByte(code)
+
+	if req.ID != 0 {
+		var id [8]byte
+		binary.LittleEndian.PutUint64(id[:], req.ID)
+		buffer.Write(id[:])
+	}
+	if code&priorityFlag != 0 {
+		buffer.WriteByte(req.Priority)
+	}
+	if code&labelsFlag != 0 && req.Action == Lock {
+		EncodeLabels(buffer, req.Labels)
+	}
+
+	if req.Action.HasKey() {
+		buffer.WriteByte(byte(len(req.Key)))
+		buffer.WriteString(req.Key)
+	}
+
+	if req.Action.HasSource() {
+		if req.SourceAddr == nil {
+			buffer.WriteByte(0)
+		} else {
+			buffer.WriteByte(byte(len(*req.SourceAddr)))
+			buffer.WriteString(*req.SourceAddr)
+		}
+	}
+
+	if req.Action.HasRequestPayload() {
+		var size [4]byte
+		binary.LittleEndian.PutUint32(size[:], uint32(len(req.Payload)))
+		buffer.Write(size[:])
+		buffer.Write(req.Payload)
+	}
+
+	return nil
+}
+
+// Decode reads the response of the action.
+func Decode(r io.Reader, action Action) (Response, error) {
+	return decode(r, action, false)
+}
+
+// DecodeDetailed reads the response of the action on a connection agreeing on
+// CapErrorDetails.
+func DecodeDetailed(r io.Reader, action Action) (Response, error) {
+	return decode(r, action, true)
+}
+
+func decode(r io.Reader, action Action, detailed bool) (Response, error) {
+	result := make([]byte, 1)
+	if _, err := io.ReadFull(r, result); err != nil {
+		return Response{}, err
+	}
+
+	if result[0] != '+' {
+		resp := Response{Denied: result[0] == '!'}
+		if !detailed {
+			return resp, nil
+		}
+
+		details := make([]byte, 2)
+		if _, err := io.ReadFull(r, details); err != nil {
+			return Response{}, err
+		}
+		reason := make([]byte, details[1])
+		if _, err := io.ReadFull(r, reason); err != nil {
+			return Response{}, err
+		}
+		resp.Code, resp.Reason = Code(details[0]), string(reason)
+
+		return resp, nil
+	}
+
+	if !action.HasPayload() {
+		return Response{Accepted: true}, nil
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return Response{}, err
+	}
+
+	size := binary.LittleEndian.Uint32(header)
+	if size > MaxPayloadSize {
+		return Response{}, ErrMalformed
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return Response{}, err
+	}
+
+	return Response{Accepted: true, Payload: payload}, nil
+}
+
+func decodePayload(r io.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	size := binary.LittleEndian.Uint32(header)
+	if size > MaxPayloadSize {
+		return nil, ErrPayloadSize
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// DecodeRequest reads a request frame on the server side, v1 or v2.
+func DecodeRequest(r *bufio.Reader) (Request, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return Request{}, err
+	}
+	if b == frameV2 {
+		return decodeRequestV2(r)
+	}
+
+	action := Action(b &^ (requestIDFlag | priorityFlag | labelsFlag))
+	if !action.Valid() || (b&priorityFlag != 0 && action != Lock) || (b&labelsFlag != 0 && action != Lock && action != List) {
+		return Request{}, fmt.Errorf("unknown action %d", b)
+	}
+
+	req := Request{Action: action}
+	if b&requestIDFlag != 0 {
+		id := make([]byte, 8)
+		if _, err := io.ReadFull(r, id); err != nil {
+			return Request{}, err
+		}
+		req.ID = binary.LittleEndian.Uint64(id)
+	}
+	if b&priorityFlag != 0 {
+		if req.Priority, err = r.ReadByte(); err != nil {
+			return Request{}, err
+		}
+	}
+	if b&labelsFlag != 0 {
+		if action == List {
+			req.ListLabels = true
+		} else if req.Labels, err = DecodeLabels(r); err != nil {
+			return Request{}, err
+		}
+	}
+	if action.HasKey() {
+		if req.Key, err = decodeString(r); err != nil {
+			return Request{}, err
+		}
+	}
+	if action.HasSource() {
+		sourceAddr, err := decodeString(r)
+		if err != nil {
+			return Request{}, err
+		}
+		req.SourceAddr = &sourceAddr
+	}
+	if action.HasRequestPayload() {
+		if req.Payload, err = decodePayload(r); err != nil {
+			return Request{}, err
+		}
+	}
+
+	return req, nil
+}
+
+func decodeString(r *bufio.Reader) (string, error) {
+	size, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// DecodeID reads the little endian uint64 request id prefixing the responses
+// of the multiplexed connections, the response of the request follows it.
+func DecodeID(r io.Reader) (uint64, error) {
+	id := make([]byte, 8)
+	if _, err := io.ReadFull(r, id); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(id), nil
+}
+
+// EncodeMultiplexed prepares the response of the request of the id on a
+// multiplexed connection on the server side.
+func EncodeMultiplexed(id uint64, action Action, resp Response) []byte {
+	b := make([]byte, 8, 8+5+len(resp.Payload))
+	binary.LittleEndian.PutUint64(b, id)
+	return append(b, EncodeResponse(action, resp)...)
+}
+
+// EncodeDetailed prepares the response of the action on a connection agreeing
+// on CapErrorDetails on the server side, the reason is cut at 255 bytes.
+func EncodeDetailed(action Action, resp Response) []byte {
+	b := EncodeResponse(action, resp)
+	if resp.Accepted && !resp.Denied {
+		return b
+	}
+
+	reason := resp.Reason
+	if len(reason) > 255 {
+		reason = reason[:255]
+	}
+	b = append(b, byte(resp.Code), byte(len(reason)))
+	return append(b, reason...)
+}
+
+// EncodeResponse prepares the response of the action on the server side.
+func EncodeResponse(action Action, resp Response) []byte {
+	if resp.Denied {
+		return []byte("!")
+	}
+	if !resp.Accepted {
+		return []byte("-")
+	}
+	if !action.HasPayload() {
+		return []byte("+")
+	}
+
+	b := make([]byte, 5+len(resp.Payload))
+	b[0] = '+'
+	binary.LittleEndian.PutUint32(b[1:], uint32(len(resp.Payload)))
+	copy(b[5:], resp.Payload)
+
+	return b
+}
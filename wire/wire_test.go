@@ -0,0 +1,458 @@
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func source(s string) *string {
+	return &s
+}
+
+func TestRequestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		req  Request
+		want Request
+	}{
+		{
+			name: "lock",
+			req:  Request{Action: Lock, Key: "orders/1", SourceAddr: source("10.0.0.1")},
+		},
+		{
+			name: "lock with id, priority and labels",
+			req:  Request{Action: Lock, ID: 42, Priority: 7, Labels: map[string]string{"job": "import", "reason": "nightly"}, Key: "k", SourceAddr: source("s")},
+		},
+		{
+			name: "lock without source",
+			req:  Request{Action: Lock, Key: "k"},
+			want: Request{Action: Lock, Key: "k", SourceAddr: source("")},
+		},
+		{
+			name: "unlock drops priority and labels",
+			req:  Request{Action: Unlock, Priority: 3, Labels: map[string]string{"a": "b"}, Key: "k"},
+			want: Request{Action: Unlock, Key: "k"},
+		},
+		{
+			name: "reset by source",
+			req:  Request{Action: ResetBySource, SourceAddr: source("s")},
+		},
+		{
+			name: "list with labels",
+			req:  Request{Action: List, ID: 1, ListLabels: true},
+		},
+		{
+			name: "hello",
+			req:  Request{Action: Hello, Payload: EncodeHello(HelloPayload{Version: ProtocolVersion, Capabilities: Capabilities})},
+		},
+		{
+			name: "v2 lock",
+			req:  Request{Action: Lock, Version: 2, ID: 1 << 40, Priority: 200, Barge: true, MaxWait: 3 * time.Second, Labels: map[string]string{"x": ""}, Key: "k", SourceAddr: source("s")},
+		},
+		{
+			name: "v2 max wait rounded up",
+			req:  Request{Action: Lock, Version: 2, MaxWait: 1500 * time.Microsecond, Key: "k", SourceAddr: source("s")},
+			want: Request{Action: Lock, Version: 2, MaxWait: 2 * time.Millisecond, Key: "k", SourceAddr: source("s")},
+		},
+		{
+			name: "v2 long key and source",
+			req:  Request{Action: Lock, Version: 2, Key: strings.Repeat("k", MaxKeySizeV2), SourceAddr: source(strings.Repeat("s", MaxSourceAddrSizeV2))},
+		},
+		{
+			name: "v2 lock without source",
+			req:  Request{Action: Lock, Version: 2, Key: "k"},
+			want: Request{Action: Lock, Version: 2, Key: "k", SourceAddr: source("")},
+		},
+		{
+			name: "v2 unlock drops the lock fields",
+			req:  Request{Action: Unlock, Version: 2, Priority: 1, Barge: true, MaxWait: time.Second, Labels: map[string]string{"a": "b"}, Key: "k"},
+			want: Request{Action: Unlock, Version: 2, Key: "k"},
+		},
+		{
+			name: "v2 list with labels",
+			req:  Request{Action: List, Version: 2, ListLabels: true},
+		},
+		{
+			name: "v2 auth",
+			req:  Request{Action: Auth, Version: 2, Payload: []byte("token")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.want
+			if want.Action == 0 {
+				want = tt.req
+			}
+
+			b, err := Encode(tt.req)
+			if err != nil {
+				t.Fatalf("encode: %s", err)
+			}
+			got, err := DecodeRequest(bufio.NewReader(bytes.NewReader(b)))
+			if err != nil {
+				t.Fatalf("decode: %s", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestRequestsInSequence(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+	reqs := []Request{
+		{Action: Lock, Key: "a", SourceAddr: source("s")},
+		{Action: Lock, Version: 2, Key: "b", SourceAddr: source("s")},
+		{Action: Unlock, Key: "a"},
+		{Action: Unlock, Version: 2, Key: "b"},
+	}
+	for _, req := range reqs {
+		if err := EncodeTo(buffer, req); err != nil {
+			t.Fatalf("encode: %s", err)
+		}
+	}
+
+	r := bufio.NewReader(buffer)
+	for i, want := range reqs {
+		got, err := DecodeRequest(r)
+		if err != nil {
+			t.Fatalf("decode %d: %s", i, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("request %d: got %+v, want %+v", i, got, want)
+		}
+	}
+}
+
+func TestEncodeOversize(t *testing.T) {
+	labels := make(map[string]string, MaxLabels+1)
+	for i := 0; i <= MaxLabels; i++ {
+		labels[fmt.Sprintf("l%d", i)] = "v"
+	}
+
+	tests := []struct {
+		name string
+		req  Request
+		err  error
+	}{
+		{"empty key", Request{Action: Lock}, ErrKeySize},
+		{"long key", Request{Action: Lock, Key: strings.Repeat("k", MaxKeySize+1)}, ErrKeySize},
+		{"long source", Request{Action: Lock, Key: "k", SourceAddr: source(strings.Repeat("s", MaxSourceAddrSize+1))}, ErrSourceAddrSize},
+		{"too many labels", Request{Action: Lock, Key: "k", Labels: labels}, ErrLabelSize},
+		{"empty label name", Request{Action: Lock, Key: "k", Labels: map[string]string{"": "v"}}, ErrLabelSize},
+		{"long label value", Request{Action: Lock, Key: "k", Labels: map[string]string{"n": strings.Repeat("v", MaxLabelSize+1)}}, ErrLabelSize},
+		{"long payload", Request{Action: Auth, Payload: make([]byte, MaxPayloadSize+1)}, ErrPayloadSize},
+		{"v2 empty key", Request{Action: Lock, Version: 2}, ErrKeySize},
+		{"v2 long key", Request{Action: Lock, Version: 2, Key: strings.Repeat("k", MaxKeySizeV2+1)}, ErrKeySize},
+		{"v2 long source", Request{Action: Lock, Version: 2, Key: "k", SourceAddr: source(strings.Repeat("s", MaxSourceAddrSizeV2+1))}, ErrSourceAddrSize},
+		{"v2 too many labels", Request{Action: Lock, Version: 2, Key: "k", Labels: labels}, ErrLabelSize},
+		{"v2 long payload", Request{Action: Auth, Version: 2, Payload: make([]byte, MaxPayloadSize+1)}, ErrPayloadSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Encode(tt.req); err != tt.err {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+// frame builds a v2 request frame of the raw fields
+func frame(fields ...[]byte) []byte {
+	content := bytes.Join(fields, nil)
+
+	b := bytes.NewBuffer([]byte{frameV2})
+	putUvarint(b, uint64(len(content)))
+	b.Write(content)
+	return b.Bytes()
+}
+
+func uvarint(v uint64) []byte {
+	b := make([]byte, binary.MaxVarintLen64)
+	return b[:binary.PutUvarint(b, v)]
+}
+
+func field(tag uint64, value []byte) []byte {
+	b := bytes.NewBuffer(nil)
+	putField(b, tag, value)
+	return b.Bytes()
+}
+
+func TestDecodeMalformedRequest(t *testing.T) {
+	oversize := bytes.NewBuffer([]byte{frameV2})
+	putUvarint(oversize, MaxFrameSizeV2+1)
+
+	tests := []struct {
+		name  string
+		frame []byte
+		err   error
+	}{
+		{"empty", nil, nil},
+		{"unknown action", []byte{31}, nil},
+		{"priority of unlock", []byte{byte(Unlock) | priorityFlag, 1, 1, 'k'}, nil},
+		{"labels of unlock", []byte{byte(Unlock) | labelsFlag, 0, 1, 'k'}, nil},
+		{"truncated id", []byte{byte(Lock) | requestIDFlag, 1, 2, 3}, nil},
+		{"truncated key", []byte{byte(Lock), 5, 'a', 'b'}, nil},
+		{"missing source", []byte{byte(Lock), 1, 'k'}, nil},
+		{"truncated payload", []byte{byte(Auth), 4, 0, 0, 0, 'a'}, nil},
+		{"long payload", append([]byte{byte(Auth)}, uvarintLE(MaxPayloadSize+1)...), ErrPayloadSize},
+		{"v2 truncated size", []byte{frameV2}, nil},
+		{"v2 truncated frame", []byte{frameV2, 5, byte(Lock)}, nil},
+		{"v2 oversize frame", oversize.Bytes(), ErrFrameSize},
+		{"v2 unknown action", frame(uvarint(99)), ErrMalformed},
+		{"v2 zero action", frame(uvarint(0)), ErrMalformed},
+		{"v2 field beyond the frame", frame(uvarint(uint64(Lock)), uvarint(fieldKey), uvarint(10), []byte("k")), ErrMalformed},
+		{"v2 truncated tag", frame(uvarint(uint64(Lock)), []byte{0x80}), ErrMalformed},
+		{"v2 long priority", frame(uvarint(uint64(Lock)), field(fieldPriority, []byte{1, 2})), ErrMalformed},
+		{"v2 bad id", frame(uvarint(uint64(Lock)), field(fieldID, []byte{0x80})), ErrMalformed},
+		{"v2 bad max wait", frame(uvarint(uint64(Lock)), field(fieldMaxWait, nil)), ErrMalformed},
+		{"v2 label beyond its field", frame(uvarint(uint64(Lock)), field(fieldLabel, []byte{5, 'a'})), ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeRequest(bufio.NewReader(bytes.NewReader(tt.frame)))
+			if err == nil {
+				t.Fatal("malformed request is decoded")
+			}
+			if tt.err != nil && err != tt.err {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func uvarintLE(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return b
+}
+
+func TestDecodeSkipsUnknownFields(t *testing.T) {
+	b := frame(uvarint(uint64(Unlock)), field(99, []byte("future")), field(fieldKey, []byte("k")))
+
+	got, err := DecodeRequest(bufio.NewReader(bytes.NewReader(b)))
+	if err != nil {
+		t.Fatalf("decode: %s", err)
+	}
+	if want := (Request{Action: Unlock, Version: 2, Key: "k"}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func equalResponse(got Response, want Response) bool {
+	return got.Accepted == want.Accepted && got.Denied == want.Denied && got.Code == want.Code &&
+		got.Reason == want.Reason && bytes.Equal(got.Payload, want.Payload)
+}
+
+func TestResponseRoundTrip(t *testing.T) {
+	payload := []byte("payload")
+
+	tests := []struct {
+		name   string
+		action Action
+		resp   Response
+		// want of the plain responses dropping the details of the rejections
+		want Response
+	}{
+		{"accepted", Lock, Response{Accepted: true}, Response{Accepted: true}},
+		{"rejected", Unlock, Response{}, Response{}},
+		{"denied", Lock, Response{Denied: true}, Response{Denied: true}},
+		{"payload", Status, Response{Accepted: true, Payload: []byte{1}}, Response{Accepted: true, Payload: []byte{1}}},
+		{"empty payload", List, Response{Accepted: true, Payload: []byte{}}, Response{Accepted: true, Payload: []byte{}}},
+		{"payload of an action without one", Lock, Response{Accepted: true, Payload: payload}, Response{Accepted: true}},
+		{"detailed rejection", Lock, Response{Code: CodeExpired, Reason: "max wait has passed"}, Response{}},
+		{"detailed denial", Lock, Response{Denied: true, Code: CodeDenied, Reason: "read-only token"}, Response{Denied: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(bytes.NewReader(EncodeResponse(tt.action, tt.resp)), tt.action)
+			if err != nil {
+				t.Fatalf("decode: %s", err)
+			}
+			if !equalResponse(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+
+			detailed := tt.want
+			detailed.Code, detailed.Reason = tt.resp.Code, tt.resp.Reason
+			if got, err = DecodeDetailed(bytes.NewReader(EncodeDetailed(tt.action, tt.resp)), tt.action); err != nil {
+				t.Fatalf("decode detailed: %s", err)
+			}
+			if !equalResponse(got, detailed) {
+				t.Fatalf("detailed: got %+v, want %+v", got, detailed)
+			}
+
+			if got, err = DecodeV2(bytes.NewReader(EncodeResponseV2(tt.action, tt.resp)), tt.action); err != nil {
+				t.Fatalf("decode v2: %s", err)
+			}
+			if !equalResponse(got, detailed) {
+				t.Fatalf("v2: got %+v, want %+v", got, detailed)
+			}
+		})
+	}
+}
+
+func TestDetailedReasonIsCut(t *testing.T) {
+	resp := Response{Code: CodeInvalid, Reason: strings.Repeat("r", 300)}
+
+	got, err := DecodeDetailed(bytes.NewReader(EncodeDetailed(Lock, resp)), Lock)
+	if err != nil {
+		t.Fatalf("decode: %s", err)
+	}
+	if len(got.Reason) != 255 || got.Code != CodeInvalid {
+		t.Fatalf("got the code %s and the reason of %d bytes", got.Code, len(got.Reason))
+	}
+}
+
+func TestMultiplexedRoundTrip(t *testing.T) {
+	r := bytes.NewReader(EncodeMultiplexed(7, Status, Response{Accepted: true, Payload: []byte{1}}))
+
+	id, err := DecodeID(r)
+	if err != nil || id != 7 {
+		t.Fatalf("got the id %d: %v", id, err)
+	}
+	got, err := Decode(r, Status)
+	if err != nil {
+		t.Fatalf("decode: %s", err)
+	}
+	if want := (Response{Accepted: true, Payload: []byte{1}}); !equalResponse(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeMalformedResponse(t *testing.T) {
+	oversize := bytes.NewBuffer([]byte{'+'})
+	putUvarint(oversize, MaxFrameSizeV2+1)
+
+	tests := []struct {
+		name     string
+		decode   func([]byte) (Response, error)
+		response []byte
+		err      error
+	}{
+		{"empty", decodeV1(Lock), nil, nil},
+		{"truncated size", decodeV1(Status), []byte{'+', 1, 0}, nil},
+		{"truncated payload", decodeV1(Status), []byte{'+', 2, 0, 0, 0, 1}, nil},
+		{"oversize payload", decodeV1(Status), append([]byte{'+'}, uvarintLE(MaxPayloadSize+1)...), ErrMalformed},
+		{"truncated details", decodeDetailed(Lock), []byte{'-', byte(CodeInvalid)}, nil},
+		{"truncated reason", decodeDetailed(Lock), []byte{'-', byte(CodeInvalid), 3, 'a'}, nil},
+		{"v2 empty", decodeV2(Lock), nil, nil},
+		{"v2 truncated size", decodeV2(Lock), []byte{'+'}, nil},
+		{"v2 truncated fields", decodeV2(Status), []byte{'+', 3, fieldPayload}, nil},
+		{"v2 oversize frame", decodeV2(Status), oversize.Bytes(), ErrFrameSize},
+		{"v2 field beyond the frame", decodeV2(Status), []byte{'+', 3, fieldPayload, 9, 1}, ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.decode(tt.response)
+			if err == nil {
+				t.Fatal("malformed response is decoded")
+			}
+			if tt.err != nil && err != tt.err {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func decodeV1(action Action) func([]byte) (Response, error) {
+	return func(b []byte) (Response, error) { return Decode(bytes.NewReader(b), action) }
+}
+
+func decodeDetailed(action Action) func([]byte) (Response, error) {
+	return func(b []byte) (Response, error) { return DecodeDetailed(bytes.NewReader(b), action) }
+}
+
+func decodeV2(action Action) func([]byte) (Response, error) {
+	return func(b []byte) (Response, error) { return DecodeV2(bytes.NewReader(b), action) }
+}
+
+func TestHelloRoundTrip(t *testing.T) {
+	tests := []HelloPayload{
+		{},
+		{Version: 1, Capabilities: CapObserve | CapWatch},
+		{Version: ProtocolVersion, Capabilities: Capabilities},
+		{Version: 0xffff, Capabilities: 0xffffffff},
+	}
+
+	for _, hello := range tests {
+		got, err := DecodeHello(EncodeHello(hello))
+		if err != nil {
+			t.Fatalf("decode %+v: %s", hello, err)
+		}
+		if got != hello {
+			t.Fatalf("got %+v, want %+v", got, hello)
+		}
+	}
+}
+
+func TestDecodeMalformedHello(t *testing.T) {
+	for size := 0; size < 6; size++ {
+		if _, err := DecodeHello(make([]byte, size)); !errors.Is(err, ErrMalformed) {
+			t.Fatalf("hello of %d bytes: got %v, want %v", size, err, ErrMalformed)
+		}
+	}
+
+	// the bytes after the capabilities are left to the later versions
+	got, err := DecodeHello(append(EncodeHello(HelloPayload{Version: 2, Capabilities: CapLabels}), 1, 2))
+	if err != nil || got != (HelloPayload{Version: 2, Capabilities: CapLabels}) {
+		t.Fatalf("got %+v: %v", got, err)
+	}
+}
+
+func benchmarkRequests() []struct {
+	name string
+	req  Request
+} {
+	return []struct {
+		name string
+		req  Request
+	}{
+		{"v1 lock", Request{Action: Lock, Key: "orders/42", SourceAddr: source("10.0.0.1:4242")}},
+		{"v1 lock with id", Request{Action: Lock, ID: 1 << 40, Priority: 5, Key: "orders/42", SourceAddr: source("10.0.0.1:4242")}},
+		{"v2 lock", Request{Action: Lock, Version: 2, ID: 1 << 40, Priority: 5, Barge: true, MaxWait: time.Second, Key: "orders/42", SourceAddr: source("10.0.0.1:4242")}},
+		{"v2 lock with labels", Request{Action: Lock, Version: 2, ID: 1 << 40, Labels: map[string]string{"job": "import", "reason": "nightly"}, Key: "orders/42", SourceAddr: source("10.0.0.1:4242")}},
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	for _, bb := range benchmarkRequests() {
+		b.Run(bb.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := Encode(bb.req); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkEncodeTo(b *testing.B) {
+	for _, bb := range benchmarkRequests() {
+		b.Run(bb.name, func(b *testing.B) {
+			buffer := bytes.NewBuffer(make([]byte, 0, 512))
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buffer.Reset()
+				if err := EncodeTo(buffer, bb.req); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
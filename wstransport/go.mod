@@ -0,0 +1,10 @@
+module github.com/freakmaxi/locking-center-client-go/wstransport
+
+go 1.19
+
+require (
+	github.com/freakmaxi/locking-center-client-go v0.0.0
+	golang.org/x/net v0.16.0
+)
+
+replace github.com/freakmaxi/locking-center-client-go => ../
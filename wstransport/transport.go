@@ -0,0 +1,60 @@
+package wstransport
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/freakmaxi/locking-center-client-go/mutex"
+	"golang.org/x/net/websocket"
+)
+
+// Dialer tunnels the connections of the client through the websocket
+// connections to the url of the proxy served by Proxy, like
+// wss://gateway/locking-center. It is given to the client by mutex.WithDialer,
+// the address of the client is not used.
+func Dialer(url string, origin string) (mutex.DialFunc, error) {
+	config, err := websocket.NewConfig(url, origin)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(_ string, timeout time.Duration) (net.Conn, error) {
+		c := *config
+		c.Dialer = &net.Dialer{Timeout: timeout}
+
+		conn, err := websocket.DialConfig(&c)
+		if err != nil {
+			return nil, err
+		}
+		conn.PayloadType = websocket.BinaryFrame
+
+		return conn, nil
+	}, nil
+}
+
+// Proxy serves the tunnels of Dialer by connecting each of them to the
+// locking-center at the address.
+func Proxy(address string) http.Handler {
+	return websocket.Server{
+		// the clients are not browsers, the origin is not checked
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			ws.PayloadType = websocket.BinaryFrame
+
+			conn, err := net.Dial("tcp", address)
+			if err != nil {
+				return
+			}
+
+			go func() {
+				_, _ = io.Copy(conn, ws)
+				_ = conn.Close()
+			}()
+
+			_, _ = io.Copy(ws, conn)
+			_ = ws.Close()
+		},
+	}
+}